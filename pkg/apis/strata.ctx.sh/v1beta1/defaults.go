@@ -27,15 +27,176 @@ const (
 	DefaultCollectorWorkers int64 = 1
 	// DefaultCollectorIncludeMetadata is the default value for including metadata.
 	DefaultCollectorIncludeMetadata bool = false
+	// DefaultCollectorIncludeMetricMetadata is the default value for including
+	// the metric family metadata when encoding.
+	DefaultCollectorIncludeMetricMetadata bool = false
+	// DefaultCollectorIncludeExemplars is the default value for including
+	// exemplars when encoding.
+	DefaultCollectorIncludeExemplars bool = false
+	// DefaultCollectorHonorTimestamps is the default value for using the
+	// exposed sample timestamps.
+	DefaultCollectorHonorTimestamps bool = false
+	// DefaultCollectorMaxResourceAgeSeconds is the default maximum time that a
+	// resource can wait to be collected.  By default resources never expire.
+	DefaultCollectorMaxResourceAgeSeconds int64 = 0
+	// DefaultCollectorScrapeBodySizeLimitBytes is the default maximum size of
+	// a scrape response.  0 disables the limit.
+	DefaultCollectorScrapeBodySizeLimitBytes int64 = 0
+	// DefaultCollectorScrapeSampleLimit is the default maximum number of
+	// samples per scrape.  0 disables the limit.
+	DefaultCollectorScrapeSampleLimit int64 = 0
+	// DefaultCollectorScrapeLabelLimit is the default maximum number of labels
+	// per sample.  0 disables the limit.
+	DefaultCollectorScrapeLabelLimit int64 = 0
+	// DefaultCollectorScrapeLabelNameLengthLimit is the default maximum length
+	// of a label name.  0 disables the limit.
+	DefaultCollectorScrapeLabelNameLengthLimit int64 = 0
+	// DefaultCollectorScrapeLabelValueLengthLimit is the default maximum length
+	// of a label value.  0 disables the limit.
+	DefaultCollectorScrapeLabelValueLengthLimit int64 = 0
+	// DefaultCollectorScrapeTargetSecrets is the default value for allowing
+	// targets to reference secrets using annotations.
+	DefaultCollectorScrapeTargetSecrets bool = false
+	// DefaultCollectorFlattenHistograms is the default value for flattening
+	// histograms and summaries.
+	DefaultCollectorFlattenHistograms bool = true
 	// DefaultCollectorBufferSize is the default buffer size for the collector service.
 	DefaultCollectorBufferSize int64 = 10000
 	// DefaultCollectorEncoder is the default output encoder for a collector output.
 	DefaultCollectorEncoder string = "json"
+	// DefaultCollectorOutputName is the name of the output when the single
+	// output configuration is used.
+	DefaultCollectorOutputName string = "default"
+	// DefaultCollectorOutputBufferSize is the default number of batches that
+	// can be queued for an output.
+	DefaultCollectorOutputBufferSize int64 = 100
+	// DefaultCollectorOutputBatchSize is the default maximum number of metrics
+	// sent in a single batch.  By default batching is disabled.
+	DefaultCollectorOutputBatchSize int64 = 1
+	// DefaultCollectorOutputFlushIntervalMilliseconds is the default time a
+	// partial batch is held.
+	DefaultCollectorOutputFlushIntervalMilliseconds int64 = 1000
+
+	// DefaultCollectorOutputBufferPath is the default directory for the output
+	// buffer segment files.
+	DefaultCollectorOutputBufferPath string = "/var/lib/strata-collector/buffer"
+	// DefaultCollectorOutputBufferMaxSizeBytes is the default maximum size of
+	// the buffer for each output.
+	DefaultCollectorOutputBufferMaxSizeBytes int64 = 1 << 30
+	// DefaultCollectorOutputBufferMaxSegmentSizeBytes is the default size at
+	// which a new segment is started.
+	DefaultCollectorOutputBufferMaxSegmentSizeBytes int64 = 64 << 20
+	// DefaultCollectorOutputBufferMaxAgeSeconds is the default maximum age of
+	// a segment.
+	DefaultCollectorOutputBufferMaxAgeSeconds int64 = 3600
+	// DefaultCollectorOutputBufferReplayIntervalSeconds is the default interval
+	// between replays.
+	DefaultCollectorOutputBufferReplayIntervalSeconds int64 = 10
 
 	// DefaultCollectorClipFilterInclusive is the default value for the inclusive
 	// flag on the clip filter.
 	DefaultCollectorClipFilterInclusive bool = false
 
+	// DefaultNatsURL is the default url for the nats output.
+	DefaultNatsURL string = "nats://127.0.0.1"
+	// DefaultNatsPort is the default port for the nats output.
+	DefaultNatsPort int32 = 4222
+	// DefaultNatsSubject is the default subject that metrics are published to.
+	DefaultNatsSubject string = "strata"
+	// DefaultNatsMaxReconnects is the default number of reconnect attempts.  By
+	// default the output will attempt to reconnect forever.
+	DefaultNatsMaxReconnects int64 = -1
+	// DefaultNatsReconnectWaitSeconds is the default time to wait between reconnects.
+	DefaultNatsReconnectWaitSeconds int64 = 2
+	// DefaultNatsConnectTimeoutSeconds is the default timeout for the initial connection.
+	DefaultNatsConnectTimeoutSeconds int64 = 2
+	// DefaultNatsDrainTimeoutSeconds is the default time allowed to drain the connection.
+	DefaultNatsDrainTimeoutSeconds int64 = 30
+
+	// DefaultKafkaTopic is the default topic that metrics are produced to.
+	DefaultKafkaTopic string = "strata"
+	// DefaultKafkaAcks is the default required acknowledgements for the kafka output.
+	DefaultKafkaAcks string = "all"
+	// DefaultKafkaCompression is the default compression codec for the kafka output.
+	DefaultKafkaCompression string = "none"
+	// DefaultKafkaPartitionKey is the default partition key strategy for the kafka output.
+	DefaultKafkaPartitionKey string = "series"
+	// DefaultKafkaBatchSize is the default maximum number of messages in a batch.
+	DefaultKafkaBatchSize int64 = 1000
+	// DefaultKafkaBatchTimeoutMilliseconds is the default time a partial batch is held.
+	DefaultKafkaBatchTimeoutMilliseconds int64 = 100
+	// DefaultKafkaSASLMechanism is the default SASL mechanism.
+	DefaultKafkaSASLMechanism string = "plain"
+
+	// DefaultHTTPMethod is the default method used by the http output.
+	DefaultHTTPMethod string = "POST"
+	// DefaultHTTPGzip is the default value for compressing http requests.
+	DefaultHTTPGzip bool = false
+	// DefaultHTTPBatchSize is the default maximum number of metrics in a request.
+	DefaultHTTPBatchSize int64 = 1000
+	// DefaultHTTPFlushIntervalMilliseconds is the default time a partial batch is held.
+	DefaultHTTPFlushIntervalMilliseconds int64 = 1000
+	// DefaultHTTPMaxRetries is the default number of retries for failed requests.
+	DefaultHTTPMaxRetries int64 = 5
+	// DefaultHTTPTimeoutSeconds is the default timeout for a single request.
+	DefaultHTTPTimeoutSeconds int64 = 10
+
+	// DefaultStatsdAddress is the default address of the statsd server.
+	DefaultStatsdAddress string = "127.0.0.1:8125"
+	// DefaultStatsdProtocol is the default protocol for the statsd output.
+	DefaultStatsdProtocol string = "udp"
+	// DefaultStatsdMTU is the default maximum datagram size.  It's small enough
+	// to avoid fragmentation on most networks.
+	DefaultStatsdMTU int64 = 1432
+	// DefaultStatsdFlushIntervalMilliseconds is the default time lines are buffered.
+	DefaultStatsdFlushIntervalMilliseconds int64 = 100
+
+	// DefaultRemoteWriteTenantHeader is the default header used to pass the tenant.
+	DefaultRemoteWriteTenantHeader string = "X-Scope-OrgID"
+	// DefaultRemoteWriteShards is the default number of concurrent senders.
+	DefaultRemoteWriteShards int64 = 4
+	// DefaultRemoteWriteCapacity is the default number of samples queued per shard.
+	DefaultRemoteWriteCapacity int64 = 10000
+	// DefaultRemoteWriteMaxSamplesPerSend is the default maximum samples in a request.
+	DefaultRemoteWriteMaxSamplesPerSend int64 = 2000
+	// DefaultRemoteWriteBatchSendDeadlineMilliseconds is the default time a partial
+	// batch is held.
+	DefaultRemoteWriteBatchSendDeadlineMilliseconds int64 = 5000
+	// DefaultRemoteWriteMaxRetries is the default number of retries.
+	DefaultRemoteWriteMaxRetries int64 = 10
+	// DefaultRemoteWriteTimeoutSeconds is the default timeout for a single request.
+	DefaultRemoteWriteTimeoutSeconds int64 = 30
+
+	// DefaultOTLPEndpoint is the default endpoint for the otlp output.
+	DefaultOTLPEndpoint string = "127.0.0.1:4317"
+	// DefaultOTLPProtocol is the default protocol for the otlp output.
+	DefaultOTLPProtocol string = "grpc"
+	// DefaultOTLPGzip is the default value for compressing otlp requests.
+	DefaultOTLPGzip bool = false
+	// DefaultOTLPBatchSize is the default maximum number of metrics in a request.
+	DefaultOTLPBatchSize int64 = 1000
+	// DefaultOTLPFlushIntervalMilliseconds is the default time a partial batch is held.
+	DefaultOTLPFlushIntervalMilliseconds int64 = 1000
+	// DefaultOTLPMaxRetries is the default number of retries.
+	DefaultOTLPMaxRetries int64 = 5
+	// DefaultOTLPTimeoutSeconds is the default timeout for a single request.
+	DefaultOTLPTimeoutSeconds int64 = 10
+
+	// DefaultFluentAddress is the default address of the fluent forward server.
+	DefaultFluentAddress string = "127.0.0.1:24224"
+	// DefaultFluentTag is the default tag template for the fluent output.
+	DefaultFluentTag string = "strata.{{.Resource.Namespace}}.{{.Metric.Name}}"
+	// DefaultFluentRequireAck is the default value for requiring acknowledgements.
+	DefaultFluentRequireAck bool = false
+	// DefaultFluentBatchSize is the default maximum number of buffered entries.
+	DefaultFluentBatchSize int64 = 1000
+	// DefaultFluentFlushIntervalMilliseconds is the default time a partial batch is held.
+	DefaultFluentFlushIntervalMilliseconds int64 = 1000
+	// DefaultFluentMaxRetries is the default number of retries.
+	DefaultFluentMaxRetries int64 = 5
+	// DefaultFluentTimeoutSeconds is the default connection timeout.
+	DefaultFluentTimeoutSeconds int64 = 10
+
 	// DefaultDiscoveryPrefix is the default prefix for all resources.
 	DefaultDiscoveryPrefix string = "prometheus.io"
 	// DefaultDiscoveryIntervalSeconds is the default interval in seconds that the discovery
@@ -104,11 +265,47 @@ func defaultedCollector(obj *Collector) {
 		obj.Spec.Workers = &workers
 	}
 
-	if obj.Spec.Output == nil {
-		output := &CollectorOutput{
-			Stdout: &Stdout{},
-		}
-		obj.Spec.Output = output
+	if obj.Spec.IncludeMetricMetadata == nil {
+		includeMetricMetadata := DefaultCollectorIncludeMetricMetadata
+		obj.Spec.IncludeMetricMetadata = &includeMetricMetadata
+	}
+
+	if obj.Spec.IncludeExemplars == nil {
+		includeExemplars := DefaultCollectorIncludeExemplars
+		obj.Spec.IncludeExemplars = &includeExemplars
+	}
+
+	if obj.Spec.Scrape == nil {
+		scrape := &CollectorScrape{}
+		obj.Spec.Scrape = scrape
+	}
+	defaultedCollectorScrape(obj.Spec.Scrape)
+
+	if obj.Spec.HonorTimestamps == nil {
+		honorTimestamps := DefaultCollectorHonorTimestamps
+		obj.Spec.HonorTimestamps = &honorTimestamps
+	}
+
+	if obj.Spec.MaxResourceAgeSeconds == nil {
+		maxResourceAge := DefaultCollectorMaxResourceAgeSeconds
+		obj.Spec.MaxResourceAgeSeconds = &maxResourceAge
+	}
+
+	if obj.Spec.FlattenHistograms == nil {
+		flatten := DefaultCollectorFlattenHistograms
+		obj.Spec.FlattenHistograms = &flatten
+	}
+
+	// The stdout output used when nothing has been configured is not
+	// persisted, otherwise adding outputs later would conflict with it.
+	// Collectors that were defaulted with it before are migrated by dropping
+	// it once outputs have been added.
+	if obj.Spec.Output != nil && len(obj.Spec.Outputs) > 0 && isStdoutOutput(obj.Spec.Output) {
+		obj.Spec.Output = nil
+	}
+
+	if obj.Spec.Output != nil {
+		defaultedCollectorOutput(obj.Spec.Output)
 	}
 
 	if obj.Spec.Encoder == nil {
@@ -116,6 +313,14 @@ func defaultedCollector(obj *Collector) {
 		obj.Spec.Encoder = &encoder
 	}
 
+	for i := range obj.Spec.Outputs {
+		defaultedCollectorOutputConfig(&obj.Spec.Outputs[i], &obj.Spec)
+	}
+
+	if obj.Spec.OutputBuffer != nil {
+		defaultedCollectorOutputBuffer(obj.Spec.OutputBuffer)
+	}
+
 	if obj.Spec.Filters == nil {
 		filters := &CollectorFilters{}
 		obj.Spec.Filters = filters
@@ -124,6 +329,384 @@ func defaultedCollector(obj *Collector) {
 	}
 }
 
+// isStdoutOutput returns true if stdout is the only data sink of the output.
+func isStdoutOutput(obj *CollectorOutput) bool {
+	return obj.Stdout != nil && obj.Nats == nil && obj.Kafka == nil &&
+		obj.HTTP == nil && obj.Statsd == nil && obj.RemoteWrite == nil &&
+		obj.OTLP == nil && obj.Fluent == nil
+}
+
+func defaultedCollectorScrape(obj *CollectorScrape) {
+	if obj.BodySizeLimitBytes == nil {
+		bodySizeLimit := DefaultCollectorScrapeBodySizeLimitBytes
+		obj.BodySizeLimitBytes = &bodySizeLimit
+	}
+
+	if obj.SampleLimit == nil {
+		sampleLimit := DefaultCollectorScrapeSampleLimit
+		obj.SampleLimit = &sampleLimit
+	}
+
+	if obj.LabelLimit == nil {
+		labelLimit := DefaultCollectorScrapeLabelLimit
+		obj.LabelLimit = &labelLimit
+	}
+
+	if obj.LabelNameLengthLimit == nil {
+		labelNameLengthLimit := DefaultCollectorScrapeLabelNameLengthLimit
+		obj.LabelNameLengthLimit = &labelNameLengthLimit
+	}
+
+	if obj.LabelValueLengthLimit == nil {
+		labelValueLengthLimit := DefaultCollectorScrapeLabelValueLengthLimit
+		obj.LabelValueLengthLimit = &labelValueLengthLimit
+	}
+
+	if obj.TargetSecrets == nil {
+		targetSecrets := DefaultCollectorScrapeTargetSecrets
+		obj.TargetSecrets = &targetSecrets
+	}
+}
+
+func defaultedCollectorOutputBuffer(obj *CollectorOutputBuffer) {
+	if obj.Path == nil {
+		path := DefaultCollectorOutputBufferPath
+		obj.Path = &path
+	}
+
+	if obj.MaxSizeBytes == nil {
+		maxSize := DefaultCollectorOutputBufferMaxSizeBytes
+		obj.MaxSizeBytes = &maxSize
+	}
+
+	if obj.MaxSegmentSizeBytes == nil {
+		maxSegmentSize := DefaultCollectorOutputBufferMaxSegmentSizeBytes
+		obj.MaxSegmentSizeBytes = &maxSegmentSize
+	}
+
+	if obj.MaxAgeSeconds == nil {
+		maxAge := DefaultCollectorOutputBufferMaxAgeSeconds
+		obj.MaxAgeSeconds = &maxAge
+	}
+
+	if obj.ReplayIntervalSeconds == nil {
+		replayInterval := DefaultCollectorOutputBufferReplayIntervalSeconds
+		obj.ReplayIntervalSeconds = &replayInterval
+	}
+}
+
+// defaultedCollectorOutputConfig defaults the output using the collector
+// settings where the output setting falls back to the collector.
+func defaultedCollectorOutputConfig(obj *CollectorOutputConfig, spec *CollectorSpec) {
+	if obj.Encoder == nil {
+		encoder := *spec.Encoder
+		obj.Encoder = &encoder
+	}
+
+	if obj.IncludeMetricMetadata == nil {
+		includeMetricMetadata := *spec.IncludeMetricMetadata
+		obj.IncludeMetricMetadata = &includeMetricMetadata
+	}
+
+	if obj.IncludeExemplars == nil {
+		includeExemplars := *spec.IncludeExemplars
+		obj.IncludeExemplars = &includeExemplars
+	}
+
+	if obj.BufferSize == nil {
+		bufferSize := DefaultCollectorOutputBufferSize
+		obj.BufferSize = &bufferSize
+	}
+
+	if obj.BatchSize == nil {
+		batchSize := DefaultCollectorOutputBatchSize
+		obj.BatchSize = &batchSize
+	}
+
+	if obj.FlushIntervalMilliseconds == nil {
+		flushInterval := DefaultCollectorOutputFlushIntervalMilliseconds
+		obj.FlushIntervalMilliseconds = &flushInterval
+	}
+
+	if obj.Filters == nil {
+		filters := &CollectorFilters{}
+		obj.Filters = filters
+	} else {
+		defaultedCollectorFilters(obj.Filters)
+	}
+
+	defaultedCollectorOutput(&obj.CollectorOutput)
+}
+
+func defaultedCollectorOutput(obj *CollectorOutput) {
+	if obj.Nats != nil {
+		defaultedNats(obj.Nats)
+	}
+
+	if obj.Kafka != nil {
+		defaultedKafka(obj.Kafka)
+	}
+
+	if obj.HTTP != nil {
+		defaultedHTTP(obj.HTTP)
+	}
+
+	if obj.Statsd != nil {
+		defaultedStatsd(obj.Statsd)
+	}
+
+	if obj.RemoteWrite != nil {
+		defaultedRemoteWrite(obj.RemoteWrite)
+	}
+
+	if obj.OTLP != nil {
+		defaultedOTLP(obj.OTLP)
+	}
+
+	if obj.Fluent != nil {
+		defaultedFluent(obj.Fluent)
+	}
+}
+
+func defaultedNats(obj *Nats) {
+	if obj.URL == nil {
+		url := DefaultNatsURL
+		obj.URL = &url
+	}
+
+	if obj.Port == nil {
+		port := DefaultNatsPort
+		obj.Port = &port
+	}
+
+	if obj.Subject == nil {
+		subject := DefaultNatsSubject
+		obj.Subject = &subject
+	}
+
+	if obj.MaxReconnects == nil {
+		maxReconnects := DefaultNatsMaxReconnects
+		obj.MaxReconnects = &maxReconnects
+	}
+
+	if obj.ReconnectWaitSeconds == nil {
+		reconnectWait := DefaultNatsReconnectWaitSeconds
+		obj.ReconnectWaitSeconds = &reconnectWait
+	}
+
+	if obj.ConnectTimeoutSeconds == nil {
+		connectTimeout := DefaultNatsConnectTimeoutSeconds
+		obj.ConnectTimeoutSeconds = &connectTimeout
+	}
+
+	if obj.DrainTimeoutSeconds == nil {
+		drainTimeout := DefaultNatsDrainTimeoutSeconds
+		obj.DrainTimeoutSeconds = &drainTimeout
+	}
+}
+
+func defaultedKafka(obj *Kafka) {
+	if obj.Topic == nil {
+		topic := DefaultKafkaTopic
+		obj.Topic = &topic
+	}
+
+	if obj.Acks == nil {
+		acks := DefaultKafkaAcks
+		obj.Acks = &acks
+	}
+
+	if obj.Compression == nil {
+		compression := DefaultKafkaCompression
+		obj.Compression = &compression
+	}
+
+	if obj.PartitionKey == nil {
+		partitionKey := DefaultKafkaPartitionKey
+		obj.PartitionKey = &partitionKey
+	}
+
+	if obj.BatchSize == nil {
+		batchSize := DefaultKafkaBatchSize
+		obj.BatchSize = &batchSize
+	}
+
+	if obj.BatchTimeoutMilliseconds == nil {
+		batchTimeout := DefaultKafkaBatchTimeoutMilliseconds
+		obj.BatchTimeoutMilliseconds = &batchTimeout
+	}
+
+	if obj.SASL != nil && obj.SASL.Mechanism == nil {
+		mechanism := DefaultKafkaSASLMechanism
+		obj.SASL.Mechanism = &mechanism
+	}
+}
+
+func defaultedHTTP(obj *HTTP) {
+	if obj.Method == nil {
+		method := DefaultHTTPMethod
+		obj.Method = &method
+	}
+
+	if obj.Gzip == nil {
+		gzip := DefaultHTTPGzip
+		obj.Gzip = &gzip
+	}
+
+	if obj.BatchSize == nil {
+		batchSize := DefaultHTTPBatchSize
+		obj.BatchSize = &batchSize
+	}
+
+	if obj.FlushIntervalMilliseconds == nil {
+		flushInterval := DefaultHTTPFlushIntervalMilliseconds
+		obj.FlushIntervalMilliseconds = &flushInterval
+	}
+
+	if obj.MaxRetries == nil {
+		maxRetries := DefaultHTTPMaxRetries
+		obj.MaxRetries = &maxRetries
+	}
+
+	if obj.TimeoutSeconds == nil {
+		timeout := DefaultHTTPTimeoutSeconds
+		obj.TimeoutSeconds = &timeout
+	}
+}
+
+func defaultedStatsd(obj *Statsd) {
+	if obj.Address == nil {
+		address := DefaultStatsdAddress
+		obj.Address = &address
+	}
+
+	if obj.Protocol == nil {
+		protocol := DefaultStatsdProtocol
+		obj.Protocol = &protocol
+	}
+
+	if obj.MTU == nil {
+		mtu := DefaultStatsdMTU
+		obj.MTU = &mtu
+	}
+
+	if obj.FlushIntervalMilliseconds == nil {
+		flushInterval := DefaultStatsdFlushIntervalMilliseconds
+		obj.FlushIntervalMilliseconds = &flushInterval
+	}
+}
+
+func defaultedRemoteWrite(obj *RemoteWrite) {
+	if obj.TenantHeader == nil {
+		tenantHeader := DefaultRemoteWriteTenantHeader
+		obj.TenantHeader = &tenantHeader
+	}
+
+	if obj.Shards == nil {
+		shards := DefaultRemoteWriteShards
+		obj.Shards = &shards
+	}
+
+	if obj.Capacity == nil {
+		capacity := DefaultRemoteWriteCapacity
+		obj.Capacity = &capacity
+	}
+
+	if obj.MaxSamplesPerSend == nil {
+		maxSamples := DefaultRemoteWriteMaxSamplesPerSend
+		obj.MaxSamplesPerSend = &maxSamples
+	}
+
+	if obj.BatchSendDeadlineMilliseconds == nil {
+		deadline := DefaultRemoteWriteBatchSendDeadlineMilliseconds
+		obj.BatchSendDeadlineMilliseconds = &deadline
+	}
+
+	if obj.MaxRetries == nil {
+		maxRetries := DefaultRemoteWriteMaxRetries
+		obj.MaxRetries = &maxRetries
+	}
+
+	if obj.TimeoutSeconds == nil {
+		timeout := DefaultRemoteWriteTimeoutSeconds
+		obj.TimeoutSeconds = &timeout
+	}
+}
+
+func defaultedOTLP(obj *OTLP) {
+	if obj.Endpoint == nil {
+		endpoint := DefaultOTLPEndpoint
+		obj.Endpoint = &endpoint
+	}
+
+	if obj.Protocol == nil {
+		protocol := DefaultOTLPProtocol
+		obj.Protocol = &protocol
+	}
+
+	if obj.Gzip == nil {
+		gzip := DefaultOTLPGzip
+		obj.Gzip = &gzip
+	}
+
+	if obj.BatchSize == nil {
+		batchSize := DefaultOTLPBatchSize
+		obj.BatchSize = &batchSize
+	}
+
+	if obj.FlushIntervalMilliseconds == nil {
+		flushInterval := DefaultOTLPFlushIntervalMilliseconds
+		obj.FlushIntervalMilliseconds = &flushInterval
+	}
+
+	if obj.MaxRetries == nil {
+		maxRetries := DefaultOTLPMaxRetries
+		obj.MaxRetries = &maxRetries
+	}
+
+	if obj.TimeoutSeconds == nil {
+		timeout := DefaultOTLPTimeoutSeconds
+		obj.TimeoutSeconds = &timeout
+	}
+}
+
+func defaultedFluent(obj *Fluent) {
+	if obj.Address == nil {
+		address := DefaultFluentAddress
+		obj.Address = &address
+	}
+
+	if obj.Tag == nil {
+		tag := DefaultFluentTag
+		obj.Tag = &tag
+	}
+
+	if obj.RequireAck == nil {
+		requireAck := DefaultFluentRequireAck
+		obj.RequireAck = &requireAck
+	}
+
+	if obj.BatchSize == nil {
+		batchSize := DefaultFluentBatchSize
+		obj.BatchSize = &batchSize
+	}
+
+	if obj.FlushIntervalMilliseconds == nil {
+		flushInterval := DefaultFluentFlushIntervalMilliseconds
+		obj.FlushIntervalMilliseconds = &flushInterval
+	}
+
+	if obj.MaxRetries == nil {
+		maxRetries := DefaultFluentMaxRetries
+		obj.MaxRetries = &maxRetries
+	}
+
+	if obj.TimeoutSeconds == nil {
+		timeout := DefaultFluentTimeoutSeconds
+		obj.TimeoutSeconds = &timeout
+	}
+}
+
 func defaultedCollectorFilters(obj *CollectorFilters) {
 	if obj.Exclude != nil {
 		defaultedCollectorExcludeFilter(obj.Exclude)
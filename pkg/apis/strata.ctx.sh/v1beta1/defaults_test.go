@@ -0,0 +1,74 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	"testing"
+)
+
+func TestDefaultedCollectorOutputs(t *testing.T) {
+	url := "http://localhost:8080"
+
+	tests := []struct {
+		name    string
+		output  *CollectorOutput
+		outputs []CollectorOutputConfig
+		kept    bool
+	}{
+		{
+			name: "stdout is not persisted",
+		},
+		{
+			name:    "defaulted stdout is dropped once outputs are added",
+			output:  &CollectorOutput{Stdout: &Stdout{}},
+			outputs: []CollectorOutputConfig{{Name: "http", CollectorOutput: CollectorOutput{HTTP: &HTTP{URL: &url}}}},
+		},
+		{
+			name:   "stdout is kept on its own",
+			output: &CollectorOutput{Stdout: &Stdout{}},
+			kept:   true,
+		},
+		{
+			name:    "configured output is kept",
+			output:  &CollectorOutput{HTTP: &HTTP{}},
+			outputs: []CollectorOutputConfig{{Name: "http", CollectorOutput: CollectorOutput{HTTP: &HTTP{}}}},
+			kept:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collector{
+				Spec: CollectorSpec{
+					Output:  tt.output,
+					Outputs: tt.outputs,
+				},
+			}
+			c.Default()
+
+			if kept := c.Spec.Output != nil; kept != tt.kept {
+				t.Errorf("expected output kept to be %v, got %v", tt.kept, kept)
+			}
+
+			// Adding outputs to a collector that only had the stdout output
+			// must pass validation.
+			if len(tt.outputs) > 0 && !tt.kept {
+				if warn, err := c.validate(); err != nil {
+					t.Errorf("unexpected validation error: %v %v", err, warn)
+				}
+			}
+		})
+	}
+}
@@ -108,11 +108,10 @@ type DiscoveryList struct {
 }
 
 // TLS represents the configurations needed to establish a TLS connection
-// to a scrape endpoint.  This will probably change a bit when I start working
-// on the collector and setting up the http client.  We should allow the service
-// to pull in certs from k8s as well, but this will allow mounting those secrets
-// into the pod.  TBH, I don't know how often this will be used since most scrape
-// endpoints that I've seen have not been encrypted.
+// to a scrape endpoint or an output.  Certificates can either be referenced by
+// a path to a file that has been mounted into the pod or pulled from a secret
+// in the same namespace as the collector.  If both are set, the secret will
+// take precedence.
 type TLS struct {
 	// +optional
 	// Path to the CA certificate
@@ -124,39 +123,520 @@ type TLS struct {
 	// Path to the private key
 	Key *string `json:"key,omitempty"`
 	// +optional
+	// CASecret is a reference to a secret key containing the CA certificate.
+	CASecret *corev1.SecretKeySelector `json:"caSecret,omitempty"`
+	// +optional
+	// CertSecret is a reference to a secret key containing the certificate.
+	CertSecret *corev1.SecretKeySelector `json:"certSecret,omitempty"`
+	// +optional
+	// KeySecret is a reference to a secret key containing the private key.
+	KeySecret *corev1.SecretKeySelector `json:"keySecret,omitempty"`
+	// +optional
+	// ServerName is used to verify the hostname on the returned certificates.
+	ServerName *string `json:"serverName,omitempty"`
+	// +optional
 	// InsecureSkipVerify enables/disables certificate verification between the collector and
 	// the scrape endpoint.
 	InsecureSkipVerify *bool `json:"inseccureSkipVerify,omitempty"`
 }
 
+// BasicAuth represents the credentials used for basic authentication.  The
+// values are pulled from secrets in the same namespace as the collector.
+type BasicAuth struct {
+	// +optional
+	// Username is a reference to a secret key containing the username.
+	Username *corev1.SecretKeySelector `json:"username,omitempty"`
+	// +optional
+	// Password is a reference to a secret key containing the password.
+	Password *corev1.SecretKeySelector `json:"password,omitempty"`
+}
+
+// OAuth2 represents the configuration for the OAuth2 client credentials flow.
+// The client id and secret are pulled from secrets in the same namespace as
+// the collector.
+type OAuth2 struct {
+	// TokenURL is the url of the token endpoint.
+	TokenURL *string `json:"tokenURL"`
+	// ClientID is a reference to a secret key containing the client id.
+	ClientID *corev1.SecretKeySelector `json:"clientID"`
+	// ClientSecret is a reference to a secret key containing the client
+	// secret.
+	ClientSecret *corev1.SecretKeySelector `json:"clientSecret"`
+	// +optional
+	// Scopes are the scopes requested for the token.
+	Scopes []string `json:"scopes,omitempty"`
+	// +optional
+	// EndpointParams are additional parameters sent to the token endpoint.
+	EndpointParams map[string]string `json:"endpointParams,omitempty"`
+}
+
+// ScrapeAuth represents the credentials used to authenticate with the scrape
+// targets.  Only one authentication method should be configured.
+type ScrapeAuth struct {
+	// +optional
+	// BearerToken is a reference to a secret key containing the bearer token.
+	BearerToken *corev1.SecretKeySelector `json:"bearerToken,omitempty"`
+	// +optional
+	// BearerTokenFile is the path to a file containing the bearer token, i.e.
+	// the service account token.  The file is read on every scrape so that
+	// rotated tokens are picked up.
+	BearerTokenFile *string `json:"bearerTokenFile,omitempty"`
+	// +optional
+	// Basic is the configuration for basic authentication.
+	Basic *BasicAuth `json:"basic,omitempty"`
+	// +optional
+	// OAuth2 is the configuration for the OAuth2 client credentials flow.
+	OAuth2 *OAuth2 `json:"oauth2,omitempty"`
+}
+
+// CollectorScrape represents the configuration used when scraping the
+// targets.  The TLS, authentication and limit settings can be overridden for
+// each target using annotations.
+//
+// Annotations can be set by anyone able to create or modify a pod or service,
+// which is usually a wider group than those able to read secrets.  Because of
+// this the annotations that reference secrets are only honored when
+// TargetSecrets is enabled, in which case anyone able to annotate a target can
+// have the collector send any secret in the namespace of the target to the
+// address of that target.
+type CollectorScrape struct {
+	// +optional
+	// TLS is the TLS configuration used for targets using the https scheme.
+	TLS *TLS `json:"tls,omitempty"`
+	// +optional
+	// Auth is the authentication used for all targets.
+	Auth *ScrapeAuth `json:"auth,omitempty"`
+	// +optional
+	// BodySizeLimitBytes is the maximum size of the uncompressed response
+	// body.  Scrapes with larger responses fail.  0 means no limit.
+	BodySizeLimitBytes *int64 `json:"bodySizeLimitBytes,omitempty"`
+	// +optional
+	// SampleLimit is the maximum number of samples accepted from a target
+	// after the filters have been applied.  Scrapes with more samples fail.
+	// 0 means no limit.
+	SampleLimit *int64 `json:"sampleLimit,omitempty"`
+	// +optional
+	// LabelLimit is the maximum number of labels, including the metric name,
+	// accepted for a sample.  Scrapes exceeding it fail.  0 means no limit.
+	LabelLimit *int64 `json:"labelLimit,omitempty"`
+	// +optional
+	// LabelNameLengthLimit is the maximum length of a label name.  Scrapes
+	// exceeding it fail.  0 means no limit.
+	LabelNameLengthLimit *int64 `json:"labelNameLengthLimit,omitempty"`
+	// +optional
+	// LabelValueLengthLimit is the maximum length of a label value.  Scrapes
+	// exceeding it fail.  0 means no limit.
+	LabelValueLengthLimit *int64 `json:"labelValueLengthLimit,omitempty"`
+	// +optional
+	// TargetSecrets enables the tls-secret, bearer-token-secret and
+	// basic-auth-secret target annotations.  Scrapes of targets using them
+	// fail when it is disabled.  Defaults to false.
+	TargetSecrets *bool `json:"targetSecrets,omitempty"`
+}
+
 // Stdout represents the configuration for the stdout data sink.
 type Stdout struct{}
 
+// NatsAuth represents the credentials used to authenticate with the nats
+// servers.  All values are pulled from secrets in the same namespace as the
+// collector.  Only one authentication method should be configured.
+type NatsAuth struct {
+	// +optional
+	// Username is a reference to a secret key containing the username.
+	Username *corev1.SecretKeySelector `json:"username,omitempty"`
+	// +optional
+	// Password is a reference to a secret key containing the password.
+	Password *corev1.SecretKeySelector `json:"password,omitempty"`
+	// +optional
+	// Token is a reference to a secret key containing the authentication token.
+	Token *corev1.SecretKeySelector `json:"token,omitempty"`
+	// +optional
+	// NKeySeed is a reference to a secret key containing the nkey seed.
+	NKeySeed *corev1.SecretKeySelector `json:"nkeySeed,omitempty"`
+	// +optional
+	// Credentials is a reference to a secret key containing the contents of
+	// a decorated user credentials file (JWT and nkey seed).
+	Credentials *corev1.SecretKeySelector `json:"credentials,omitempty"`
+}
+
 // Nats represents the configuration for the nats data sink.
 type Nats struct {
 	// +optional
-	// Port is the port that the nats server is listening on.
+	// Port is the port that the nats server is listening on.  It is only used
+	// when URL is set.
 	Port *int32 `json:"port,omitempty"`
 	// +optional
-	// Subject is the subject that the collector will publish to.
+	// Subject is the subject that the collector will publish to.  The subject
+	// is a go template that is rendered for every metric allowing metrics to be
+	// routed to different subjects, i.e. strata.{{ .Resource.Namespace }}.{{ .Metric.Name }}.
+	// Whitespace and wildcards in the rendered subject are replaced with
+	// underscores and metrics rendering an empty token are not sent.
 	Subject *string `json:"subject,omitempty"`
 	// +optional
 	// URL is the url of the nats server.
 	URL *string `json:"url,omitempty"`
+	// +optional
+	// Servers is a list of nats server urls that will be used to connect to
+	// the cluster.  If set, URL and Port are ignored.
+	Servers []string `json:"servers,omitempty"`
+	// +optional
+	// Auth is the authentication configuration for the nats servers.
+	Auth *NatsAuth `json:"auth,omitempty"`
+	// +optional
+	// TLS is the TLS configuration used when connecting to the nats servers.
+	TLS *TLS `json:"tls,omitempty"`
+	// +optional
+	// MaxReconnects is the maximum number of reconnect attempts before the
+	// connection is closed.  A negative value will retry forever.
+	MaxReconnects *int64 `json:"maxReconnects,omitempty"`
+	// +optional
+	// ReconnectWaitSeconds is the time to wait between reconnect attempts.
+	ReconnectWaitSeconds *int64 `json:"reconnectWaitSeconds,omitempty"`
+	// +optional
+	// ConnectTimeoutSeconds is the timeout for the initial connection.
+	ConnectTimeoutSeconds *int64 `json:"connectTimeoutSeconds,omitempty"`
+	// +optional
+	// DrainTimeoutSeconds is the time allowed for pending messages to be flushed
+	// when the output is closed.
+	DrainTimeoutSeconds *int64 `json:"drainTimeoutSeconds,omitempty"`
+}
+
+// KafkaSASL represents the SASL authentication configuration for the kafka
+// brokers.  Credentials are pulled from secrets in the same namespace as the
+// collector.
+type KafkaSASL struct {
+	// +optional
+	// +kubebuilder:validation:Enum=plain;scram-sha-256;scram-sha-512
+	// Mechanism is the SASL mechanism used to authenticate.
+	Mechanism *string `json:"mechanism,omitempty"`
+	// +optional
+	// Username is a reference to a secret key containing the username.
+	Username *corev1.SecretKeySelector `json:"username,omitempty"`
+	// +optional
+	// Password is a reference to a secret key containing the password.
+	Password *corev1.SecretKeySelector `json:"password,omitempty"`
+}
+
+// Kafka represents the configuration for the kafka data sink.
+type Kafka struct {
+	// +optional
+	// Brokers is the list of bootstrap brokers (host:port) for the cluster.
+	Brokers []string `json:"brokers,omitempty"`
+	// +optional
+	// Topic is the topic that the collector will produce to.
+	Topic *string `json:"topic,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum=none;leader;all
+	// Acks is the number of acknowledgements required from the brokers before
+	// a write is considered successful.
+	Acks *string `json:"acks,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum=none;gzip;snappy;lz4;zstd
+	// Compression is the compression codec used for message batches.
+	Compression *string `json:"compression,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum=none;name;series
+	// PartitionKey is the strategy used to generate the message key which is used
+	// to assign messages to partitions.  Using "name" will send all metrics with the
+	// same name to the same partition, "series" uses a hash of the name and tags so
+	// ordering is preserved per series, and "none" will distribute the messages
+	// across all partitions.
+	PartitionKey *string `json:"partitionKey,omitempty"`
+	// +optional
+	// BatchSize is the maximum number of messages in a batch.
+	BatchSize *int64 `json:"batchSize,omitempty"`
+	// +optional
+	// BatchTimeoutMilliseconds is the maximum time a partial batch is held
+	// before it is written.
+	BatchTimeoutMilliseconds *int64 `json:"batchTimeoutMilliseconds,omitempty"`
+	// +optional
+	// SASL is the SASL authentication configuration for the brokers.
+	SASL *KafkaSASL `json:"sasl,omitempty"`
+	// +optional
+	// TLS is the TLS configuration used when connecting to the brokers.
+	TLS *TLS `json:"tls,omitempty"`
+}
+
+// HTTPHeader represents a header that will be added to every request.  The
+// value can either be set directly or pulled from a secret in the same
+// namespace as the collector.
+type HTTPHeader struct {
+	// +required
+	// Name is the name of the header.
+	Name string `json:"name"`
+	// +optional
+	// Value is the value of the header.
+	Value *string `json:"value,omitempty"`
+	// +optional
+	// ValueFrom is a reference to a secret key containing the value of the
+	// header.  If set, it takes precedence over Value.
+	ValueFrom *corev1.SecretKeySelector `json:"valueFrom,omitempty"`
+}
+
+// HTTP represents the configuration for the http data sink.
+type HTTP struct {
+	// +optional
+	// URL is the endpoint that batches of metrics will be sent to.
+	URL *string `json:"url,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum=POST;PUT
+	// Method is the http method used for the requests.
+	Method *string `json:"method,omitempty"`
+	// +optional
+	// Headers is a list of headers that will be added to every request.
+	Headers []HTTPHeader `json:"headers,omitempty"`
+	// +optional
+	// Gzip enables gzip compression of the request body.
+	Gzip *bool `json:"gzip,omitempty"`
+	// +optional
+	// BatchSize is the maximum number of metrics sent in a single request.
+	BatchSize *int64 `json:"batchSize,omitempty"`
+	// +optional
+	// FlushIntervalMilliseconds is the maximum time a partial batch is held
+	// before it is sent.
+	FlushIntervalMilliseconds *int64 `json:"flushIntervalMilliseconds,omitempty"`
+	// +optional
+	// MaxRetries is the number of times a failed request will be retried.  Only
+	// connection errors, 429, and 5xx responses are retried.
+	MaxRetries *int64 `json:"maxRetries,omitempty"`
+	// +optional
+	// TimeoutSeconds is the timeout for a single request.
+	TimeoutSeconds *int64 `json:"timeoutSeconds,omitempty"`
+	// +optional
+	// TLS is the TLS configuration used when connecting to the endpoint.
+	TLS *TLS `json:"tls,omitempty"`
+}
+
+// Statsd represents the configuration for the statsd data sink.  The statsd
+// or dogstatsd encoder should be used with this output.
+type Statsd struct {
+	// +optional
+	// Address is the host:port of the statsd server.
+	Address *string `json:"address,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum=udp;tcp
+	// Protocol is the protocol used to send metrics to the server.
+	Protocol *string `json:"protocol,omitempty"`
+	// +optional
+	// MTU is the maximum size of a udp datagram.  Multiple lines will be packed
+	// into a single datagram up to this size.
+	MTU *int64 `json:"mtu,omitempty"`
+	// +optional
+	// FlushIntervalMilliseconds is the maximum time that lines are buffered
+	// before they are sent.
+	FlushIntervalMilliseconds *int64 `json:"flushIntervalMilliseconds,omitempty"`
+}
+
+// RemoteWrite represents the configuration for the prometheus remote write
+// data sink.
+type RemoteWrite struct {
+	// +optional
+	// URL is the remote write endpoint.
+	URL *string `json:"url,omitempty"`
+	// +optional
+	// Headers is a list of headers that will be added to every request.
+	Headers []HTTPHeader `json:"headers,omitempty"`
+	// +optional
+	// TenantHeader is the header used to pass the tenant to the endpoint.  Set
+	// to an empty string to disable the header.
+	TenantHeader *string `json:"tenantHeader,omitempty"`
+	// +optional
+	// Tenant is a static tenant that will be used for all metrics.  If not set
+	// the namespace of the resource the metrics were collected from is used.
+	Tenant *string `json:"tenant,omitempty"`
+	// +optional
+	// Shards is the number of concurrent senders.
+	Shards *int64 `json:"shards,omitempty"`
+	// +optional
+	// Capacity is the number of samples that are queued per shard before
+	// sending blocks.
+	Capacity *int64 `json:"capacity,omitempty"`
+	// +optional
+	// MaxSamplesPerSend is the maximum number of samples in a single request.
+	MaxSamplesPerSend *int64 `json:"maxSamplesPerSend,omitempty"`
+	// +optional
+	// BatchSendDeadlineMilliseconds is the maximum time a partial batch is held
+	// before it is sent.
+	BatchSendDeadlineMilliseconds *int64 `json:"batchSendDeadlineMilliseconds,omitempty"`
+	// +optional
+	// MaxRetries is the number of times a recoverable failure will be retried.
+	MaxRetries *int64 `json:"maxRetries,omitempty"`
+	// +optional
+	// TimeoutSeconds is the timeout for a single request.
+	TimeoutSeconds *int64 `json:"timeoutSeconds,omitempty"`
+	// +optional
+	// TLS is the TLS configuration used when connecting to the endpoint.
+	TLS *TLS `json:"tls,omitempty"`
+}
+
+// OTLP represents the configuration for the OpenTelemetry OTLP data sink.
+type OTLP struct {
+	// +optional
+	// Endpoint is the host:port of the gRPC receiver or the full url of the
+	// http receiver, i.e. https://otel-collector:4318/v1/metrics.
+	Endpoint *string `json:"endpoint,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum=grpc;http
+	// Protocol is the transport used to export the metrics.
+	Protocol *string `json:"protocol,omitempty"`
+	// +optional
+	// Headers is a list of headers (gRPC metadata) that will be added to
+	// every request.
+	Headers []HTTPHeader `json:"headers,omitempty"`
+	// +optional
+	// Gzip enables gzip compression of the requests.
+	Gzip *bool `json:"gzip,omitempty"`
+	// +optional
+	// BatchSize is the maximum number of metrics sent in a single request.
+	BatchSize *int64 `json:"batchSize,omitempty"`
+	// +optional
+	// FlushIntervalMilliseconds is the maximum time a partial batch is held
+	// before it is sent.
+	FlushIntervalMilliseconds *int64 `json:"flushIntervalMilliseconds,omitempty"`
+	// +optional
+	// MaxRetries is the number of times a recoverable failure will be retried.
+	MaxRetries *int64 `json:"maxRetries,omitempty"`
+	// +optional
+	// TimeoutSeconds is the timeout for a single request.
+	TimeoutSeconds *int64 `json:"timeoutSeconds,omitempty"`
+	// +optional
+	// TLS is the TLS configuration used when connecting to the endpoint.  If
+	// not set, gRPC connections will be insecure.
+	TLS *TLS `json:"tls,omitempty"`
+}
+
+// Fluent represents the configuration for the fluent forward data sink.  The
+// fluentbit encoder must be used with this output.
+type Fluent struct {
+	// +optional
+	// Address is the host:port of the fluent bit or fluentd forward input.
+	Address *string `json:"address,omitempty"`
+	// +optional
+	// Tag is the tag that entries are sent with.  The tag can be templated
+	// using the message, i.e. strata.{{.Resource.Namespace}}.{{.Metric.Name}}.
+	Tag *string `json:"tag,omitempty"`
+	// +optional
+	// RequireAck enables at-least-once delivery by requiring the server to
+	// acknowledge each message.
+	RequireAck *bool `json:"requireAck,omitempty"`
+	// +optional
+	// BatchSize is the maximum number of entries that are held before they
+	// are sent.
+	BatchSize *int64 `json:"batchSize,omitempty"`
+	// +optional
+	// FlushIntervalMilliseconds is the maximum time a partial batch is held
+	// before it is sent.
+	FlushIntervalMilliseconds *int64 `json:"flushIntervalMilliseconds,omitempty"`
+	// +optional
+	// MaxRetries is the number of times a failed message will be retried.
+	MaxRetries *int64 `json:"maxRetries,omitempty"`
+	// +optional
+	// TimeoutSeconds is the timeout for connecting, writing and waiting for
+	// acknowledgements.
+	TimeoutSeconds *int64 `json:"timeoutSeconds,omitempty"`
+	// +optional
+	// TLS is the TLS configuration used when connecting to the server.
+	TLS *TLS `json:"tls,omitempty"`
 }
 
 // CollectorOutput represents the configuration for the data sink that will
-// receive the collected metrics.  Currently only supports a single output,
-// but in the future we will consider supporting multiple outputs.
+// receive the collected metrics.  Exactly one data sink must be configured.
 type CollectorOutput struct {
 	// +optional
 	// Nats is the configuration for the nats data sink.
 	Nats *Nats `json:"nats,omitempty"`
 	// +optional
+	// Kafka is the configuration for the kafka data sink.
+	Kafka *Kafka `json:"kafka,omitempty"`
+	// +optional
+	// HTTP is the configuration for the http data sink.
+	HTTP *HTTP `json:"http,omitempty"`
+	// +optional
+	// Statsd is the configuration for the statsd data sink.
+	Statsd *Statsd `json:"statsd,omitempty"`
+	// +optional
+	// RemoteWrite is the configuration for the prometheus remote write data sink.
+	RemoteWrite *RemoteWrite `json:"remoteWrite,omitempty"`
+	// +optional
+	// OTLP is the configuration for the OpenTelemetry OTLP data sink.
+	OTLP *OTLP `json:"otlp,omitempty"`
+	// +optional
+	// Fluent is the configuration for the fluent forward data sink.
+	Fluent *Fluent `json:"fluent,omitempty"`
+	// +optional
 	// Stdout is the configuration for the stdout data sink.
 	Stdout *Stdout `json:"stdout,omitempty"`
 }
 
+// CollectorOutputConfig represents one of the outputs that the collector
+// fans the collected metrics out to.  Each output has its own queue, encoder
+// and filters so a slow output does not hold up the others.
+type CollectorOutputConfig struct {
+	// Name is the unique name of the output within the collector.  It is
+	// used to report the status of the output.
+	Name string `json:"name"`
+	// +optional
+	// +kubebuilder:validation:Enum=json;statsd;dogstatsd;fluentbit
+	// Encoder is the encoding that will be used for this output.  If not
+	// set, then the collector encoder will be used.
+	Encoder *string `json:"encoder,omitempty"`
+	// +optional
+	// Filters are applied after the collector filters and only affect the
+	// metrics sent to this output.
+	Filters *CollectorFilters `json:"filters,omitempty"`
+	// +optional
+	// BufferSize is the number of collected batches that can be queued for
+	// the output.  When the queue is full, new batches are dropped.
+	BufferSize *int64 `json:"bufferSize,omitempty"`
+	// +optional
+	// BatchSize is the maximum number of metrics collected from a resource
+	// that are encoded and sent as a single payload when both the encoder
+	// and the output support batches.  Batches are sent as a JSON array by
+	// the json encoder.  A batch size of 1 disables batching.
+	BatchSize *int64 `json:"batchSize,omitempty"`
+	// +optional
+	// FlushIntervalMilliseconds is the maximum time a partial batch is held
+	// while waiting for more metrics from the same resource.
+	FlushIntervalMilliseconds *int64 `json:"flushIntervalMilliseconds,omitempty"`
+	// +optional
+	// IncludeMetricMetadata determines whether the HELP and UNIT of the metric
+	// family are included when the metrics are encoded.  If not set, then the
+	// collector setting will be used.
+	IncludeMetricMetadata *bool `json:"includeMetricMetadata,omitempty"`
+	// +optional
+	// IncludeExemplars determines whether the exemplars attached to counters
+	// and histogram buckets are included when the metrics are encoded.  If
+	// not set, then the collector setting will be used.
+	IncludeExemplars *bool `json:"includeExemplars,omitempty"`
+	// CollectorOutput is the configuration of the data sink.
+	CollectorOutput `json:",inline"`
+}
+
+// CollectorOutputBuffer represents the configuration for the persistent buffer
+// that holds metrics that failed to be sent to an output until the output
+// recovers and they can be replayed.
+type CollectorOutputBuffer struct {
+	// +optional
+	// Path is the directory that the buffer segment files are written to.
+	// This should be a mounted persistent volume.  Each output uses its own
+	// subdirectory.
+	Path *string `json:"path,omitempty"`
+	// +optional
+	// MaxSizeBytes is the maximum size of the buffer for each output.  The
+	// oldest segments are removed when the size is exceeded.
+	MaxSizeBytes *int64 `json:"maxSizeBytes,omitempty"`
+	// +optional
+	// MaxSegmentSizeBytes is the size at which a new segment file is started.
+	MaxSegmentSizeBytes *int64 `json:"maxSegmentSizeBytes,omitempty"`
+	// +optional
+	// MaxAgeSeconds is the maximum age of a segment before it is removed.
+	MaxAgeSeconds *int64 `json:"maxAgeSeconds,omitempty"`
+	// +optional
+	// ReplayIntervalSeconds is the interval that buffered metrics are
+	// replayed to the output.
+	ReplayIntervalSeconds *int64 `json:"replayIntervalSeconds,omitempty"`
+}
+
 // CollectorClipFilter represents the configuration for the clip filter.
 type CollectorClipFilter struct {
 	// +optional
@@ -200,9 +680,12 @@ type CollectorSpec struct {
 	// will be used.
 	BufferSize *int64 `json:"bufferSize"`
 	// +optional
+	// +kubebuilder:validation:Enum=json;statsd;dogstatsd;fluentbit
 	// Encoder is the encoding that will be used to encode the metrics
 	// that are sent to the data sink.  If not set, then the default
-	// encoding will be used.
+	// encoding will be used.  The statsd and dogstatsd encoders should
+	// be paired with the statsd output and the fluentbit encoder with
+	// the fluent output.
 	Encoder *string `json:"encoder"`
 	// +optional
 	// Enabled is a flag to enable or disable the collector pool.
@@ -227,17 +710,97 @@ type CollectorSpec struct {
 	// resource kind, and resource version will be added as tags.
 	IncludeMetadata *bool `json:"includeMetadata"`
 	// +optional
+	// IncludeMetricMetadata determines whether the HELP and UNIT of the metric
+	// family are included when the metrics are encoded.  The json and
+	// fluentbit encoders and the otlp output support metadata.  By default
+	// the metadata will not be included.
+	IncludeMetricMetadata *bool `json:"includeMetricMetadata,omitempty"`
+	// +optional
+	// IncludeExemplars determines whether the exemplars attached to counters
+	// and histogram buckets are included when the metrics are encoded.  The
+	// json and fluentbit encoders and the otlp and remoteWrite outputs support
+	// exemplars.  By default exemplars will not be included.
+	IncludeExemplars *bool `json:"includeExemplars,omitempty"`
+	// +optional
+	// HonorTimestamps determines whether the timestamps exposed by the target
+	// are used for the samples.  By default the time of the scrape is used
+	// for all samples.
+	HonorTimestamps *bool `json:"honorTimestamps,omitempty"`
+	// +optional
+	// MaxResourceAgeSeconds is the maximum time that a discovered resource
+	// can wait to be collected.  Resources that have waited longer are dropped
+	// and counted as expired.  A value of 0, the default, disables the check.
+	MaxResourceAgeSeconds *int64 `json:"maxResourceAgeSeconds,omitempty"`
+	// +optional
+	// Scrape is the configuration used when scraping the targets.
+	Scrape *CollectorScrape `json:"scrape,omitempty"`
+	// +optional
 	// Workers is the number of workers in the collection pool that will
 	// be used to collect metrics.
 	Workers *int64 `json:"workers"`
 	// +optional
+	// FlattenHistograms determines whether histograms and summaries are sent
+	// as the individual bucket, quantile, sum and count series.  If set to
+	// false, a single metric with a structured value holding the buckets or
+	// quantiles, the sum and the count is sent instead.  Outputs that cannot
+	// represent the structured value will flatten it before sending.  Native
+	// histograms are always sent with a structured value.  By default
+	// histograms and summaries are flattened.
+	FlattenHistograms *bool `json:"flattenHistograms,omitempty"`
+	// +optional
 	// CollectorOutput is the configuration for the data sink that will
-	// receive the collected metrics.
-	Output *CollectorOutput `json:"output"`
+	// receive the collected metrics.  It is mutually exclusive with Outputs
+	// and is treated as a single output named default.  If neither is set,
+	// the metrics are written to stdout.
+	Output *CollectorOutput `json:"output,omitempty"`
+	// +optional
+	// Outputs is a list of data sinks that will each receive the collected
+	// metrics.
+	Outputs []CollectorOutputConfig `json:"outputs,omitempty"`
 	// +optional
 	// Filters is a list of filters that will be used to filter the metrics
 	// prior to sending them to the data output.
 	Filters *CollectorFilters `json:"filters"`
+	// +optional
+	// OutputBuffer enables a persistent buffer for each output.  Metrics that
+	// fail to be sent are written to the buffer and replayed once the output
+	// recovers.  If not set, metrics that fail to be sent are dropped.
+	OutputBuffer *CollectorOutputBuffer `json:"outputBuffer,omitempty"`
+}
+
+// CollectorOutputStatus represents the status of a single output.
+type CollectorOutputStatus struct {
+	// Name is the name of the output.
+	Name string `json:"name"`
+	// TotalSent is the number of metrics that have been sent to the output
+	// successfully.
+	TotalSent int64 `json:"totalSent"`
+	// TotalErrors is the number of metrics that have failed to be encoded or
+	// sent to the output.
+	TotalErrors int64 `json:"totalErrors"`
+	// TotalFiltered is the number of metrics that have been filtered out by
+	// the output filters.
+	TotalFiltered int64 `json:"totalFiltered"`
+	// TotalDropped is the number of metrics that have been dropped because
+	// the output queue or buffer was full.
+	TotalDropped int64 `json:"totalDropped"`
+	// TotalBuffered is the number of metrics that have been written to the
+	// output buffer after failing to be sent.
+	TotalBuffered int64 `json:"totalBuffered"`
+	// TotalReplayed is the number of buffered metrics that have been replayed
+	// to the output.
+	TotalReplayed int64 `json:"totalReplayed"`
+}
+
+// CollectorTargetStatus represents the status of a single scrape target.
+type CollectorTargetStatus struct {
+	// URL is the scrape url of the target.
+	URL string `json:"url"`
+	// Format is the exposition format that was returned by the target.  It
+	// is one of text, openmetrics or protobuf.
+	Format string `json:"format"`
+	// LastScrape is the last time that the target was scraped.
+	LastScrape metav1.Time `json:"lastScrape"`
 }
 
 // CollectorStatus represents the status of a collector pool.
@@ -267,6 +830,22 @@ type CollectorStatus struct {
 	TotalFiltered int64 `json:"totalFiltered"`
 	// MetricsCollected is the number of metrics collected by the collector.
 	MetricsCollected int64 `json:"metricsCollected"`
+	// TotalExpired is the number of resources that were dropped because they
+	// waited longer than the maximum resource age before being collected.
+	TotalExpired int64 `json:"totalExpired"`
+	// TotalLimitExceeded is the number of scrapes that failed because they
+	// exceeded one of the scrape limits.
+	TotalLimitExceeded int64 `json:"totalLimitExceeded"`
+	// +optional
+	// Outputs is the status of each of the outputs.
+	Outputs []CollectorOutputStatus `json:"outputs,omitempty"`
+	// +optional
+	// TotalTargets is the number of targets that have been scraped recently.
+	TotalTargets int64 `json:"totalTargets,omitempty"`
+	// +optional
+	// Targets is the status of the targets that have been scraped recently.
+	// Only the first targets sorted by url are listed for large collectors.
+	Targets []CollectorTargetStatus `json:"targets,omitempty"`
 }
 
 // +genclient
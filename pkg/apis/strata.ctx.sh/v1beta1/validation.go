@@ -2,6 +2,7 @@ package v1beta1
 
 import (
 	"fmt"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -63,9 +64,352 @@ func (c *Collector) validate() (admission.Warnings, error) {
 		warn = append(warn, "Workers must be greater than or equal to 0")
 	}
 
+	if c.Spec.MaxResourceAgeSeconds != nil && *c.Spec.MaxResourceAgeSeconds < 0 {
+		warn = append(warn, "MaxResourceAgeSeconds must be greater than or equal to 0")
+	}
+
+	if c.Spec.Output != nil {
+		warn = append(warn, c.Spec.Output.validate(c.Spec.Encoder)...)
+
+		if len(c.Spec.Outputs) > 0 {
+			warn = append(warn, "Output and Outputs are mutually exclusive")
+		}
+	}
+
+	names := make(map[string]struct{}, len(c.Spec.Outputs))
+	for _, o := range c.Spec.Outputs {
+		if o.Name == "" {
+			warn = append(warn, "Output name must be set")
+		}
+
+		if _, ok := names[o.Name]; ok {
+			warn = append(warn, fmt.Sprintf("Output name %s must be unique", o.Name))
+		}
+		names[o.Name] = struct{}{}
+
+		if o.BufferSize != nil && *o.BufferSize < 1 {
+			warn = append(warn, "Output bufferSize must be greater than 0")
+		}
+
+		if o.BatchSize != nil && *o.BatchSize < 1 {
+			warn = append(warn, "Output batchSize must be greater than 0")
+		}
+
+		if o.FlushIntervalMilliseconds != nil && *o.FlushIntervalMilliseconds < 1 {
+			warn = append(warn, "Output flushIntervalMilliseconds must be greater than 0")
+		}
+
+		// Batches are published to a single subject so the subject can't be
+		// rendered from the individual metrics.
+		batched := o.BatchSize != nil && *o.BatchSize > 1
+		if batched && o.Nats != nil && o.Nats.Subject != nil && strings.Contains(*o.Nats.Subject, ".Metric") {
+			warn = append(warn, "Nats subject must not refer to the metric when batching is enabled")
+		}
+
+		encoder := c.Spec.Encoder
+		if o.Encoder != nil {
+			encoder = o.Encoder
+		}
+		warn = append(warn, o.CollectorOutput.validate(encoder)...)
+	}
+
+	if c.Spec.OutputBuffer != nil {
+		warn = append(warn, c.Spec.OutputBuffer.validate()...)
+	}
+
+	if c.Spec.Scrape != nil {
+		warn = append(warn, c.Spec.Scrape.validate()...)
+	}
+
 	if len(warn) > 0 {
 		return warn, fmt.Errorf("invalid collector")
 	}
 
 	return nil, nil
 }
+
+func (s *CollectorScrape) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	limits := []struct {
+		name  string
+		value *int64
+	}{
+		{"bodySizeLimitBytes", s.BodySizeLimitBytes},
+		{"sampleLimit", s.SampleLimit},
+		{"labelLimit", s.LabelLimit},
+		{"labelNameLengthLimit", s.LabelNameLengthLimit},
+		{"labelValueLengthLimit", s.LabelValueLengthLimit},
+	}
+	for _, l := range limits {
+		if l.value != nil && *l.value < 0 {
+			warn = append(warn, fmt.Sprintf("Scrape %s must not be negative", l.name))
+		}
+	}
+
+	if s.Auth != nil {
+		warn = append(warn, s.Auth.validate()...)
+	}
+
+	return warn
+}
+
+func (a *ScrapeAuth) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	methods := 0
+	if a.BearerToken != nil {
+		methods++
+	}
+	if a.BearerTokenFile != nil {
+		methods++
+	}
+	if a.Basic != nil {
+		methods++
+	}
+	if a.OAuth2 != nil {
+		methods++
+	}
+
+	if methods > 1 {
+		warn = append(warn, "Only one scrape auth method can be configured")
+	}
+
+	if a.Basic != nil && a.Basic.Username == nil {
+		warn = append(warn, "Scrape basic auth requires a username")
+	}
+
+	if a.OAuth2 != nil {
+		if a.OAuth2.TokenURL == nil || *a.OAuth2.TokenURL == "" {
+			warn = append(warn, "Scrape oauth2 tokenURL must be set")
+		}
+
+		if a.OAuth2.ClientID == nil || a.OAuth2.ClientSecret == nil {
+			warn = append(warn, "Scrape oauth2 clientID and clientSecret must be set")
+		}
+	}
+
+	return warn
+}
+
+func (b *CollectorOutputBuffer) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	if b.Path != nil && *b.Path == "" {
+		warn = append(warn, "OutputBuffer path must not be empty")
+	}
+
+	if b.MaxSegmentSizeBytes != nil && *b.MaxSegmentSizeBytes < 1 {
+		warn = append(warn, "OutputBuffer maxSegmentSizeBytes must be greater than 0")
+	}
+
+	if b.MaxSizeBytes != nil && b.MaxSegmentSizeBytes != nil && *b.MaxSizeBytes < *b.MaxSegmentSizeBytes {
+		warn = append(warn, "OutputBuffer maxSizeBytes must be greater than or equal to maxSegmentSizeBytes")
+	}
+
+	if b.MaxAgeSeconds != nil && *b.MaxAgeSeconds < 1 {
+		warn = append(warn, "OutputBuffer maxAgeSeconds must be greater than 0")
+	}
+
+	if b.ReplayIntervalSeconds != nil && *b.ReplayIntervalSeconds < 1 {
+		warn = append(warn, "OutputBuffer replayIntervalSeconds must be greater than 0")
+	}
+
+	return warn
+}
+
+func (o *CollectorOutput) validate(encoder *string) admission.Warnings {
+	warn := make(admission.Warnings, 0)
+	configured := 0
+
+	if o.Nats != nil {
+		configured++
+		warn = append(warn, o.Nats.validate()...)
+	}
+
+	if o.Kafka != nil {
+		configured++
+		warn = append(warn, o.Kafka.validate()...)
+	}
+
+	if o.HTTP != nil {
+		configured++
+		warn = append(warn, o.HTTP.validate()...)
+	}
+
+	if o.Statsd != nil {
+		configured++
+		warn = append(warn, o.Statsd.validate()...)
+	}
+
+	if o.RemoteWrite != nil {
+		configured++
+		warn = append(warn, o.RemoteWrite.validate()...)
+	}
+
+	if o.OTLP != nil {
+		configured++
+		warn = append(warn, o.OTLP.validate()...)
+	}
+
+	if o.Fluent != nil {
+		configured++
+		warn = append(warn, o.Fluent.validate()...)
+
+		if encoder != nil && *encoder != "fluentbit" {
+			warn = append(warn, "Fluent output requires the fluentbit encoder")
+		}
+	}
+
+	if o.Stdout != nil {
+		configured++
+	}
+
+	if configured != 1 {
+		warn = append(warn, "Exactly one data sink must be configured per output")
+	}
+
+	return warn
+}
+
+func (n *Nats) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	if n.Subject != nil && *n.Subject == "" {
+		warn = append(warn, "Nats subject must not be empty")
+	}
+
+	if n.ReconnectWaitSeconds != nil && *n.ReconnectWaitSeconds < 0 {
+		warn = append(warn, "Nats reconnectWaitSeconds must be greater than or equal to 0")
+	}
+
+	if n.Auth != nil {
+		if n.Auth.Password != nil && n.Auth.Username == nil {
+			warn = append(warn, "Nats auth password requires a username")
+		}
+	}
+
+	return warn
+}
+
+func (k *Kafka) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	if len(k.Brokers) == 0 {
+		warn = append(warn, "Kafka brokers must be set")
+	}
+
+	if k.Topic != nil && *k.Topic == "" {
+		warn = append(warn, "Kafka topic must not be empty")
+	}
+
+	if k.BatchSize != nil && *k.BatchSize < 1 {
+		warn = append(warn, "Kafka batchSize must be greater than 0")
+	}
+
+	if k.SASL != nil && (k.SASL.Username == nil || k.SASL.Password == nil) {
+		warn = append(warn, "Kafka SASL requires both a username and password")
+	}
+
+	return warn
+}
+
+func (h *HTTP) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	if h.URL == nil || *h.URL == "" {
+		warn = append(warn, "HTTP url must be set")
+	}
+
+	if h.BatchSize != nil && *h.BatchSize < 1 {
+		warn = append(warn, "HTTP batchSize must be greater than 0")
+	}
+
+	if h.FlushIntervalMilliseconds != nil && *h.FlushIntervalMilliseconds < 1 {
+		warn = append(warn, "HTTP flushIntervalMilliseconds must be greater than 0")
+	}
+
+	for _, header := range h.Headers {
+		if header.Name == "" {
+			warn = append(warn, "HTTP header name must be set")
+		}
+	}
+
+	return warn
+}
+
+func (s *Statsd) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	if s.MTU != nil && *s.MTU < 512 {
+		warn = append(warn, "Statsd mtu must be greater than or equal to 512")
+	}
+
+	if s.FlushIntervalMilliseconds != nil && *s.FlushIntervalMilliseconds < 1 {
+		warn = append(warn, "Statsd flushIntervalMilliseconds must be greater than 0")
+	}
+
+	return warn
+}
+
+func (r *RemoteWrite) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	if r.URL == nil || *r.URL == "" {
+		warn = append(warn, "RemoteWrite url must be set")
+	}
+
+	if r.Shards != nil && *r.Shards < 1 {
+		warn = append(warn, "RemoteWrite shards must be greater than 0")
+	}
+
+	if r.MaxSamplesPerSend != nil && *r.MaxSamplesPerSend < 1 {
+		warn = append(warn, "RemoteWrite maxSamplesPerSend must be greater than 0")
+	}
+
+	if r.BatchSendDeadlineMilliseconds != nil && *r.BatchSendDeadlineMilliseconds < 1 {
+		warn = append(warn, "RemoteWrite batchSendDeadlineMilliseconds must be greater than 0")
+	}
+
+	return warn
+}
+
+func (o *OTLP) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	if o.Endpoint != nil && *o.Endpoint == "" {
+		warn = append(warn, "OTLP endpoint must not be empty")
+	}
+
+	if o.BatchSize != nil && *o.BatchSize < 1 {
+		warn = append(warn, "OTLP batchSize must be greater than 0")
+	}
+
+	if o.FlushIntervalMilliseconds != nil && *o.FlushIntervalMilliseconds < 1 {
+		warn = append(warn, "OTLP flushIntervalMilliseconds must be greater than 0")
+	}
+
+	return warn
+}
+
+func (f *Fluent) validate() admission.Warnings {
+	warn := make(admission.Warnings, 0)
+
+	if f.Address != nil && *f.Address == "" {
+		warn = append(warn, "Fluent address must not be empty")
+	}
+
+	if f.Tag != nil && *f.Tag == "" {
+		warn = append(warn, "Fluent tag must not be empty")
+	}
+
+	if f.BatchSize != nil && *f.BatchSize < 1 {
+		warn = append(warn, "Fluent batchSize must be greater than 0")
+	}
+
+	if f.FlushIntervalMilliseconds != nil && *f.FlushIntervalMilliseconds < 1 {
+		warn = append(warn, "Fluent flushIntervalMilliseconds must be greater than 0")
+	}
+
+	return warn
+}
@@ -0,0 +1,456 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// segmentExt is the file extension used for segment files.
+	segmentExt string = ".wal"
+	// headerSize is the size of the record header which holds the length of
+	// the payload and its checksum.
+	headerSize int64 = 8
+	// maxRecordSize guards against allocating huge buffers when the length
+	// in a corrupt header is read.
+	maxRecordSize int64 = 256 << 20
+)
+
+var (
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	// ErrCorrupt is returned when a record fails the checksum or is truncated.
+	ErrCorrupt = errors.New("corrupt record")
+)
+
+// Config represents the configuration for the buffer.
+type Config struct {
+	// Dir is the directory that segment files are written to.
+	Dir string
+	// MaxSize is the maximum size of all segments.  The oldest segments are
+	// removed when the size is exceeded.
+	MaxSize int64
+	// MaxSegmentSize is the size at which a new segment is started.
+	MaxSegmentSize int64
+	// MaxAge is the maximum time since a segment was last written before it
+	// is removed.
+	MaxAge time.Duration
+	// Logger is used to report corrupt segments.
+	Logger logr.Logger
+}
+
+// segment represents a single segment file.
+type segment struct {
+	seq     uint64
+	path    string
+	size    int64
+	records int64
+	modTime time.Time
+}
+
+// Buffer is a persistent first-in-first-out buffer made up of append only
+// segment files.  Records are appended to the newest segment and replayed
+// from the oldest.  Segments are removed once all of their records have been
+// replayed, or when they exceed the size or age limits.
+//
+// The replay position is only held in memory, so records that were replayed
+// but whose segment was not yet removed will be replayed again after a
+// restart.
+type Buffer struct {
+	config   Config
+	segments []*segment
+	writer   *os.File
+	reader   *os.File
+	offset   int64
+	size     int64
+	sync.Mutex
+}
+
+// Open opens the buffer in the configured directory, recovering any existing
+// segments.  Corrupt segments are truncated at the first bad record.
+func Open(config Config) (*Buffer, error) {
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	b := &Buffer{
+		config:   config,
+		segments: make([]*segment, 0),
+	}
+
+	if err := b.recover(); err != nil {
+		return nil, err
+	}
+
+	if err := b.rotate(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Write appends the record to the buffer.  The number of records that were
+// dropped to keep the buffer under the maximum size is returned.
+func (b *Buffer) Write(p []byte) (int64, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	active := b.segments[len(b.segments)-1]
+	if active.size >= b.config.MaxSegmentSize {
+		if err := b.rotate(); err != nil {
+			return 0, err
+		}
+		active = b.segments[len(b.segments)-1]
+	}
+
+	buf := make([]byte, headerSize+int64(len(p)))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(p)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(p, castagnoli))
+	copy(buf[headerSize:], p)
+
+	n, err := b.writer.Write(buf)
+	active.size += int64(n)
+	b.size += int64(n)
+	if err != nil {
+		// Start a new segment so the partial record is not followed by valid
+		// records which would be skipped during replay.
+		_ = b.rotate()
+		return 0, err
+	}
+	active.records++
+	active.modTime = time.Now()
+
+	// Records are only written when an output fails, so syncing each one is
+	// cheap compared to losing it on a crash.
+	if err := b.writer.Sync(); err != nil {
+		return 0, err
+	}
+
+	var dropped int64
+	for b.size > b.config.MaxSize && len(b.segments) > 1 {
+		dropped += b.dropOldest()
+	}
+
+	return dropped, nil
+}
+
+// Replay calls fn with each buffered record starting with the oldest.  Records
+// are removed from the buffer once fn succeeds.  Replay stops at the first
+// error returned by fn, which will be retried on the next replay, or when the
+// stop channel is closed.  The number of records replayed and the number
+// dropped due to corruption are returned.
+func (b *Buffer) Replay(stop <-chan struct{}, fn func([]byte) error) (replayed int64, dropped int64, err error) {
+	for {
+		select {
+		case <-stop:
+			return replayed, dropped, nil
+		default:
+		}
+
+		b.Lock()
+		seg, payload, n, corrupt, done, err := b.next()
+		if err != nil || done {
+			b.Unlock()
+			return replayed, dropped, err
+		}
+
+		if corrupt {
+			b.config.Logger.Error(ErrCorrupt, "skipping the remainder of the segment", "segment", seg.path, "offset", b.offset)
+			dropped += seg.records
+			b.offset = seg.size
+			seg.records = 0
+			b.Unlock()
+			continue
+		}
+		b.Unlock()
+
+		if err := fn(payload); err != nil {
+			return replayed, dropped, err
+		}
+
+		b.Lock()
+		// The segment may have been dropped while the lock was released.
+		if len(b.segments) > 0 && b.segments[0] == seg {
+			b.offset += n
+			seg.records--
+		}
+		b.Unlock()
+		replayed++
+	}
+}
+
+// Expire removes segments that have not been written to within the maximum
+// age.  The number of records that were dropped is returned.
+func (b *Buffer) Expire() (int64, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	var dropped int64
+	deadline := time.Now().Add(-b.config.MaxAge)
+	for len(b.segments) > 0 && b.segments[0].modTime.Before(deadline) {
+		if b.segments[0].records == 0 && len(b.segments) == 1 {
+			break
+		}
+
+		// Never remove the active segment, start a new one first.
+		if len(b.segments) == 1 {
+			if err := b.rotate(); err != nil {
+				return dropped, err
+			}
+		}
+		dropped += b.dropOldest()
+	}
+
+	return dropped, nil
+}
+
+// Close closes the open segment files.
+func (b *Buffer) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.reader != nil {
+		b.reader.Close()
+		b.reader = nil
+	}
+
+	if b.writer != nil {
+		if err := b.writer.Sync(); err != nil {
+			b.writer.Close()
+			return err
+		}
+		return b.writer.Close()
+	}
+
+	return nil
+}
+
+// next reads the record at the current replay position, removing any fully
+// replayed segments.  The lock must be held by the caller.
+func (b *Buffer) next() (seg *segment, payload []byte, n int64, corrupt bool, done bool, err error) {
+	for {
+		seg = b.segments[0]
+
+		if b.offset >= seg.size {
+			// The active segment is only reset once everything has been
+			// replayed so it doesn't grow without bound.
+			if len(b.segments) == 1 {
+				if b.offset > 0 {
+					if err := b.rotate(); err != nil {
+						return nil, nil, 0, false, true, err
+					}
+					b.dropOldest()
+				}
+				return nil, nil, 0, false, true, nil
+			}
+
+			b.dropOldest()
+			continue
+		}
+
+		if b.reader == nil {
+			if b.reader, err = os.Open(seg.path); err != nil {
+				return nil, nil, 0, false, true, err
+			}
+		}
+
+		payload, n, err = readRecord(b.reader, b.offset, seg.size)
+		if errors.Is(err, ErrCorrupt) {
+			return seg, nil, 0, true, false, nil
+		}
+
+		return seg, payload, n, false, false, err
+	}
+}
+
+// rotate starts a new active segment.  The lock must be held by the caller.
+func (b *Buffer) rotate() error {
+	var seq uint64
+	if len(b.segments) > 0 {
+		seq = b.segments[len(b.segments)-1].seq + 1
+	}
+
+	path := filepath.Join(b.config.Dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if b.writer != nil {
+		_ = b.writer.Sync()
+		b.writer.Close()
+	}
+
+	b.writer = f
+	b.segments = append(b.segments, &segment{
+		seq:     seq,
+		path:    path,
+		modTime: time.Now(),
+	})
+
+	return nil
+}
+
+// dropOldest removes the oldest segment, returning the number of records that
+// had not been replayed.  The lock must be held by the caller.
+func (b *Buffer) dropOldest() int64 {
+	seg := b.segments[0]
+	b.segments = b.segments[1:]
+	b.size -= seg.size
+
+	if b.reader != nil {
+		b.reader.Close()
+		b.reader = nil
+	}
+	b.offset = 0
+
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		b.config.Logger.Error(err, "unable to remove segment", "segment", seg.path)
+	}
+
+	return seg.records
+}
+
+// recover loads the existing segments in order, truncating any segment that
+// contains a corrupt record and removing empty segments.
+func (b *Buffer) recover() error {
+	entries, err := os.ReadDir(b.config.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		seg := &segment{
+			seq:  seq,
+			path: filepath.Join(b.config.Dir, name),
+		}
+
+		if err := b.scan(seg); err != nil {
+			return err
+		}
+
+		if seg.records == 0 {
+			if err := os.Remove(seg.path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		b.segments = append(b.segments, seg)
+		b.size += seg.size
+	}
+
+	sort.Slice(b.segments, func(i, j int) bool {
+		return b.segments[i].seq < b.segments[j].seq
+	})
+
+	return nil
+}
+
+// scan counts the valid records in the segment and truncates the file after
+// the last valid record.
+func (b *Buffer) scan(seg *segment) error {
+	f, err := os.OpenFile(seg.path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	seg.modTime = info.ModTime()
+
+	var offset int64
+	for offset < info.Size() {
+		_, n, err := readRecord(f, offset, info.Size())
+		if errors.Is(err, ErrCorrupt) {
+			b.config.Logger.Error(err, "truncating segment", "segment", seg.path, "offset", offset)
+			if err := f.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+
+		offset += n
+		seg.records++
+	}
+
+	seg.size = offset
+	return nil
+}
+
+// readRecord reads the record at the offset, returning the payload and the
+// total size of the record.  ErrCorrupt is returned if the record extends past
+// the limit or the checksum does not match.
+func readRecord(r io.ReaderAt, offset, limit int64) ([]byte, int64, error) {
+	if offset+headerSize > limit {
+		return nil, 0, ErrCorrupt
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, ErrCorrupt
+		}
+		return nil, 0, err
+	}
+
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length > maxRecordSize || offset+headerSize+length > limit {
+		return nil, 0, ErrCorrupt
+	}
+
+	payload := make([]byte, length)
+	if _, err := r.ReadAt(payload, offset+headerSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, ErrCorrupt
+		}
+		return nil, 0, err
+	}
+
+	if crc32.Checksum(payload, castagnoli) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, ErrCorrupt
+	}
+
+	return payload, headerSize + length, nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func open(t *testing.T, config Config) *Buffer {
+	t.Helper()
+
+	if config.Dir == "" {
+		config.Dir = t.TempDir()
+	}
+	if config.MaxSize == 0 {
+		config.MaxSize = 1 << 20
+	}
+	if config.MaxSegmentSize == 0 {
+		config.MaxSegmentSize = 1 << 16
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = time.Hour
+	}
+	config.Logger = logr.Discard()
+
+	b, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	return b
+}
+
+func write(t *testing.T, b *Buffer, records ...string) {
+	t.Helper()
+
+	for _, r := range records {
+		if _, err := b.Write([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func replay(t *testing.T, b *Buffer) []string {
+	t.Helper()
+
+	var records []string
+	_, _, err := b.Replay(nil, func(p []byte) error {
+		records = append(records, string(p))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return records
+}
+
+func TestWriteReplay(t *testing.T) {
+	b := open(t, Config{})
+	write(t, b, "a", "b", "c")
+
+	var records []string
+	replayed, dropped, err := b.Replay(nil, func(p []byte) error {
+		records = append(records, string(p))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replayed != 3 || dropped != 0 {
+		t.Errorf("expected 3 replayed and 0 dropped, got %d and %d", replayed, dropped)
+	}
+
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("expected %v, got %v", want, records)
+	}
+
+	if records := replay(t, b); len(records) != 0 {
+		t.Errorf("expected the buffer to be empty, got %v", records)
+	}
+}
+
+func TestReplayError(t *testing.T) {
+	b := open(t, Config{})
+	write(t, b, "a", "b", "c")
+
+	failure := errors.New("failed")
+	replayed, _, err := b.Replay(nil, func(p []byte) error {
+		if string(p) == "b" {
+			return failure
+		}
+		return nil
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected %v, got %v", failure, err)
+	}
+
+	if replayed != 1 {
+		t.Errorf("expected 1 replayed, got %d", replayed)
+	}
+
+	// The failed record is retried on the next replay.
+	if want, got := []string{"b", "c"}, replay(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestReplayStop(t *testing.T) {
+	b := open(t, Config{})
+	write(t, b, "a", "b", "c")
+
+	stop := make(chan struct{})
+	replayed, _, err := b.Replay(stop, func(p []byte) error {
+		close(stop)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replayed != 1 {
+		t.Errorf("expected 1 replayed, got %d", replayed)
+	}
+
+	if want, got := []string{"b", "c"}, replay(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	b := open(t, Config{MaxAge: 50 * time.Millisecond})
+	write(t, b, "a", "b")
+
+	dropped, err := b.Expire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 0 {
+		t.Errorf("expected nothing to expire, got %d", dropped)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	dropped, err = b.Expire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 2 {
+		t.Errorf("expected 2 dropped, got %d", dropped)
+	}
+
+	// The buffer is still writable after the active segment expires.
+	write(t, b, "c")
+	if want, got := []string{"c"}, replay(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	// Each record is 9 bytes with the header, so every record starts a new
+	// segment and only the newest few fit.
+	b := open(t, Config{MaxSize: 27, MaxSegmentSize: 1})
+
+	var dropped int64
+	for i := 0; i < 5; i++ {
+		n, err := b.Write([]byte(fmt.Sprint(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dropped += n
+	}
+
+	if dropped != 2 {
+		t.Errorf("expected 2 dropped, got %d", dropped)
+	}
+
+	if want, got := []string{"2", "3", "4"}, replay(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+
+	b := open(t, Config{Dir: dir, MaxSegmentSize: 1})
+	write(t, b, "a", "b", "c")
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b = open(t, Config{Dir: dir})
+	if want, got := []string{"a", "b", "c"}, replay(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
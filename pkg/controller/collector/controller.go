@@ -48,6 +48,7 @@ func (r *Controller) SetupWithManager(mgr ctrl.Manager) error {
 
 // +kubebuilder:rbac:groups=strata.ctx.sh,resources=collectors,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=strata.ctx.sh,resources=collectors/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
 
 // Reconcile ensures that the existing state of a resource matches requested state.
 func (r *Controller) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
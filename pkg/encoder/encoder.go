@@ -14,6 +14,24 @@
 
 package encoder
 
+import "ctx.sh/strata-collector/pkg/metric"
+
 type Encoder interface {
 	Encode(interface{}) ([]byte, error)
 }
+
+// BatchEncoder is implemented by encoders that are able to encode a batch of
+// metrics into a single payload.
+type BatchEncoder interface {
+	Encoder
+	EncodeBatch([]*metric.Metric) ([]byte, error)
+}
+
+// Options are the optional parts of a metric that an encoder includes.
+type Options struct {
+	// Metadata includes the HELP and UNIT of the metric family.
+	Metadata bool
+	// Exemplars includes the exemplars attached to counters and histogram
+	// buckets.
+	Exemplars bool
+}
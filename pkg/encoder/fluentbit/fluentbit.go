@@ -14,4 +14,201 @@
 
 package fluentbit
 
-// TODO
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/encoder"
+	"ctx.sh/strata-collector/pkg/metric"
+	"github.com/tinylib/msgp/msgp"
+)
+
+const (
+	// eventTimeExt is the msgpack extension type used by the forward protocol
+	// for nanosecond precision timestamps.
+	eventTimeExt byte = 0x00
+	// fixext8 is the msgpack format for an extension with an 8 byte payload.
+	fixext8 byte = 0xd7
+)
+
+// FluentbitEncoder encodes metrics into fluent forward protocol entries.  Each
+// entry is a msgpack encoded [EventTime, record] pair so that multiple entries
+// can be concatenated into the event stream of a PackedForward message.  The
+// tag is not part of the entry and is added by the fluent output.  The help,
+// unit and exemplars are added to the record if they have been enabled in
+// the options.  Stale markers are flagged with stale set to true.
+type FluentbitEncoder struct {
+	opts encoder.Options
+}
+
+// New returns a new fluent forward encoder.
+func New(opts encoder.Options) *FluentbitEncoder {
+	return &FluentbitEncoder{
+		opts: opts,
+	}
+}
+
+// Encode encodes the metric into a single forward protocol entry.
+func (e *FluentbitEncoder) Encode(v interface{}) ([]byte, error) {
+	m, ok := v.(*metric.Metric)
+	if !ok {
+		return nil, fmt.Errorf("fluentbit encoder does not support %T", v)
+	}
+
+	b := make([]byte, 0, 64+len(m.Name)+32*len(m.Tags))
+	b = msgp.AppendArrayHeader(b, 2)
+	b = appendEventTime(b, m.Timestamp)
+
+	fields := uint32(4)
+	if m.Histogram != nil || m.Summary != nil {
+		fields++
+	}
+
+	metadata := e.opts.Metadata && m.Metadata != nil
+	if metadata {
+		fields += 2
+	}
+
+	exemplar := e.opts.Exemplars && m.Exemplar != nil
+	if exemplar {
+		fields++
+	}
+
+	if m.Stale {
+		fields++
+	}
+
+	b = msgp.AppendMapHeader(b, fields)
+	b = msgp.AppendString(b, "name")
+	b = msgp.AppendString(b, m.Name)
+	b = msgp.AppendString(b, "type")
+	b = msgp.AppendString(b, string(m.Type))
+	b = msgp.AppendString(b, "value")
+	b = msgp.AppendFloat64(b, m.Value)
+	b = msgp.AppendString(b, "tags")
+	b = msgp.AppendMapStrStr(b, m.Tags)
+
+	switch {
+	case m.Histogram != nil:
+		b = msgp.AppendString(b, "histogram")
+		b = appendHistogram(b, m.Histogram, e.opts.Exemplars)
+	case m.Summary != nil:
+		b = msgp.AppendString(b, "summary")
+		b = appendSummary(b, m.Summary)
+	}
+
+	if metadata {
+		b = msgp.AppendString(b, "help")
+		b = msgp.AppendString(b, m.Metadata.Help)
+		b = msgp.AppendString(b, "unit")
+		b = msgp.AppendString(b, m.Metadata.Unit)
+	}
+
+	if exemplar {
+		b = msgp.AppendString(b, "exemplar")
+		b = appendExemplar(b, m.Exemplar)
+	}
+
+	if m.Stale {
+		b = msgp.AppendString(b, "stale")
+		b = msgp.AppendBool(b, true)
+	}
+
+	return b, nil
+}
+
+// EncodeBatch encodes the metrics into a stream of concatenated entries which
+// can be used as the entries of a PackedForward message.
+func (e *FluentbitEncoder) EncodeBatch(metrics []*metric.Metric) ([]byte, error) {
+	b := make([]byte, 0, 128*len(metrics))
+
+	for _, m := range metrics {
+		data, err := e.Encode(m)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, data...)
+	}
+
+	return b, nil
+}
+
+// appendEventTime appends the forward protocol EventTime extension which
+// holds the seconds and nanoseconds as two big endian uint32 values.
+func appendEventTime(b []byte, t time.Time) []byte {
+	b = append(b, fixext8, eventTimeExt)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	return b
+}
+
+// appendHistogram appends the structured histogram as a map of the sum, count
+// and the buckets.  The bucket bounds are formatted as strings so that the +Inf
+// bucket is encoded consistently with prometheus.
+func appendHistogram(b []byte, h *metric.HistogramValue, exemplars bool) []byte {
+	b = msgp.AppendMapHeader(b, 3)
+	b = msgp.AppendString(b, "sum")
+	b = msgp.AppendFloat64(b, h.Sum)
+	b = msgp.AppendString(b, "count")
+	b = msgp.AppendFloat64(b, h.Count)
+	b = msgp.AppendString(b, "buckets")
+	b = msgp.AppendArrayHeader(b, uint32(len(h.Buckets)))
+	for _, bucket := range h.Buckets {
+		exemplar := exemplars && bucket.Exemplar != nil
+		if exemplar {
+			b = msgp.AppendMapHeader(b, 3)
+		} else {
+			b = msgp.AppendMapHeader(b, 2)
+		}
+		b = msgp.AppendString(b, "le")
+		b = msgp.AppendString(b, metric.FormatFloat(bucket.UpperBound))
+		b = msgp.AppendString(b, "count")
+		b = msgp.AppendFloat64(b, bucket.Count)
+		if exemplar {
+			b = msgp.AppendString(b, "exemplar")
+			b = appendExemplar(b, bucket.Exemplar)
+		}
+	}
+	return b
+}
+
+// appendExemplar appends the exemplar as a map of the labels, value and the
+// timestamp in nanoseconds.  The timestamp is omitted if the exemplar did not
+// have one.
+func appendExemplar(b []byte, e *metric.Exemplar) []byte {
+	if e.Timestamp == nil {
+		b = msgp.AppendMapHeader(b, 2)
+	} else {
+		b = msgp.AppendMapHeader(b, 3)
+	}
+	b = msgp.AppendString(b, "labels")
+	b = msgp.AppendMapStrStr(b, e.Labels)
+	b = msgp.AppendString(b, "value")
+	b = msgp.AppendFloat64(b, e.Value)
+	if e.Timestamp != nil {
+		b = msgp.AppendString(b, "timestamp")
+		b = msgp.AppendInt64(b, e.Timestamp.UnixNano())
+	}
+	return b
+}
+
+// appendSummary appends the structured summary as a map of the sum, count and
+// the quantiles.
+func appendSummary(b []byte, s *metric.SummaryValue) []byte {
+	b = msgp.AppendMapHeader(b, 3)
+	b = msgp.AppendString(b, "sum")
+	b = msgp.AppendFloat64(b, s.Sum)
+	b = msgp.AppendString(b, "count")
+	b = msgp.AppendFloat64(b, s.Count)
+	b = msgp.AppendString(b, "quantiles")
+	b = msgp.AppendArrayHeader(b, uint32(len(s.Quantiles)))
+	for _, q := range s.Quantiles {
+		b = msgp.AppendMapHeader(b, 2)
+		b = msgp.AppendString(b, "quantile")
+		b = msgp.AppendFloat64(b, q.Quantile)
+		b = msgp.AppendString(b, "value")
+		b = msgp.AppendFloat64(b, q.Value)
+	}
+	return b
+}
@@ -14,16 +14,38 @@
 
 package json
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"ctx.sh/strata-collector/pkg/encoder"
+	"ctx.sh/strata-collector/pkg/metric"
+)
 
 // JsonEncoder is an encoder that encodes a generic interface into a JSON
-// marshalled byte array.
-type JsonEncoder struct{}
+// marshalled byte array.  The metadata and exemplars of metrics are only
+// included if they have been enabled in the options.
+type JsonEncoder struct {
+	opts encoder.Options
+}
 
-func New() *JsonEncoder {
-	return &JsonEncoder{}
+func New(opts encoder.Options) *JsonEncoder {
+	return &JsonEncoder{
+		opts: opts,
+	}
 }
 
 func (e *JsonEncoder) Encode(v interface{}) ([]byte, error) {
+	if m, ok := v.(*metric.Metric); ok {
+		v = m.Strip(e.opts.Metadata, e.opts.Exemplars)
+	}
 	return json.Marshal(v)
 }
+
+// EncodeBatch encodes the metrics as a single JSON array.
+func (e *JsonEncoder) EncodeBatch(metrics []*metric.Metric) ([]byte, error) {
+	stripped := make([]*metric.Metric, len(metrics))
+	for i, m := range metrics {
+		stripped[i] = m.Strip(e.opts.Metadata, e.opts.Exemplars)
+	}
+	return json.Marshal(stripped)
+}
@@ -14,4 +14,249 @@
 
 package statsd
 
-// TODO
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// CounterExpiry is how long the last value of a counter series is kept
+	// after it was last seen.  Series that churn without a stale marker, i.e.
+	// when the target is restarted, would otherwise be kept forever.
+	CounterExpiry time.Duration = 10 * time.Minute
+)
+
+var (
+	nameReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_")
+	tagReplacer  = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+)
+
+// StatsdEncoder encodes metrics into the statsd line protocol.  Prometheus
+// counters, histograms and summary sums and counts are cumulative, but statsd
+// counters are deltas, so the encoder keeps the last value of each counter
+// series and emits the difference.  The first time a counter series is seen
+// nothing is emitted.  Gauges, summary quantiles and untyped metrics are sent
+// as gauges.
+//
+// Plain statsd does not support tags so they are dropped unless the DogStatsD
+// tag extension has been enabled.  Without tags the bucket series of a
+// histogram and the quantile series of a summary all share the same name, so
+// they are skipped and only the sums and counts are sent.  NaN and infinite
+// values can't be represented in the line protocol and are skipped.
+type StatsdEncoder struct {
+	dogstatsd bool
+	counters  map[uint64]counter
+	swept     time.Time
+	logger    logr.Logger
+	dropped   sync.Once
+	sync.Mutex
+}
+
+// counter is the last value of a counter series and when it was seen.
+type counter struct {
+	value float64
+	seen  time.Time
+}
+
+// New returns a new statsd encoder.  If dogstatsd is true, tags are encoded
+// using the DogStatsD extension.
+func New(dogstatsd bool, logger logr.Logger) *StatsdEncoder {
+	return &StatsdEncoder{
+		dogstatsd: dogstatsd,
+		counters:  make(map[uint64]counter),
+		swept:     time.Now(),
+		logger:    logger,
+	}
+}
+
+// Encode encodes the metric into one or more newline separated statsd lines.
+// An empty slice is returned if there is nothing to send.
+func (e *StatsdEncoder) Encode(v interface{}) ([]byte, error) {
+	m, ok := v.(*metric.Metric)
+	if !ok {
+		return nil, fmt.Errorf("statsd encoder does not support %T", v)
+	}
+
+	// Structured histograms and summaries are sent as the individual series.
+	if m.Histogram != nil || m.Summary != nil {
+		return e.EncodeBatch(m.Flatten())
+	}
+
+	// Statsd has no way to end a series, so stale markers are not sent.  The
+	// last counter value is dropped so a returning series starts over.
+	if m.Stale {
+		e.forget(m)
+		return nil, nil
+	}
+
+	if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+		return nil, nil
+	}
+
+	if !e.dogstatsd && distribution(m) {
+		e.dropped.Do(func() {
+			e.logger.Info("dropping histogram bucket and summary quantile series, they require the dogstatsd encoder", "metric", m.Name)
+		})
+		e.logger.V(8).Info("dropping series", "metric", m.Name, "tags", m.Tags)
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+
+	switch {
+	case cumulative(m):
+		delta, ok := e.delta(m)
+		if !ok {
+			return nil, nil
+		}
+		e.line(&buf, m, delta, "c")
+	default:
+		// A leading sign on a gauge value is treated as a relative change by
+		// statsd, so negative gauges need to be reset to zero first.
+		if m.Value < 0 {
+			e.line(&buf, m, 0, "g")
+			buf.WriteByte('\n')
+		}
+		e.line(&buf, m, m.Value, "g")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// EncodeBatch encodes the metrics into newline separated statsd lines.
+func (e *StatsdEncoder) EncodeBatch(metrics []*metric.Metric) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, m := range metrics {
+		data, err := e.Encode(m)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) == 0 {
+			continue
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.Write(data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// cumulative returns true if the metric is a monotonically increasing value.
+// This includes the bucket, sum and count series of histograms and the sum and
+// count series of summaries.
+func cumulative(m *metric.Metric) bool {
+	switch m.Type {
+	case metric.Counter, metric.Histogram:
+		return true
+	case metric.Summary:
+		_, ok := m.Tags[metric.QuantileLabel]
+		return !ok
+	default:
+		return false
+	}
+}
+
+// distribution returns true if the metric is a histogram bucket or summary
+// quantile series.  The series are only distinguished by their le or quantile
+// tag.
+func distribution(m *metric.Metric) bool {
+	switch m.Type {
+	case metric.Histogram:
+		_, ok := m.Tags[metric.BucketLabel]
+		return ok
+	case metric.Summary:
+		_, ok := m.Tags[metric.QuantileLabel]
+		return ok
+	default:
+		return false
+	}
+}
+
+// delta returns the change in the counter since the last time the series was
+// seen.  Counter resets are handled by treating the current value as the delta.
+func (e *StatsdEncoder) delta(m *metric.Metric) (float64, bool) {
+	e.Lock()
+	defer e.Unlock()
+
+	now := time.Now()
+	e.expire(now)
+
+	key := m.Hash()
+	last, ok := e.counters[key]
+	e.counters[key] = counter{value: m.Value, seen: now}
+	if !ok {
+		return 0, false
+	}
+
+	if m.Value < last.value {
+		return m.Value, true
+	}
+
+	return m.Value - last.value, true
+}
+
+// expire removes the counter series that have not been seen within the
+// expiry.  The counters are swept at most once per expiry.  The lock must be
+// held by the caller.
+func (e *StatsdEncoder) expire(now time.Time) {
+	if now.Sub(e.swept) < CounterExpiry {
+		return
+	}
+	e.swept = now
+
+	for key, c := range e.counters {
+		if now.Sub(c.seen) > CounterExpiry {
+			delete(e.counters, key)
+		}
+	}
+}
+
+// forget removes the last value of the counter series.
+func (e *StatsdEncoder) forget(m *metric.Metric) {
+	e.Lock()
+	defer e.Unlock()
+
+	delete(e.counters, m.Hash())
+}
+
+func (e *StatsdEncoder) line(buf *bytes.Buffer, m *metric.Metric, value float64, kind string) {
+	buf.WriteString(nameReplacer.Replace(m.Name))
+	buf.WriteByte(':')
+	buf.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	buf.WriteByte('|')
+	buf.WriteString(kind)
+
+	if !e.dogstatsd || len(m.Tags) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(m.Tags))
+	for k := range m.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf.WriteString("|#")
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(tagReplacer.Replace(k))
+		buf.WriteByte(':')
+		buf.WriteString(tagReplacer.Replace(m.Tags[k]))
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"github.com/go-logr/logr"
+)
+
+// histogram returns the flattened series of a histogram with the bucket
+// counts scaled by n.
+func histogram(n float64) []*metric.Metric {
+	now := time.Now()
+	series := []struct {
+		name  string
+		le    string
+		value float64
+	}{
+		{"latency_bucket", "0.1", 1},
+		{"latency_bucket", "1", 3},
+		{"latency_bucket", "+Inf", 4},
+		{"latency_sum", "", 2},
+		{"latency_count", "", 4},
+	}
+
+	metrics := make([]*metric.Metric, 0, len(series))
+	for _, s := range series {
+		tags := map[string]string{"path": "/"}
+		if s.le != "" {
+			tags[metric.BucketLabel] = s.le
+		}
+		m := metric.New(now, s.name, s.value*n, tags)
+		m.SetType(metric.Histogram)
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func TestEncodeHistogram(t *testing.T) {
+	tests := []struct {
+		name      string
+		dogstatsd bool
+		expected  []string
+	}{
+		{
+			name: "statsd drops buckets",
+			expected: []string{
+				"latency_sum:2|c",
+				"latency_count:4|c",
+			},
+		},
+		{
+			name:      "dogstatsd keeps buckets",
+			dogstatsd: true,
+			expected: []string{
+				"latency_bucket:1|c|#le:0.1,path:/",
+				"latency_bucket:3|c|#le:1,path:/",
+				"latency_bucket:4|c|#le:+Inf,path:/",
+				"latency_sum:2|c|#path:/",
+				"latency_count:4|c|#path:/",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New(tt.dogstatsd, logr.Discard())
+
+			// The first scrape only records the counter values.
+			data, err := e.EncodeBatch(histogram(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != 0 {
+				t.Fatalf("expected nothing on the first scrape, got %q", data)
+			}
+
+			data, err = e.EncodeBatch(histogram(2))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(string(data), "\n")
+			if strings.Join(lines, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(tt.expected, "\n"), data)
+			}
+		})
+	}
+}
+
+func TestEncodeSummaryQuantiles(t *testing.T) {
+	m := metric.New(time.Now(), "rpc_seconds", 0.5, map[string]string{metric.QuantileLabel: "0.99"})
+	m.SetType(metric.Summary)
+
+	data, err := New(false, logr.Discard()).Encode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("expected the quantile to be dropped, got %q", data)
+	}
+
+	data, err = New(true, logr.Discard()).Encode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "rpc_seconds:0.5|g|#quantile:0.99" {
+		t.Errorf("unexpected line %q", data)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	// readBufferSize is the size of the buffered reader used to read the
+	// scrape.  Lines longer than the buffer are still read in full.
+	readBufferSize = 64 * 1024
+)
+
+var buffers = sync.Pool{
+	New: func() interface{} {
+		return &decodeBuffers{
+			reader: bufio.NewReaderSize(nil, readBufferSize),
+		}
+	},
+}
+
+// decodeBuffers are the buffers used by a decoder.  They are pooled and reused
+// between scrapes.
+type decodeBuffers struct {
+	reader *bufio.Reader
+	line   []byte
+	chunk  bytes.Buffer
+}
+
+// familyReader returns the metric families of a scrape one at a time along
+// with the unit of the family.  io.EOF is returned once all of the families
+// have been read.
+type familyReader interface {
+	next() (*dto.MetricFamily, string, error)
+}
+
+// Decoder converts a scrape incrementally, one metric family at a time, so
+// that neither the body nor all of the parsed families need to be held in
+// memory.  The decoder must be closed to return its buffers to the pool.
+type Decoder struct {
+	now      time.Time
+	opts     ParseOpts
+	buffers  *decodeBuffers
+	lines    *lineReader
+	families familyReader
+}
+
+// NewDecoder returns a decoder that reads the exposition in the format from
+// the reader.  The scrape time is used for all samples that do not have an
+// honored timestamp.
+func NewDecoder(r io.Reader, format Format, now time.Time, opts ParseOpts) *Decoder {
+	b := buffers.Get().(*decodeBuffers)
+	b.reader.Reset(r)
+
+	lines := &lineReader{
+		reader: b.reader,
+		buf:    b.line,
+	}
+
+	d := &Decoder{
+		now:     now,
+		opts:    opts,
+		buffers: b,
+		lines:   lines,
+	}
+
+	switch format {
+	case FormatOpenMetrics:
+		d.families = &openMetricsReader{
+			parser: newOpenMetricsParser(),
+			lines:  lines,
+		}
+	case FormatProtobuf:
+		d.families = &protobufReader{
+			decoder: expfmt.NewDecoder(b.reader, expfmt.FmtProtoDelim),
+		}
+	default:
+		d.families = &textReader{
+			lines: lines,
+			chunk: &b.chunk,
+			types: make(map[string]string),
+			helps: make(map[string]string),
+		}
+	}
+
+	return d
+}
+
+// Decode returns the metrics of the next metric family.  Families without any
+// metrics are skipped.  io.EOF is returned once the exposition has been read.
+func (d *Decoder) Decode() ([]*Metric, error) {
+	for {
+		mf, unit, err := d.families.next()
+		if err != nil {
+			return nil, err
+		}
+
+		metrics := fromMetricFamily(d.now, mf.GetName(), mf, newMetadata(mf, unit), d.opts)
+		if len(metrics) > 0 {
+			return metrics, nil
+		}
+	}
+}
+
+// Close returns the buffers to the pool.  The decoder can not be used once it
+// has been closed.
+func (d *Decoder) Close() {
+	if d.buffers == nil {
+		return
+	}
+
+	// The line buffer may have grown while reading long lines.
+	d.buffers.line = d.lines.buf[:0]
+	d.buffers.reader.Reset(nil)
+	d.buffers.chunk.Reset()
+	buffers.Put(d.buffers)
+
+	d.buffers = nil
+	d.lines = nil
+	d.families = nil
+}
+
+// lineReader reads the lines of the exposition without the line endings.  The
+// returned line is only valid until the next call.
+type lineReader struct {
+	reader *bufio.Reader
+	buf    []byte
+	n      int
+}
+
+func (l *lineReader) next() ([]byte, error) {
+	l.buf = l.buf[:0]
+	for {
+		frag, err := l.reader.ReadSlice('\n')
+		l.buf = append(l.buf, frag...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil && (!errors.Is(err, io.EOF) || len(l.buf) == 0) {
+			return nil, err
+		}
+		break
+	}
+
+	l.n++
+	line := bytes.TrimSuffix(l.buf, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r")), nil
+}
+
+// protobufReader reads the length delimited protobuf families.
+type protobufReader struct {
+	decoder expfmt.Decoder
+}
+
+func (r *protobufReader) next() (*dto.MetricFamily, string, error) {
+	mf := &dto.MetricFamily{}
+	if err := r.decoder.Decode(mf); err != nil {
+		return nil, "", err
+	}
+	return mf, "", nil
+}
+
+// textReader splits the text exposition into the lines of each family and
+// parses them one family at a time.  The samples of a family are expected to
+// be grouped together as required by the format.  Samples that are not are
+// parsed as a separate family with the HELP and TYPE of the earlier
+// declaration.
+type textReader struct {
+	lines   *lineReader
+	parser  expfmt.TextParser
+	chunk   *bytes.Buffer
+	types   map[string]string
+	helps   map[string]string
+	current string
+	offset  int
+	ready   []*dto.MetricFamily
+	eof     bool
+}
+
+func (r *textReader) next() (*dto.MetricFamily, string, error) {
+	for len(r.ready) == 0 {
+		if r.eof {
+			return nil, "", io.EOF
+		}
+
+		line, err := r.lines.next()
+		if errors.Is(err, io.EOF) {
+			r.eof = true
+			if err := r.flush(); err != nil {
+				return nil, "", err
+			}
+			continue
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			// Keep the blank lines within a family so that the line numbers
+			// of parse errors can be mapped back to the exposition.
+			if r.chunk.Len() > 0 {
+				r.chunk.WriteByte('\n')
+			}
+			continue
+		}
+
+		if family := r.family(line); family != "" && family != r.current {
+			if err := r.flush(); err != nil {
+				return nil, "", err
+			}
+			r.current = family
+		}
+
+		if r.chunk.Len() == 0 {
+			r.offset = r.lines.n - 1
+			if line[0] != '#' {
+				r.declare(r.current)
+			}
+		}
+		r.chunk.Write(line)
+		r.chunk.WriteByte('\n')
+	}
+
+	mf := r.ready[0]
+	r.ready[0] = nil
+	r.ready = r.ready[1:]
+
+	return mf, "", nil
+}
+
+// flush parses the lines of the current family.
+func (r *textReader) flush() error {
+	if r.chunk.Len() == 0 {
+		return nil
+	}
+
+	families, err := r.parser.TextToMetricFamilies(r.chunk)
+	r.chunk.Reset()
+	if err != nil {
+		var perr expfmt.ParseError
+		if errors.As(err, &perr) {
+			perr.Line += r.offset
+			return perr
+		}
+		return err
+	}
+
+	start := len(r.ready)
+	for _, mf := range families {
+		r.ready = append(r.ready, mf)
+	}
+	sort.Slice(r.ready[start:], func(i, j int) bool {
+		return r.ready[start+i].GetName() < r.ready[start+j].GetName()
+	})
+
+	return nil
+}
+
+// declare writes the HELP and TYPE lines seen earlier for the family to the
+// start of the chunk.
+func (r *textReader) declare(family string) {
+	for _, line := range []string{r.helps[family], r.typeLine(family)} {
+		if line == "" {
+			continue
+		}
+		r.chunk.WriteString(line)
+		r.chunk.WriteByte('\n')
+		r.offset--
+	}
+}
+
+func (r *textReader) typeLine(family string) string {
+	t, ok := r.types[family]
+	if !ok {
+		return ""
+	}
+	return "# TYPE " + family + " " + t
+}
+
+// family returns the name of the family that the line belongs to.  Comments
+// other than HELP and TYPE belong to the current family and an empty name is
+// returned.  The bucket, sum and count samples belong to the declared
+// histogram or summary family.
+func (r *textReader) family(line []byte) string {
+	if line[0] == '#' {
+		fields := bytes.Fields(line)
+		if len(fields) < 3 {
+			return ""
+		}
+
+		switch string(fields[1]) {
+		case "TYPE":
+			name := string(fields[2])
+			if len(fields) > 3 {
+				r.types[name] = string(fields[3])
+			}
+			return name
+		case "HELP":
+			name := string(fields[2])
+			r.helps[name] = string(line)
+			return name
+		default:
+			return ""
+		}
+	}
+
+	end := bytes.IndexAny(line, "{ \t")
+	if end < 0 {
+		end = len(line)
+	}
+	name := line[:end]
+
+	if string(name) == r.current {
+		return r.current
+	}
+
+	for _, suffix := range []string{BucketSuffix, SumSuffix, CountSuffix} {
+		if !bytes.HasSuffix(name, []byte(suffix)) {
+			continue
+		}
+
+		base := name[:len(name)-len(suffix)]
+		if string(base) == r.current {
+			return r.current
+		}
+
+		switch r.types[string(base)] {
+		case typeHistogram:
+			return string(base)
+		case typeSummary:
+			if suffix != BucketSuffix {
+				return string(base)
+			}
+		}
+	}
+
+	return string(name)
+}
@@ -0,0 +1,386 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	benchFamilies = 1000
+	benchSeries   = 50
+)
+
+var benchFormats = []struct {
+	name        string
+	contentType string
+	format      expfmt.Format
+}{
+	{"text", string(expfmt.FmtText), expfmt.FmtText},
+	{"openmetrics", string(expfmt.FmtOpenMetrics_1_0_0), expfmt.FmtOpenMetrics_1_0_0},
+	{"protobuf", string(expfmt.FmtProtoDelim), expfmt.FmtProtoDelim},
+}
+
+// BenchmarkDecodeBuffered reads the whole body and parses it at once.  Along
+// with the allocations it reports the peak live heap, which is what bounds
+// the memory of the collector when scraping large exporters.
+func BenchmarkDecodeBuffered(b *testing.B) {
+	benchmarkDecode(b, parseBuffered)
+}
+
+// BenchmarkDecodeStreamed decodes the body one family at a time and discards
+// each family once it has been decoded, so the peak live heap is that of the
+// decoder rather than of the metrics that the caller holds on to.
+func BenchmarkDecodeStreamed(b *testing.B) {
+	benchmarkDecode(b, parseStreamed)
+}
+
+func TestDecoderText(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// want is the exposition parsed at once as the reference when it
+		// differs from the body.
+		want string
+	}{
+		{
+			name: "interleaved untyped families",
+			body: "a 1\nb 2\na{x=\"1\"} 3\nb{x=\"1\"} 4\n",
+		},
+		{
+			name: "interleaved typed family",
+			body: "# TYPE a counter\na 1\nb 2\na{x=\"1\"} 3\n",
+		},
+		{
+			name: "histogram",
+			body: "# HELP latency_seconds Request latency.\n" +
+				"# TYPE latency_seconds histogram\n" +
+				"latency_seconds_bucket{le=\"0.1\"} 1\n" +
+				"latency_seconds_bucket{le=\"1\"} 2\n" +
+				"latency_seconds_bucket{le=\"+Inf\"} 3\n" +
+				"latency_seconds_sum 1.5\n" +
+				"latency_seconds_count 3\n" +
+				"# TYPE requests_total counter\n" +
+				"requests_total 7\n",
+		},
+		{
+			name: "histogram without type",
+			body: "latency_seconds_bucket{le=\"1\"} 2\n" +
+				"latency_seconds_bucket{le=\"+Inf\"} 3\n" +
+				"latency_seconds_sum 1.5\n" +
+				"latency_seconds_count 3\n",
+		},
+		{
+			name: "summary",
+			body: "# TYPE rpc_seconds summary\n" +
+				"rpc_seconds{quantile=\"0.5\"} 0.1\n" +
+				"rpc_seconds{quantile=\"0.99\"} 0.5\n" +
+				"rpc_seconds_sum 12\n" +
+				"rpc_seconds_count 40\n" +
+				"rpc_seconds_bucket 1\n",
+		},
+		{
+			name: "comments and blank lines",
+			body: "# a comment before anything\n\n" +
+				"# HELP a The a gauge.\n" +
+				"# TYPE a gauge\n" +
+				"\n" +
+				"# a comment within the family\n" +
+				"a{x=\"1\"} 1\n" +
+				"\n" +
+				"a{x=\"2\"} 2\n" +
+				"# TYPE b gauge\n" +
+				"b 3\n\n",
+		},
+		{
+			name: "missing trailing newline",
+			body: "# TYPE a gauge\na 1\nb 2",
+			want: "# TYPE a gauge\na 1\nb 2\n",
+		},
+		{
+			name: "windows line endings",
+			body: "# TYPE a gauge\r\na 1\r\nb 2\r\n",
+			want: "# TYPE a gauge\na 1\nb 2\n",
+		},
+	}
+
+	now := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		for _, flatten := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/flatten=%t", tt.name, flatten), func(t *testing.T) {
+				opts := ParseOpts{Flatten: flatten}
+
+				want := tt.want
+				if want == "" {
+					want = tt.body
+				}
+				expected := parseWhole(t, want, now, opts)
+
+				dec := NewDecoder(strings.NewReader(tt.body), FormatText, now, opts)
+				defer dec.Close()
+
+				var actual []*Metric
+				for {
+					metrics, err := dec.Decode()
+					if errors.Is(err, io.EOF) {
+						break
+					} else if err != nil {
+						t.Fatal(err)
+					}
+					actual = append(actual, metrics...)
+				}
+				sortMetrics(actual)
+
+				if !reflect.DeepEqual(actual, expected) {
+					t.Errorf("expected:\n%s\ngot:\n%s", formatMetrics(expected), formatMetrics(actual))
+				}
+			})
+		}
+	}
+}
+
+func TestDecoderTextErrorLine(t *testing.T) {
+	body := "# HELP a The a counter.\n# TYPE a counter\na 1\nb 2\n\na{x=\"1\"} nope\n"
+
+	dec := NewDecoder(strings.NewReader(body), FormatText, time.Now(), ParseOpts{})
+	defer dec.Close()
+
+	var err error
+	for err == nil {
+		_, err = dec.Decode()
+	}
+
+	var perr expfmt.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	if perr.Line != 6 {
+		t.Errorf("expected the error on line 6, got %d", perr.Line)
+	}
+}
+
+// parseWhole parses the whole text exposition at once with the upstream
+// parser, which is what the decoder is expected to match.
+func parseWhole(t *testing.T, body string, now time.Time, opts ParseOpts) []*Metric {
+	t.Helper()
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metrics []*Metric
+	for name, mf := range families {
+		metrics = append(metrics, FromMetricFamily(now, name, mf, opts)...)
+	}
+	sortMetrics(metrics)
+
+	return metrics
+}
+
+func metricKey(m *Metric) string {
+	return fmt.Sprintf("%s%v", m.Name, m.Tags)
+}
+
+func sortMetrics(metrics []*Metric) {
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return metricKey(metrics[i]) < metricKey(metrics[j])
+	})
+}
+
+func formatMetrics(metrics []*Metric) string {
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "  %s %s %v\n", metricKey(m), m.Type, m.Value)
+	}
+	return b.String()
+}
+
+func benchmarkDecode(b *testing.B, parse func(io.Reader, Format, *heapPeak) error) {
+	for _, f := range benchFormats {
+		body, err := exposition(f.format)
+		if err != nil {
+			b.Fatal(err)
+		}
+		format := FormatFromContentType(f.contentType)
+
+		b.Run(f.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				if err := parse(bytes.NewReader(body), format, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+
+			p := newHeapPeak()
+			if err := parse(bytes.NewReader(body), format, p); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(p.max), "peak-live-B")
+		})
+	}
+}
+
+// heapPeak tracks the largest live heap seen at the sampled points of a
+// parse.
+type heapPeak struct {
+	base uint64
+	max  uint64
+}
+
+func newHeapPeak() *heapPeak {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return &heapPeak{base: stats.HeapAlloc}
+}
+
+// sample collects garbage and records the live heap.  It is only called while
+// measuring the peak, never in the timed loop.
+func (p *heapPeak) sample() {
+	if p == nil {
+		return
+	}
+
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > p.base && stats.HeapAlloc-p.base > p.max {
+		p.max = stats.HeapAlloc - p.base
+	}
+}
+
+func parseBuffered(r io.Reader, format Format, p *heapPeak) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	metrics, err := Parse(time.Now(), format, buf, ParseOpts{Flatten: true})
+	p.sample()
+	runtime.KeepAlive(buf)
+	runtime.KeepAlive(metrics)
+	return err
+}
+
+func parseStreamed(r io.Reader, format Format, p *heapPeak) error {
+	dec := NewDecoder(r, format, time.Now(), ParseOpts{Flatten: true})
+	defer dec.Close()
+
+	for {
+		metrics, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		p.sample()
+		runtime.KeepAlive(metrics)
+	}
+}
+
+// exposition generates a scrape with alternating counter and histogram
+// families.
+func exposition(format expfmt.Format) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, format)
+
+	for i := 0; i < benchFamilies; i++ {
+		mf := benchCounter(i)
+		if i%2 == 1 {
+			mf = benchHistogram(i)
+		}
+
+		if err := enc.Encode(mf); err != nil {
+			return nil, err
+		}
+	}
+
+	if format == expfmt.FmtOpenMetrics_1_0_0 {
+		if _, err := expfmt.FinalizeOpenMetrics(&buf); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func benchCounter(i int) *dto.MetricFamily {
+	mf := &dto.MetricFamily{
+		Name: proto.String("bench_requests_" + strconv.Itoa(i)),
+		Help: proto.String("Generated counter."),
+		Type: dto.MetricType_COUNTER.Enum(),
+	}
+
+	for j := 0; j < benchSeries; j++ {
+		mf.Metric = append(mf.Metric, &dto.Metric{
+			Label:   benchLabels(j),
+			Counter: &dto.Counter{Value: proto.Float64(float64(i * j))},
+		})
+	}
+
+	return mf
+}
+
+func benchHistogram(i int) *dto.MetricFamily {
+	mf := &dto.MetricFamily{
+		Name: proto.String("bench_duration_seconds_" + strconv.Itoa(i)),
+		Help: proto.String("Generated histogram."),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+	}
+
+	bounds := []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+	for j := 0; j < benchSeries; j++ {
+		h := &dto.Histogram{
+			SampleCount: proto.Uint64(uint64(len(bounds) * j)),
+			SampleSum:   proto.Float64(float64(i + j)),
+		}
+		for k, bound := range bounds {
+			h.Bucket = append(h.Bucket, bucket(bound, uint64(k*j)))
+		}
+
+		mf.Metric = append(mf.Metric, &dto.Metric{
+			Label:     benchLabels(j),
+			Histogram: h,
+		})
+	}
+
+	return mf
+}
+
+func benchLabels(j int) []*dto.LabelPair {
+	return labels(
+		"instance", "10.0.0."+strconv.Itoa(j%255),
+		"path", "/api/v1/resource/"+strconv.Itoa(j),
+	)
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"mime"
+)
+
+// Format is the exposition format of a scraped target.
+type Format string
+
+const (
+	// FormatText is the prometheus text exposition format.
+	FormatText Format = "text"
+	// FormatOpenMetrics is the OpenMetrics text exposition format.
+	FormatOpenMetrics Format = "openmetrics"
+	// FormatProtobuf is the prometheus delimited protobuf exposition format.
+	FormatProtobuf Format = "protobuf"
+)
+
+// AcceptHeader is the Accept header sent when scraping a target.  The
+// protobuf format is preferred, followed by OpenMetrics and then the
+// prometheus text format.
+const AcceptHeader = "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.9," +
+	"application/openmetrics-text;version=1.0.0;q=0.8," +
+	"application/openmetrics-text;version=0.0.1;q=0.75," +
+	"text/plain;version=0.0.4;q=0.5," +
+	"*/*;q=0.1"
+
+// FormatFromContentType returns the exposition format for the content type
+// returned by the target.  Unknown content types fall back to the prometheus
+// text format.
+func FormatFromContentType(contentType string) Format {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return FormatText
+	}
+
+	switch mediaType {
+	case "application/openmetrics-text":
+		return FormatOpenMetrics
+	case "application/vnd.google.protobuf":
+		if params["proto"] == "io.prometheus.client.MetricFamily" && params["encoding"] == "delimited" {
+			return FormatProtobuf
+		}
+	}
+
+	return FormatText
+}
@@ -0,0 +1,201 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Bucket is a cumulative histogram bucket.
+type Bucket struct {
+	// UpperBound is the inclusive upper bound of the bucket.
+	UpperBound float64
+	// Count is the cumulative number of observations in the bucket.
+	Count float64
+	// Exemplar is the exemplar attached to the bucket.
+	Exemplar *Exemplar
+}
+
+type jsonBucket struct {
+	UpperBound string    `json:"le"`
+	Count      float64   `json:"count"`
+	Exemplar   *Exemplar `json:"exemplar,omitempty"`
+}
+
+// MarshalJSON encodes the upper bound as a string since JSON does not support
+// the +Inf bucket.
+func (b Bucket) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonBucket{
+		UpperBound: FormatFloat(b.UpperBound),
+		Count:      b.Count,
+		Exemplar:   b.Exemplar,
+	})
+}
+
+func (b *Bucket) UnmarshalJSON(data []byte) error {
+	var jb jsonBucket
+	if err := json.Unmarshal(data, &jb); err != nil {
+		return err
+	}
+
+	bound, err := strconv.ParseFloat(jb.UpperBound, 64)
+	if err != nil {
+		return err
+	}
+
+	b.UpperBound = bound
+	b.Count = jb.Count
+	b.Exemplar = jb.Exemplar
+	return nil
+}
+
+// HistogramValue is the structured value of a histogram.
+type HistogramValue struct {
+	// Sum is the sum of all observations.
+	Sum float64 `json:"sum"`
+	// Count is the number of observations.
+	Count float64 `json:"count"`
+	// Buckets are the cumulative buckets ordered by upper bound.
+	Buckets []Bucket `json:"buckets"`
+	// Native is the exponential bucket layout of a prometheus native
+	// histogram.  It is only set for native histograms, which may also expose
+	// the classic buckets.
+	Native *NativeHistogram `json:"native,omitempty"`
+}
+
+// BucketSpan is a run of consecutive native histogram buckets.  The offset of
+// the first span is the index of the first bucket, the offsets of the
+// remaining spans are the number of empty buckets since the previous span.
+type BucketSpan struct {
+	Offset int32  `json:"offset"`
+	Length uint32 `json:"length"`
+}
+
+// NativeHistogram is the sparse exponential bucket layout of a prometheus
+// native histogram.  The bucket counts are absolute counts rather than the
+// deltas used by the exposition format.
+type NativeHistogram struct {
+	// Schema determines the bucket boundaries.  The bucket at index i has an
+	// upper bound of (2^(2^-schema))^i.
+	Schema int32 `json:"schema"`
+	// ZeroThreshold is the width of the zero bucket.
+	ZeroThreshold float64 `json:"zeroThreshold"`
+	// ZeroCount is the number of observations in the zero bucket.
+	ZeroCount float64 `json:"zeroCount"`
+	// PositiveSpans are the spans of the populated positive buckets.
+	PositiveSpans []BucketSpan `json:"positiveSpans,omitempty"`
+	// PositiveCounts are the counts of each of the positive buckets.
+	PositiveCounts []float64 `json:"positiveCounts,omitempty"`
+	// NegativeSpans are the spans of the populated negative buckets.
+	NegativeSpans []BucketSpan `json:"negativeSpans,omitempty"`
+	// NegativeCounts are the counts of each of the negative buckets.
+	NegativeCounts []float64 `json:"negativeCounts,omitempty"`
+}
+
+// Quantile is a single summary quantile.
+type Quantile struct {
+	// Quantile is the quantile, i.e. 0.99.
+	Quantile float64 `json:"quantile"`
+	// Value is the value at the quantile.
+	Value float64 `json:"value"`
+}
+
+// SummaryValue is the structured value of a summary.
+type SummaryValue struct {
+	// Sum is the sum of all observations.
+	Sum float64 `json:"sum"`
+	// Count is the number of observations.
+	Count float64 `json:"count"`
+	// Quantiles are the calculated quantiles.
+	Quantiles []Quantile `json:"quantiles"`
+}
+
+// Flatten expands a histogram or summary with a structured value into the
+// individual bucket or quantile series and the sum and count series, using
+// the prometheus naming conventions.  Metrics without a structured value are
+// returned as is.  The buckets of a native histogram have no flattened form,
+// so only the classic buckets, if any, are included.
+func (m *Metric) Flatten() []*Metric {
+	switch {
+	case m.Histogram != nil:
+		h := m.Histogram
+		out := make([]*Metric, 0, len(h.Buckets)+2)
+		for _, b := range h.Buckets {
+			p := New(m.Timestamp, m.Name+BucketSuffix, b.Count, copyTags(m.Tags))
+			p.SetType(m.Type)
+			p.AddTag(BucketLabel, FormatFloat(b.UpperBound))
+			p.Metadata = m.Metadata
+			p.Exemplar = b.Exemplar
+			p.Stale = m.Stale
+			out = append(out, p)
+		}
+		return append(out, m.sumAndCount(h.Sum, h.Count)...)
+	case m.Summary != nil:
+		s := m.Summary
+		out := make([]*Metric, 0, len(s.Quantiles)+2)
+		for _, q := range s.Quantiles {
+			p := New(m.Timestamp, m.Name, q.Value, copyTags(m.Tags))
+			p.SetType(m.Type)
+			p.AddTag(QuantileLabel, FormatFloat(q.Quantile))
+			p.Metadata = m.Metadata
+			p.Stale = m.Stale
+			out = append(out, p)
+		}
+		return append(out, m.sumAndCount(s.Sum, s.Count)...)
+	default:
+		return []*Metric{m}
+	}
+}
+
+// Samples returns the number of prometheus samples the metric represents.  A
+// classic histogram or summary is one sample for each bucket or quantile plus
+// the sum and count, a native histogram is a single sample.
+func (m *Metric) Samples() int {
+	switch {
+	case m.Histogram != nil && m.Histogram.Native != nil:
+		return 1
+	case m.Histogram != nil:
+		return len(m.Histogram.Buckets) + 2
+	case m.Summary != nil:
+		return len(m.Summary.Quantiles) + 2
+	default:
+		return 1
+	}
+}
+
+// Samples returns the total number of prometheus samples in the metrics.
+func Samples(metrics []*Metric) int {
+	var n int
+	for _, m := range metrics {
+		n += m.Samples()
+	}
+	return n
+}
+
+// sumAndCount returns the _sum and _count series of a histogram or summary.
+func (m *Metric) sumAndCount(sum, count float64) []*Metric {
+	s := New(m.Timestamp, m.Name+SumSuffix, sum, copyTags(m.Tags))
+	s.SetType(m.Type)
+	s.Metadata = m.Metadata
+	s.Stale = m.Stale
+
+	c := New(m.Timestamp, m.Name+CountSuffix, count, copyTags(m.Tags))
+	c.SetType(m.Type)
+	c.Metadata = m.Metadata
+	c.Stale = m.Stale
+
+	return []*Metric{s, c}
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Metadata is the metadata exposed for a metric family.
+type Metadata struct {
+	// Help is the description of the metric family.
+	Help string `json:"help,omitempty"`
+	// Unit is the unit of the metric family.  It is only exposed by the
+	// OpenMetrics format.
+	Unit string `json:"unit,omitempty"`
+}
+
+// Exemplar is an example observation, usually linking a sample to a trace.
+type Exemplar struct {
+	// Labels are the exemplar labels, i.e. trace_id.
+	Labels map[string]string `json:"labels"`
+	// Value is the observed value.
+	Value float64 `json:"value"`
+	// Timestamp is the time of the observation.  It is nil if the exemplar
+	// did not have a timestamp.
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// Strip returns the metric without the metadata and exemplars that have not
+// been requested.  The metric is returned as is if there is nothing to remove,
+// otherwise a shallow copy is returned so that the metric can still be shared
+// between outputs.
+func (m *Metric) Strip(metadata bool, exemplars bool) *Metric {
+	removeMetadata := !metadata && m.Metadata != nil
+	removeExemplars := !exemplars && m.hasExemplars()
+	if !removeMetadata && !removeExemplars {
+		return m
+	}
+
+	c := *m
+	if removeMetadata {
+		c.Metadata = nil
+	}
+
+	if removeExemplars {
+		c.Exemplar = nil
+		if m.Histogram != nil {
+			h := *m.Histogram
+			h.Buckets = make([]Bucket, len(m.Histogram.Buckets))
+			for i, b := range m.Histogram.Buckets {
+				h.Buckets[i] = Bucket{UpperBound: b.UpperBound, Count: b.Count}
+			}
+			c.Histogram = &h
+		}
+	}
+
+	return &c
+}
+
+func (m *Metric) hasExemplars() bool {
+	if m.Exemplar != nil {
+		return true
+	}
+
+	if m.Histogram != nil {
+		for _, b := range m.Histogram.Buckets {
+			if b.Exemplar != nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func newMetadata(mf *dto.MetricFamily, unit string) *Metadata {
+	if mf.GetHelp() == "" && unit == "" {
+		return nil
+	}
+
+	return &Metadata{
+		Help: mf.GetHelp(),
+		Unit: unit,
+	}
+}
+
+func newExemplar(e *dto.Exemplar) *Exemplar {
+	if e == nil {
+		return nil
+	}
+
+	ex := &Exemplar{
+		Labels: ParseLabelPairs(e.GetLabel()),
+		Value:  e.GetValue(),
+	}
+
+	if e.Timestamp != nil {
+		ts := e.GetTimestamp().AsTime()
+		ex.Timestamp = &ts
+	}
+
+	return ex
+}
@@ -15,6 +15,8 @@
 package metric
 
 import (
+	"hash/fnv"
+	"sort"
 	"time"
 )
 
@@ -33,6 +35,19 @@ const (
 	Unknown   MetricsType = "unknown"
 )
 
+const (
+	// BucketLabel is the tag that holds the upper bound of a histogram bucket.
+	BucketLabel string = "le"
+	// QuantileLabel is the tag that holds the quantile of a summary.
+	QuantileLabel string = "quantile"
+	// BucketSuffix is appended to the name of histogram bucket series.
+	BucketSuffix string = "_bucket"
+	// SumSuffix is appended to the name of histogram and summary sum series.
+	SumSuffix string = "_sum"
+	// CountSuffix is appended to the name of histogram and summary count series.
+	CountSuffix string = "_count"
+)
+
 // Metric is used to store a scraped metric from prometheus
 type Metric struct {
 	// Name of the metric.
@@ -45,7 +60,22 @@ type Metric struct {
 	// Type represents the type of metric that was scraped.
 	Type MetricsType `json:"type"`
 	// Value represents the value of the metric that was scraped as a float64.
+	// Histograms and summaries with a structured value use the count.
 	Value float64 `json:"value"`
+	// Histogram is the structured value of a histogram.  It is only set when
+	// histograms are not flattened.
+	Histogram *HistogramValue `json:"histogram,omitempty"`
+	// Summary is the structured value of a summary.  It is only set when
+	// summaries are not flattened.
+	Summary *SummaryValue `json:"summary,omitempty"`
+	// Metadata is the HELP and UNIT of the metric family.  It is shared by all
+	// of the metrics in the family.
+	Metadata *Metadata `json:"metadata,omitempty"`
+	// Exemplar is the exemplar attached to a counter or histogram bucket.
+	Exemplar *Exemplar `json:"exemplar,omitempty"`
+	// Stale marks the end of the series.  The series was present in the
+	// previous scrape but has since disappeared.  The value is not used.
+	Stale bool `json:"stale,omitempty"`
 }
 
 // New creates a new metric.
@@ -70,3 +100,24 @@ func (m *Metric) AddTag(k, v string) {
 func (m *Metric) SetType(Type MetricsType) {
 	m.Type = Type
 }
+
+// Hash returns a hash of the metric name and tags.  Metrics with the same hash
+// belong to the same series.
+func (m *Metric) Hash() uint64 {
+	keys := make([]string, 0, len(m.Tags))
+	for k := range m.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(m.Name))
+	for _, k := range keys {
+		_, _ = h.Write([]byte{0xff})
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write([]byte{0xff})
+		_, _ = h.Write([]byte(m.Tags[k]))
+	}
+
+	return h.Sum64()
+}
@@ -0,0 +1,550 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	// ErrMissingEOF is returned when an OpenMetrics exposition does not end
+	// with the # EOF marker.
+	ErrMissingEOF = errors.New("openmetrics: missing # EOF")
+)
+
+const (
+	typeCounter        = "counter"
+	typeGauge          = "gauge"
+	typeHistogram      = "histogram"
+	typeGaugeHistogram = "gaugehistogram"
+	typeSummary        = "summary"
+	typeInfo           = "info"
+	typeStateset       = "stateset"
+	typeUnknown        = "unknown"
+
+	suffixTotal   = "_total"
+	suffixCreated = "_created"
+	suffixInfo    = "_info"
+	suffixGCount  = "_gcount"
+	suffixGSum    = "_gsum"
+)
+
+// suffixes are the sample name suffixes that are allowed for each of the
+// OpenMetrics types.  An empty suffix means the sample uses the family name.
+var suffixes = map[string][]string{
+	typeCounter:        {suffixTotal, suffixCreated},
+	typeGauge:          {""},
+	typeHistogram:      {BucketSuffix, CountSuffix, SumSuffix, suffixCreated},
+	typeGaugeHistogram: {BucketSuffix, suffixGCount, suffixGSum},
+	typeSummary:        {"", CountSuffix, SumSuffix, suffixCreated},
+	typeInfo:           {suffixInfo},
+	typeStateset:       {""},
+	typeUnknown:        {""},
+}
+
+// openMetricsParser converts the OpenMetrics text format into prometheus
+// metric families so they can share the same conversion as the other
+// formats.  Counters and info metrics are named with their _total and _info
+// suffixes, gauge histograms are emitted as gauges using the exposed series
+// names, statesets are emitted as gauges and the _created series are dropped.
+//
+// OpenMetrics does not allow families to be interleaved, so a family is
+// complete as soon as the next one starts.  Completed families are queued in
+// ready and released by the reader, which means only a single family is held
+// in memory at a time.
+type openMetricsParser struct {
+	types    map[string]string
+	help     map[string]string
+	unit     map[string]string
+	units    map[string]string
+	current  string
+	families map[string]*dto.MetricFamily
+	series   map[string]*dto.Metric
+	order    []string
+	ready    []*dto.MetricFamily
+	eof      bool
+}
+
+func newOpenMetricsParser() *openMetricsParser {
+	return &openMetricsParser{
+		types:    make(map[string]string),
+		help:     make(map[string]string),
+		unit:     make(map[string]string),
+		units:    make(map[string]string),
+		families: make(map[string]*dto.MetricFamily),
+		series:   make(map[string]*dto.Metric),
+	}
+}
+
+// openMetricsReader reads the OpenMetrics families one at a time.
+type openMetricsReader struct {
+	parser *openMetricsParser
+	lines  *lineReader
+}
+
+func (r *openMetricsReader) next() (*dto.MetricFamily, string, error) {
+	p := r.parser
+	for len(p.ready) == 0 {
+		line, err := r.lines.next()
+		if errors.Is(err, io.EOF) {
+			if !p.eof {
+				return nil, "", ErrMissingEOF
+			}
+			return nil, "", io.EOF
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		if err := p.line(string(line)); err != nil {
+			return nil, "", fmt.Errorf("openmetrics: line %d: %w", r.lines.n, err)
+		}
+	}
+
+	mf := p.ready[0]
+	p.ready[0] = nil
+	p.ready = p.ready[1:]
+
+	unit := p.units[mf.GetName()]
+	delete(p.units, mf.GetName())
+
+	return mf, unit, nil
+}
+
+// begin starts the named family, completing the previous one.
+func (p *openMetricsParser) begin(family string) {
+	if family == p.current {
+		return
+	}
+
+	p.flush()
+	p.current = family
+}
+
+// flush queues the families of the current family for the reader.  More
+// than one family is produced for gauge histograms.
+func (p *openMetricsParser) flush() {
+	for _, name := range p.order {
+		p.ready = append(p.ready, p.families[name])
+	}
+
+	p.order = p.order[:0]
+	clear(p.families)
+	clear(p.series)
+}
+
+func (p *openMetricsParser) line(line string) error {
+	if p.eof {
+		return errors.New("unexpected content after # EOF")
+	}
+
+	switch {
+	case line == "# EOF":
+		p.eof = true
+		p.flush()
+		return nil
+	case strings.HasPrefix(line, "#"):
+		return p.metadata(line)
+	case line == "":
+		return errors.New("unexpected empty line")
+	default:
+		return p.sample(line)
+	}
+}
+
+// metadata records the TYPE, HELP and UNIT of a family.
+func (p *openMetricsParser) metadata(line string) error {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 || fields[0] != "#" {
+		return fmt.Errorf("invalid metadata line %q", line)
+	}
+
+	name := fields[2]
+	var value string
+	if len(fields) == 4 {
+		value = fields[3]
+	}
+
+	p.begin(name)
+
+	switch fields[1] {
+	case "TYPE":
+		if _, ok := suffixes[value]; !ok {
+			return fmt.Errorf("invalid type %q for %s", value, name)
+		}
+		p.types[name] = value
+	case "HELP":
+		p.help[name] = unescape(value)
+	case "UNIT":
+		p.unit[name] = value
+	default:
+		return fmt.Errorf("invalid metadata line %q", line)
+	}
+
+	return nil
+}
+
+func (p *openMetricsParser) sample(line string) error {
+	name, labels, rest, err := parseSeries(line)
+	if err != nil {
+		return err
+	}
+
+	var exemplar *dto.Exemplar
+	if idx := strings.Index(rest, " # "); idx >= 0 {
+		exemplar, err = parseExemplar(rest[idx+3:])
+		if err != nil {
+			return err
+		}
+		rest = rest[:idx]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("invalid sample %q", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %q: %w", fields[0], err)
+	}
+
+	var timestampMs *int64
+	if len(fields) == 2 {
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q: %w", fields[1], err)
+		}
+		ms := int64(math.Round(ts * 1000))
+		timestampMs = &ms
+	}
+
+	family, typ, suffix := p.resolve(name)
+	p.begin(family)
+	if suffix == suffixCreated {
+		return nil
+	}
+
+	switch typ {
+	case typeCounter:
+		m := p.metric(family+suffixTotal, family, dto.MetricType_COUNTER, labels, "")
+		m.Counter = &dto.Counter{Value: &value, Exemplar: exemplar}
+		m.TimestampMs = timestampMs
+	case typeGauge, typeStateset:
+		m := p.metric(family, family, dto.MetricType_GAUGE, labels, "")
+		m.Gauge = &dto.Gauge{Value: &value}
+		m.TimestampMs = timestampMs
+	case typeInfo:
+		m := p.metric(family+suffixInfo, family, dto.MetricType_GAUGE, labels, "")
+		m.Gauge = &dto.Gauge{Value: &value}
+		m.TimestampMs = timestampMs
+	case typeGaugeHistogram:
+		m := p.metric(name, family, dto.MetricType_GAUGE, labels, "")
+		m.Gauge = &dto.Gauge{Value: &value}
+		m.TimestampMs = timestampMs
+	case typeHistogram:
+		m := p.metric(family, family, dto.MetricType_HISTOGRAM, labels, BucketLabel)
+		if m.Histogram == nil {
+			m.Histogram = &dto.Histogram{}
+		}
+		m.TimestampMs = timestampMs
+
+		switch suffix {
+		case BucketSuffix:
+			bound, err := strconv.ParseFloat(labelValue(labels, BucketLabel), 64)
+			if err != nil {
+				return fmt.Errorf("invalid bucket bound for %s: %w", name, err)
+			}
+			count := uint64(value)
+			m.Histogram.Bucket = append(m.Histogram.Bucket, &dto.Bucket{
+				UpperBound:      &bound,
+				CumulativeCount: &count,
+				Exemplar:        exemplar,
+			})
+		case CountSuffix:
+			count := uint64(value)
+			m.Histogram.SampleCount = &count
+		case SumSuffix:
+			m.Histogram.SampleSum = &value
+		}
+	case typeSummary:
+		m := p.metric(family, family, dto.MetricType_SUMMARY, labels, QuantileLabel)
+		if m.Summary == nil {
+			m.Summary = &dto.Summary{}
+		}
+		m.TimestampMs = timestampMs
+
+		switch suffix {
+		case CountSuffix:
+			count := uint64(value)
+			m.Summary.SampleCount = &count
+		case SumSuffix:
+			m.Summary.SampleSum = &value
+		default:
+			quantile, err := strconv.ParseFloat(labelValue(labels, QuantileLabel), 64)
+			if err != nil {
+				return fmt.Errorf("invalid quantile for %s: %w", name, err)
+			}
+			m.Summary.Quantile = append(m.Summary.Quantile, &dto.Quantile{
+				Quantile: &quantile,
+				Value:    &value,
+			})
+		}
+	default:
+		m := p.metric(name, name, dto.MetricType_UNTYPED, labels, "")
+		m.Untyped = &dto.Untyped{Value: &value}
+		m.TimestampMs = timestampMs
+	}
+
+	return nil
+}
+
+// resolve returns the family, type and suffix of the sample.  Samples which
+// do not belong to a declared family are treated as unknown.
+func (p *openMetricsParser) resolve(name string) (string, string, string) {
+	if typ, ok := p.types[name]; ok && allowed(typ, "") {
+		return name, typ, ""
+	}
+
+	for _, suffix := range []string{suffixTotal, suffixCreated, BucketSuffix, CountSuffix, SumSuffix, suffixGCount, suffixGSum, suffixInfo} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		family := strings.TrimSuffix(name, suffix)
+		if typ, ok := p.types[family]; ok && allowed(typ, suffix) {
+			return family, typ, suffix
+		}
+	}
+
+	return name, typeUnknown, ""
+}
+
+func allowed(typ string, suffix string) bool {
+	for _, s := range suffixes[typ] {
+		if s == suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// metric returns the series in the named family with the labels, creating
+// the family and series if needed.  The exclude label is not used to identify
+// the series so that buckets and quantiles are grouped together.
+func (p *openMetricsParser) metric(name, family string, t dto.MetricType, labels []*dto.LabelPair, exclude string) *dto.Metric {
+	mf, ok := p.families[name]
+	if !ok {
+		mf = &dto.MetricFamily{
+			Name: &name,
+			Type: &t,
+		}
+		if help, ok := p.help[family]; ok {
+			mf.Help = &help
+		}
+		if unit, ok := p.unit[family]; ok {
+			p.units[name] = unit
+		}
+		p.families[name] = mf
+		p.order = append(p.order, name)
+	}
+
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	var key strings.Builder
+	key.WriteString(name)
+	for _, l := range labels {
+		if l.GetName() == exclude {
+			continue
+		}
+		pairs = append(pairs, l)
+		key.WriteByte(0xff)
+		key.WriteString(l.GetName())
+		key.WriteByte(0xfe)
+		key.WriteString(l.GetValue())
+	}
+
+	m, ok := p.series[key.String()]
+	if !ok {
+		m = &dto.Metric{Label: pairs}
+		p.series[key.String()] = m
+		mf.Metric = append(mf.Metric, m)
+	}
+
+	return m
+}
+
+// parseSeries parses the metric name and labels from the start of the line
+// and returns the remainder.  The labels are sorted by name.
+func parseSeries(line string) (string, []*dto.LabelPair, string, error) {
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return "", nil, "", fmt.Errorf("invalid sample %q", line)
+	}
+
+	name := line[:end]
+	rest := line[end:]
+
+	var labels []*dto.LabelPair
+	if rest[0] == '{' {
+		var err error
+		labels, rest, err = parseLabels(rest)
+		if err != nil {
+			return "", nil, "", err
+		}
+	}
+
+	if !strings.HasPrefix(rest, " ") {
+		return "", nil, "", fmt.Errorf("invalid sample %q", line)
+	}
+
+	return name, labels, rest[1:], nil
+}
+
+// parseLabels parses a {name="value",...} label set and returns the labels
+// sorted by name and the remainder of the string.
+func parseLabels(s string) ([]*dto.LabelPair, string, error) {
+	labels := make([]*dto.LabelPair, 0)
+	s = s[1:]
+
+	for {
+		if strings.HasPrefix(s, "}") {
+			s = s[1:]
+			break
+		}
+
+		eq := strings.Index(s, "=\"")
+		if eq <= 0 {
+			return nil, "", fmt.Errorf("invalid label set near %q", s)
+		}
+		name := s[:eq]
+		s = s[eq+2:]
+
+		var value strings.Builder
+		var closed bool
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			if c == '"' {
+				s = s[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated label value for %s", name)
+		}
+
+		v := value.String()
+		labels = append(labels, &dto.LabelPair{Name: &name, Value: &v})
+
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].GetName() < labels[j].GetName()
+	})
+
+	return labels, s, nil
+}
+
+// parseExemplar parses the {labels} value [timestamp] exemplar that follows
+// a sample.
+func parseExemplar(s string) (*dto.Exemplar, error) {
+	if !strings.HasPrefix(s, "{") {
+		return nil, fmt.Errorf("invalid exemplar %q", s)
+	}
+
+	labels, rest, err := parseLabels(s)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid exemplar %q", s)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exemplar value %q: %w", fields[0], err)
+	}
+
+	exemplar := &dto.Exemplar{
+		Label: labels,
+		Value: &value,
+	}
+
+	if len(fields) == 2 {
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exemplar timestamp %q: %w", fields[1], err)
+		}
+		exemplar.Timestamp = timestamppb.New(time.UnixMilli(int64(math.Round(ts * 1000))))
+	}
+
+	return exemplar, nil
+}
+
+func labelValue(labels []*dto.LabelPair, name string) string {
+	for _, l := range labels {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,395 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// readOpenMetrics parses the exposition and returns the families along with
+// the unit of each family.
+func readOpenMetrics(s string) ([]*dto.MetricFamily, map[string]string, error) {
+	r := &openMetricsReader{
+		parser: newOpenMetricsParser(),
+		lines:  &lineReader{reader: bufio.NewReader(strings.NewReader(s))},
+	}
+
+	var families []*dto.MetricFamily
+	units := make(map[string]string)
+	for {
+		mf, unit, err := r.next()
+		if errors.Is(err, io.EOF) {
+			return families, units, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		families = append(families, mf)
+		if unit != "" {
+			units[mf.GetName()] = unit
+		}
+	}
+}
+
+func labels(pairs ...string) []*dto.LabelPair {
+	l := make([]*dto.LabelPair, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		l = append(l, &dto.LabelPair{Name: proto.String(pairs[i]), Value: proto.String(pairs[i+1])})
+	}
+	return l
+}
+
+func bucket(bound float64, count uint64) *dto.Bucket {
+	return &dto.Bucket{UpperBound: proto.Float64(bound), CumulativeCount: proto.Uint64(count)}
+}
+
+func TestOpenMetricsExpfmt(t *testing.T) {
+	exemplarTime := timestamppb.New(time.UnixMilli(1700000000123))
+
+	tests := []struct {
+		name   string
+		family *dto.MetricFamily
+	}{
+		{
+			name: "counter",
+			family: &dto.MetricFamily{
+				Name: proto.String("requests_total"),
+				Help: proto.String("Total requests with \\ and\nnewline."),
+				Type: dto.MetricType_COUNTER.Enum(),
+				Metric: []*dto.Metric{
+					{
+						Label:   labels("code", "200", "path", "/"),
+						Counter: &dto.Counter{Value: proto.Float64(1027)},
+					},
+					{
+						Label: labels("code", "500", "path", "/"),
+						Counter: &dto.Counter{
+							Value: proto.Float64(3),
+							Exemplar: &dto.Exemplar{
+								Label:     labels("trace_id", "abc123"),
+								Value:     proto.Float64(1),
+								Timestamp: exemplarTime,
+							},
+						},
+						TimestampMs: proto.Int64(1700000000000),
+					},
+				},
+			},
+		},
+		{
+			name: "gauge",
+			family: &dto.MetricFamily{
+				Name: proto.String("temperature"),
+				Type: dto.MetricType_GAUGE.Enum(),
+				Metric: []*dto.Metric{
+					{
+						Label: labels("room", "a \"quoted\" \\ value"),
+						Gauge: &dto.Gauge{Value: proto.Float64(-12.5)},
+					},
+					{
+						Label: labels("room", "b"),
+						Gauge: &dto.Gauge{Value: proto.Float64(math.Inf(1))},
+					},
+				},
+			},
+		},
+		{
+			name: "histogram",
+			family: &dto.MetricFamily{
+				Name: proto.String("latency_seconds"),
+				Help: proto.String("Request latency."),
+				Type: dto.MetricType_HISTOGRAM.Enum(),
+				Metric: []*dto.Metric{
+					{
+						Label: labels("path", "/"),
+						Histogram: &dto.Histogram{
+							SampleCount: proto.Uint64(7),
+							SampleSum:   proto.Float64(3.25),
+							Bucket: []*dto.Bucket{
+								bucket(0.1, 2),
+								{
+									UpperBound:      proto.Float64(1),
+									CumulativeCount: proto.Uint64(5),
+									Exemplar: &dto.Exemplar{
+										Label:     labels("trace_id", "def456"),
+										Value:     proto.Float64(0.5),
+										Timestamp: exemplarTime,
+									},
+								},
+								bucket(math.Inf(1), 7),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "summary",
+			family: &dto.MetricFamily{
+				Name: proto.String("rpc_seconds"),
+				Type: dto.MetricType_SUMMARY.Enum(),
+				Metric: []*dto.Metric{
+					{
+						Summary: &dto.Summary{
+							SampleCount: proto.Uint64(10),
+							SampleSum:   proto.Float64(4.5),
+							Quantile: []*dto.Quantile{
+								{Quantile: proto.Float64(0.5), Value: proto.Float64(0.3)},
+								{Quantile: proto.Float64(0.99), Value: proto.Float64(0.9)},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unknown",
+			family: &dto.MetricFamily{
+				Name: proto.String("queue_depth"),
+				Type: dto.MetricType_UNTYPED.Enum(),
+				Metric: []*dto.Metric{
+					{
+						Label:   labels("queue", "default"),
+						Untyped: &dto.Untyped{Value: proto.Float64(42)},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := expfmt.MetricFamilyToOpenMetrics(&buf, tt.family); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := expfmt.FinalizeOpenMetrics(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			families, _, err := readOpenMetrics(buf.String())
+			if err != nil {
+				t.Fatalf("unable to parse:\n%s\n%v", buf.String(), err)
+			}
+
+			if len(families) != 1 {
+				t.Fatalf("expected 1 family, got %d", len(families))
+			}
+			if !proto.Equal(families[0], tt.family) {
+				t.Errorf("family mismatch for:\n%s\nexpected %v\ngot      %v", buf.String(), tt.family, families[0])
+			}
+		})
+	}
+}
+
+func TestOpenMetricsFamilies(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []*dto.MetricFamily
+		units    map[string]string
+	}{
+		{
+			name: "created series are dropped",
+			input: `# TYPE requests counter
+# UNIT requests requests
+requests_total 5
+requests_created 1700000000
+# TYPE latency histogram
+latency_bucket{le="+Inf"} 2
+latency_count 2
+latency_sum 0.5
+latency_created 1700000000
+# EOF
+`,
+			expected: []*dto.MetricFamily{
+				{
+					Name:   proto.String("requests_total"),
+					Type:   dto.MetricType_COUNTER.Enum(),
+					Metric: []*dto.Metric{{Label: labels(), Counter: &dto.Counter{Value: proto.Float64(5)}}},
+				},
+				{
+					Name: proto.String("latency"),
+					Type: dto.MetricType_HISTOGRAM.Enum(),
+					Metric: []*dto.Metric{{
+						Label: labels(),
+						Histogram: &dto.Histogram{
+							SampleCount: proto.Uint64(2),
+							SampleSum:   proto.Float64(0.5),
+							Bucket:      []*dto.Bucket{bucket(math.Inf(1), 2)},
+						},
+					}},
+				},
+			},
+			units: map[string]string{"requests_total": "requests"},
+		},
+		{
+			name: "info",
+			input: `# TYPE build info
+# HELP build Build information.
+build_info{version="1.2.3"} 1
+# EOF
+`,
+			expected: []*dto.MetricFamily{
+				{
+					Name:   proto.String("build_info"),
+					Help:   proto.String("Build information."),
+					Type:   dto.MetricType_GAUGE.Enum(),
+					Metric: []*dto.Metric{{Label: labels("version", "1.2.3"), Gauge: &dto.Gauge{Value: proto.Float64(1)}}},
+				},
+			},
+		},
+		{
+			name: "stateset",
+			input: `# TYPE feature stateset
+feature{feature="a"} 1
+feature{feature="b"} 0
+# EOF
+`,
+			expected: []*dto.MetricFamily{
+				{
+					Name: proto.String("feature"),
+					Type: dto.MetricType_GAUGE.Enum(),
+					Metric: []*dto.Metric{
+						{Label: labels("feature", "a"), Gauge: &dto.Gauge{Value: proto.Float64(1)}},
+						{Label: labels("feature", "b"), Gauge: &dto.Gauge{Value: proto.Float64(0)}},
+					},
+				},
+			},
+		},
+		{
+			name: "gaugehistogram",
+			input: `# TYPE queue gaugehistogram
+queue_bucket{le="1"} 3
+queue_bucket{le="+Inf"} 5
+queue_gcount 5
+queue_gsum 4.5
+# EOF
+`,
+			expected: []*dto.MetricFamily{
+				{
+					Name: proto.String("queue_bucket"),
+					Type: dto.MetricType_GAUGE.Enum(),
+					Metric: []*dto.Metric{
+						{Label: labels("le", "1"), Gauge: &dto.Gauge{Value: proto.Float64(3)}},
+						{Label: labels("le", "+Inf"), Gauge: &dto.Gauge{Value: proto.Float64(5)}},
+					},
+				},
+				{
+					Name:   proto.String("queue_gcount"),
+					Type:   dto.MetricType_GAUGE.Enum(),
+					Metric: []*dto.Metric{{Label: labels(), Gauge: &dto.Gauge{Value: proto.Float64(5)}}},
+				},
+				{
+					Name:   proto.String("queue_gsum"),
+					Type:   dto.MetricType_GAUGE.Enum(),
+					Metric: []*dto.Metric{{Label: labels(), Gauge: &dto.Gauge{Value: proto.Float64(4.5)}}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			families, units, err := readOpenMetrics(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(families) != len(tt.expected) {
+				t.Fatalf("expected %d families, got %d: %v", len(tt.expected), len(families), families)
+			}
+			for i := range families {
+				if !proto.Equal(families[i], tt.expected[i]) {
+					t.Errorf("family %d mismatch\nexpected %v\ngot      %v", i, tt.expected[i], families[i])
+				}
+			}
+
+			for name, unit := range tt.units {
+				if units[name] != unit {
+					t.Errorf("expected unit %q for %s, got %q", unit, name, units[name])
+				}
+			}
+		})
+	}
+}
+
+func TestOpenMetricsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		err    error
+		substr string
+	}{
+		{
+			name:  "missing eof",
+			input: "# TYPE up gauge\nup 1\n",
+			err:   ErrMissingEOF,
+		},
+		{
+			name:  "empty",
+			input: "",
+			err:   ErrMissingEOF,
+		},
+		{
+			name:   "content after eof",
+			input:  "up 1\n# EOF\nup 2\n",
+			substr: "line 3: unexpected content after # EOF",
+		},
+		{
+			name:   "empty line",
+			input:  "up 1\n\nup 2\n# EOF\n",
+			substr: "line 2: unexpected empty line",
+		},
+		{
+			name:   "invalid type",
+			input:  "# TYPE up histogramish\n# EOF\n",
+			substr: "line 1: invalid type",
+		},
+		{
+			name:   "invalid value",
+			input:  "# TYPE up gauge\nup one\n# EOF\n",
+			substr: "line 2: invalid value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readOpenMetrics(tt.input)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+			if tt.substr != "" && !strings.Contains(err.Error(), tt.substr) {
+				t.Errorf("expected error containing %q, got %v", tt.substr, err)
+			}
+		})
+	}
+}
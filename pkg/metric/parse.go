@@ -1,86 +1,263 @@
 package metric
 
 import (
-	"bufio"
 	"bytes"
-	"fmt"
+	"errors"
+	"io"
 	"math"
+	"strconv"
 	"time"
 
 	dto "github.com/prometheus/client_model/go"
-	"github.com/prometheus/common/expfmt"
 )
 
-func FromPrometheusMetric(now time.Time, buf []byte) ([]*Metric, error) {
-	var parser expfmt.TextParser
-	var err error
+// ParseOpts are the options used when converting the scraped metric families.
+type ParseOpts struct {
+	// Flatten emits histograms and summaries as separate bucket, quantile, sum
+	// and count series.  When false, a single metric with a structured value
+	// is emitted for each histogram and summary.
+	Flatten bool
+	// HonorTimestamps uses the timestamps exposed by the target instead of
+	// the scrape time for the samples that have one.
+	HonorTimestamps bool
+}
+
+// FromPrometheusMetric converts the prometheus text exposition format.
+func FromPrometheusMetric(now time.Time, buf []byte, opts ParseOpts) ([]*Metric, error) {
+	return Parse(now, FormatText, buf, opts)
+}
+
+// Parse converts the scraped exposition using the format that was returned
+// by the target.  The whole exposition is converted at once; use a Decoder to
+// convert it incrementally.
+func Parse(now time.Time, format Format, buf []byte, opts ParseOpts) ([]*Metric, error) {
+	d := NewDecoder(bytes.NewReader(buf), format, now, opts)
+	defer d.Close()
 
 	var metrics []*Metric
+	for {
+		m, err := d.Decode()
+		if errors.Is(err, io.EOF) {
+			return metrics, nil
+		} else if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m...)
+	}
+}
+
+// FromMetricFamily converts a single metric family.
+func FromMetricFamily(now time.Time, name string, mf *dto.MetricFamily, opts ParseOpts) []*Metric {
+	return fromMetricFamily(now, name, mf, newMetadata(mf, ""), opts)
+}
 
-	buf = bytes.TrimPrefix(buf, []byte("\n"))
-	buffer := bytes.NewBuffer(buf)
-	reader := bufio.NewReader(buffer)
-
-	metricFamilies, err := parser.TextToMetricFamilies(reader)
-	if err != nil {
-		return nil, err
-	}
-
-	for name, mf := range metricFamilies {
-		for _, m := range mf.Metric {
-			tags := ParseLabelPairs(m.GetLabel())
-			switch mf.GetType() {
-			case dto.MetricType_SUMMARY:
-				for _, q := range m.GetSummary().Quantile {
-					if v := q.GetValue(); !math.IsNaN(v) {
-						p := New(now, name, v, tags)
-						p.SetType(Summary)
-
-						quantile := fmt.Sprint(q.GetQuantile())
-						p.AddTag("quantile", quantile)
-
-						metrics = append(metrics, p)
-					}
-				}
-			case dto.MetricType_HISTOGRAM:
-				for _, b := range m.GetHistogram().Bucket {
-					v := float64(b.GetCumulativeCount())
-					p := New(now, name, v, tags)
-					p.SetType(Histogram)
-
-					bucket := fmt.Sprint(b.GetUpperBound())
-					p.AddTag("bucket", bucket)
-
-					metrics = append(metrics, p)
-				}
-			case dto.MetricType_COUNTER:
-				if v := m.GetCounter().GetValue(); !math.IsNaN(v) {
-					p := New(now, name, v, tags)
-					p.SetType(Counter)
-
-					metrics = append(metrics, p)
-				}
-			case dto.MetricType_GAUGE:
-				if v := m.GetGauge().GetValue(); !math.IsNaN(v) {
-					p := New(now, name, v, tags)
-					p.SetType(Gauge)
-
-					metrics = append(metrics, p)
-				}
-			case dto.MetricType_UNTYPED:
-				if v := m.GetUntyped().GetValue(); !math.IsNaN(v) {
-					p := New(now, name, v, tags)
-					p.SetType(Untyped)
-
-					metrics = append(metrics, p)
-				}
-			default:
-				continue
+func fromMetricFamily(now time.Time, name string, mf *dto.MetricFamily, md *Metadata, opts ParseOpts) []*Metric {
+	var metrics []*Metric
+
+	for _, m := range mf.Metric {
+		ts := now
+		if opts.HonorTimestamps && m.TimestampMs != nil {
+			ts = time.UnixMilli(m.GetTimestampMs())
+		}
+
+		tags := ParseLabelPairs(m.GetLabel())
+		switch mf.GetType() {
+		case dto.MetricType_SUMMARY:
+			s := summaryValue(m.GetSummary())
+			p := New(ts, name, s.Count, tags)
+			p.SetType(Summary)
+			p.Summary = s
+			p.Metadata = md
+
+			if opts.Flatten {
+				metrics = append(metrics, p.Flatten()...)
+			} else {
+				metrics = append(metrics, p)
+			}
+		case dto.MetricType_HISTOGRAM:
+			h := histogramValue(m.GetHistogram())
+			p := New(ts, name, h.Count, tags)
+			p.SetType(Histogram)
+			p.Histogram = h
+			p.Metadata = md
+
+			// Native histograms are never flattened since the exponential
+			// buckets would be lost.
+			if opts.Flatten && h.Native == nil {
+				metrics = append(metrics, p.Flatten()...)
+			} else {
+				metrics = append(metrics, p)
 			}
+		case dto.MetricType_COUNTER:
+			if v := m.GetCounter().GetValue(); !math.IsNaN(v) {
+				p := New(ts, name, v, tags)
+				p.SetType(Counter)
+				p.Metadata = md
+				p.Exemplar = newExemplar(m.GetCounter().GetExemplar())
+
+				metrics = append(metrics, p)
+			}
+		case dto.MetricType_GAUGE:
+			if v := m.GetGauge().GetValue(); !math.IsNaN(v) {
+				p := New(ts, name, v, tags)
+				p.SetType(Gauge)
+				p.Metadata = md
+
+				metrics = append(metrics, p)
+			}
+		case dto.MetricType_UNTYPED:
+			if v := m.GetUntyped().GetValue(); !math.IsNaN(v) {
+				p := New(ts, name, v, tags)
+				p.SetType(Untyped)
+				p.Metadata = md
+
+				metrics = append(metrics, p)
+			}
+		default:
+			continue
+		}
+	}
+
+	return metrics
+}
+
+func summaryValue(s *dto.Summary) *SummaryValue {
+	v := &SummaryValue{
+		Sum:       s.GetSampleSum(),
+		Count:     float64(s.GetSampleCount()),
+		Quantiles: make([]Quantile, 0, len(s.Quantile)),
+	}
+
+	for _, q := range s.Quantile {
+		if value := q.GetValue(); !math.IsNaN(value) {
+			v.Quantiles = append(v.Quantiles, Quantile{
+				Quantile: q.GetQuantile(),
+				Value:    value,
+			})
 		}
 	}
 
-	return metrics, nil
+	return v
+}
+
+func histogramValue(h *dto.Histogram) *HistogramValue {
+	v := &HistogramValue{
+		Sum:     h.GetSampleSum(),
+		Count:   float64(h.GetSampleCount()),
+		Buckets: make([]Bucket, 0, len(h.Bucket)+1),
+	}
+
+	if h.GetSampleCountFloat() > 0 {
+		v.Count = h.GetSampleCountFloat()
+	}
+
+	if isNative(h) {
+		v.Native = nativeHistogram(h)
+
+		// A native histogram without classic buckets doesn't have the
+		// implicit +Inf bucket.
+		if len(h.Bucket) == 0 {
+			return v
+		}
+	}
+
+	var inf bool
+	for _, b := range h.Bucket {
+		v.Buckets = append(v.Buckets, Bucket{
+			UpperBound: b.GetUpperBound(),
+			Count:      float64(b.GetCumulativeCount()),
+			Exemplar:   newExemplar(b.GetExemplar()),
+		})
+		inf = inf || math.IsInf(b.GetUpperBound(), 1)
+	}
+
+	// The +Inf bucket is implicit in some expositions, but it is always equal
+	// to the sample count.
+	if !inf {
+		v.Buckets = append(v.Buckets, Bucket{
+			UpperBound: math.Inf(1),
+			Count:      v.Count,
+		})
+	}
+
+	return v
+}
+
+// isNative returns true if the histogram has native buckets.  Client
+// libraries expose a single empty span for native histograms without any
+// observations so they can be told apart from classic histograms.
+func isNative(h *dto.Histogram) bool {
+	return h.GetZeroThreshold() > 0 || h.GetZeroCount() > 0 || h.GetZeroCountFloat() > 0 ||
+		len(h.GetPositiveSpan()) > 0 || len(h.GetNegativeSpan()) > 0
+}
+
+func nativeHistogram(h *dto.Histogram) *NativeHistogram {
+	n := &NativeHistogram{
+		Schema:         h.GetSchema(),
+		ZeroThreshold:  h.GetZeroThreshold(),
+		ZeroCount:      float64(h.GetZeroCount()),
+		PositiveSpans:  bucketSpans(h.GetPositiveSpan()),
+		PositiveCounts: bucketCounts(h.GetPositiveDelta(), h.GetPositiveCount()),
+		NegativeSpans:  bucketSpans(h.GetNegativeSpan()),
+		NegativeCounts: bucketCounts(h.GetNegativeDelta(), h.GetNegativeCount()),
+	}
+
+	if h.GetZeroCountFloat() > 0 {
+		n.ZeroCount = h.GetZeroCountFloat()
+	}
+
+	return n
+}
+
+func bucketSpans(spans []*dto.BucketSpan) []BucketSpan {
+	out := make([]BucketSpan, 0, len(spans))
+	for _, s := range spans {
+		out = append(out, BucketSpan{
+			Offset: s.GetOffset(),
+			Length: s.GetLength(),
+		})
+	}
+	return out
+}
+
+// bucketCounts returns the absolute bucket counts.  Integer histograms encode
+// each bucket as the delta to the previous bucket, float histograms use the
+// absolute counts.
+func bucketCounts(deltas []int64, counts []float64) []float64 {
+	if len(counts) > 0 {
+		return counts
+	}
+
+	out := make([]float64, 0, len(deltas))
+	var count int64
+	for _, d := range deltas {
+		count += d
+		out = append(out, float64(count))
+	}
+	return out
+}
+
+// FormatFloat formats the value the same way prometheus formats bucket bounds
+// and quantiles.
+func FormatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	c := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		c[k] = v
+	}
+	return c
 }
 
 func ParseLabelPairs(pairs []*dto.LabelPair) map[string]string {
@@ -0,0 +1,121 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// StaleNaN is the bit pattern of the NaN value prometheus uses to mark
+	// the end of a series.
+	StaleNaN uint64 = 0x7ff0000000000002
+)
+
+// StaleValue returns the prometheus staleness marker value.
+func StaleValue() float64 {
+	return math.Float64frombits(StaleNaN)
+}
+
+// Series is what is needed to end the series of a metric with a stale marker.
+// It does not hold the values or exemplars of the metric, so the series of a
+// target can be kept between scrapes without holding on to the scraped
+// metrics.  The tags are shared with the metric.
+type Series struct {
+	name     string
+	tags     map[string]string
+	typ      MetricsType
+	metadata *Metadata
+	// histogram and summary are set for metrics with a structured value,
+	// along with the bucket upper bounds or quantiles.
+	histogram bool
+	summary   bool
+	bounds    []float64
+	// native is set with the schema for native histograms.
+	native bool
+	schema int32
+}
+
+// Series returns the series of the metric.
+func (m *Metric) Series() Series {
+	s := Series{
+		name:     m.Name,
+		tags:     m.Tags,
+		typ:      m.Type,
+		metadata: m.Metadata,
+	}
+
+	switch {
+	case m.Histogram != nil:
+		s.histogram = true
+		s.bounds = make([]float64, len(m.Histogram.Buckets))
+		for i, b := range m.Histogram.Buckets {
+			s.bounds[i] = b.UpperBound
+		}
+		if n := m.Histogram.Native; n != nil {
+			s.native = true
+			s.schema = n.Schema
+		}
+	case m.Summary != nil:
+		s.summary = true
+		s.bounds = make([]float64, len(m.Summary.Quantiles))
+		for i, q := range m.Summary.Quantiles {
+			s.bounds[i] = q.Quantile
+		}
+	}
+
+	return s
+}
+
+// StaleMarker returns a marker that ends the series.  The marker keeps the
+// bucket bounds and quantiles of histograms and summaries so that the
+// flattened series are ended as well, and the schema of native histograms so
+// they are still recognized as native.
+func (s Series) StaleMarker(t time.Time) *Metric {
+	m := New(t, s.name, 0, copyTags(s.tags))
+	m.SetType(s.typ)
+	m.Metadata = s.metadata
+	m.Stale = true
+
+	switch {
+	case s.histogram:
+		h := &HistogramValue{
+			Buckets: make([]Bucket, len(s.bounds)),
+		}
+		for i, b := range s.bounds {
+			h.Buckets[i] = Bucket{UpperBound: b}
+		}
+		if s.native {
+			h.Native = &NativeHistogram{Schema: s.schema}
+		}
+		m.Histogram = h
+	case s.summary:
+		q := &SummaryValue{
+			Quantiles: make([]Quantile, len(s.bounds)),
+		}
+		for i, b := range s.bounds {
+			q.Quantiles[i] = Quantile{Quantile: b}
+		}
+		m.Summary = q
+	}
+
+	return m
+}
+
+// StaleMarker returns a marker that ends the series of the metric.
+func (m *Metric) StaleMarker(t time.Time) *Metric {
+	return m.Series().StaleMarker(t)
+}
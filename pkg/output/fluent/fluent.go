@@ -0,0 +1,422 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fluent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/output"
+	"github.com/go-logr/logr"
+	"github.com/tinylib/msgp/msgp"
+)
+
+const (
+	// queueSize is the number of full batches that can be waiting to be sent.
+	// Batches are failed rather than blocking Send once the queue is full.
+	queueSize int = 8
+)
+
+// Config represents the configuration for the fluent forward output.
+type Config struct {
+	// Address is the host:port of the fluent bit or fluentd forward input.
+	Address string
+	// Tag is the tag template that entries are sent with.
+	Tag string
+	// RequireAck enables at-least-once delivery.  Each message carries a
+	// chunk id and the server must acknowledge it before the next message
+	// is sent.
+	RequireAck bool
+	// BatchSize is the maximum number of entries held before a flush.
+	BatchSize int
+	// FlushInterval is the maximum time a partial batch is held.
+	FlushInterval time.Duration
+	// MaxRetries is the number of times a failed message is retried.
+	MaxRetries int
+	// Timeout is the dial, write and acknowledgement timeout.
+	Timeout time.Duration
+	// TLS is the optional TLS configuration for the connection.
+	TLS *tls.Config
+	// Logger is used to report failed messages.
+	Logger logr.Logger
+}
+
+// entry is an encoded forward protocol entry and the tag it will be sent with.
+type entry struct {
+	tag string
+	msg *output.Message
+}
+
+// Fluent is an output that sends metrics encoded by the fluentbit encoder to
+// a fluent forward server.  Entries are batched and grouped by tag into
+// PackedForward messages which are sent in the background.
+type Fluent struct {
+	config  Config
+	tag     *template.Template
+	conn    net.Conn
+	reader  *msgp.Reader
+	batch   []entry
+	batchCh chan []entry
+	bufPool sync.Pool
+	running bool
+	failed  output.FailureHandler
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	doneChan chan struct{}
+	sync.Mutex
+}
+
+// New returns a new fluent output.  The tag is parsed as a template and an
+// error is returned if it is not valid.
+func New(config Config) (*Fluent, error) {
+	f := &Fluent{
+		config:   config,
+		batch:    make([]entry, 0, config.BatchSize),
+		batchCh:  make(chan []entry, queueSize),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+		bufPool: sync.Pool{
+			New: func() any { return new(bytes.Buffer) },
+		},
+	}
+
+	if strings.Contains(config.Tag, "{{") {
+		tmpl, err := template.New("tag").Option("missingkey=zero").Parse(config.Tag)
+		if err != nil {
+			return nil, err
+		}
+		f.tag = tmpl
+	}
+
+	return f, nil
+}
+
+// Connect dials the server and starts the background sender.  A failed
+// connection will be retried when the next batch is sent.
+func (f *Fluent) Connect() error {
+	err := f.dial()
+
+	f.Lock()
+	f.running = true
+	f.Unlock()
+	go f.run()
+
+	return err
+}
+
+// OnFailure sets the handler called with the messages that could not be sent.
+// It must be called before Connect.
+func (f *Fluent) OnFailure(fn output.FailureHandler) {
+	f.failed = fn
+}
+
+// Send adds the message to the current batch.  Full batches are handed off
+// to the background sender.  Send never blocks on the sender, if the send
+// queue is full the batch is failed.
+func (f *Fluent) Send(msg *output.Message) error {
+	tag, err := f.render(msg)
+	if err != nil {
+		return err
+	}
+
+	f.Lock()
+	f.batch = append(f.batch, entry{tag: tag, msg: msg})
+	if len(f.batch) < f.config.BatchSize {
+		f.Unlock()
+		return nil
+	}
+	batch := f.take()
+	f.Unlock()
+
+	select {
+	case f.batchCh <- batch:
+	default:
+		f.config.Logger.Info("send queue is full, failing batch", "count", len(batch))
+		f.fail(batch)
+	}
+	return nil
+}
+
+// fail passes the messages of the entries to the failure handler.
+func (f *Fluent) fail(entries []entry) {
+	if f.failed == nil {
+		return
+	}
+
+	msgs := make([]*output.Message, 0, len(entries))
+	for _, e := range entries {
+		msgs = append(msgs, e.msg)
+	}
+	f.failed(msgs)
+}
+
+// Close flushes any remaining entries, stops the background sender and
+// closes the connection.
+func (f *Fluent) Close() {
+	f.stopOnce.Do(func() {
+		close(f.stopChan)
+	})
+
+	f.Lock()
+	running := f.running
+	f.Unlock()
+
+	if !running {
+		return
+	}
+	<-f.doneChan
+
+	if f.conn != nil {
+		f.conn.Close()
+	}
+}
+
+// render returns the tag for the message.
+func (f *Fluent) render(msg *output.Message) (string, error) {
+	if f.tag == nil {
+		return f.config.Tag, nil
+	}
+
+	buf := f.bufPool.Get().(*bytes.Buffer)
+	defer f.bufPool.Put(buf)
+	buf.Reset()
+
+	if err := f.tag.Execute(buf, msg); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// take returns the current batch and starts a new one.  The lock must be
+// held by the caller.
+func (f *Fluent) take() []entry {
+	batch := f.batch
+	f.batch = make([]entry, 0, f.config.BatchSize)
+	return batch
+}
+
+func (f *Fluent) run() {
+	defer close(f.doneChan)
+
+	ticker := time.NewTicker(f.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case batch := <-f.batchCh:
+			f.write(batch)
+		case <-ticker.C:
+			f.flush()
+		case <-f.stopChan:
+			for len(f.batchCh) > 0 {
+				f.write(<-f.batchCh)
+			}
+			f.flush()
+			return
+		}
+	}
+}
+
+func (f *Fluent) flush() {
+	f.Lock()
+	batch := f.take()
+	f.Unlock()
+
+	f.write(batch)
+}
+
+// write groups the batch by tag and sends a PackedForward message for each
+// tag, retrying with an exponential backoff on failure until the output is
+// closed.  The entries of
+// messages that could not be sent are passed to the failure handler.
+func (f *Fluent) write(batch []entry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	tags := make([]string, 0)
+	streams := make(map[string][]byte)
+	entries := make(map[string][]entry)
+	for _, e := range batch {
+		if _, ok := streams[e.tag]; !ok {
+			tags = append(tags, e.tag)
+		}
+		streams[e.tag] = append(streams[e.tag], e.msg.Data...)
+		entries[e.tag] = append(entries[e.tag], e)
+	}
+
+	for _, tag := range tags {
+		msg, chunk, err := f.encode(tag, streams[tag], len(entries[tag]))
+		if err != nil {
+			f.config.Logger.Error(err, "unable to encode message", "tag", tag, "count", len(entries[tag]))
+			f.fail(entries[tag])
+			continue
+		}
+
+		for attempt := 0; ; attempt++ {
+			err := f.do(msg, chunk)
+			if err == nil {
+				break
+			}
+
+			if attempt >= f.config.MaxRetries {
+				f.config.Logger.Error(err, "unable to send message", "tag", tag, "count", len(entries[tag]), "attempts", attempt+1)
+				f.fail(entries[tag])
+				break
+			}
+
+			wait := output.Backoff(attempt)
+			f.config.Logger.V(8).Info("retrying message", "error", err.Error(), "wait", wait)
+			if !output.Wait(wait, f.stopChan) {
+				f.config.Logger.Error(err, "output closed while retrying message", "tag", tag, "count", len(entries[tag]), "attempts", attempt+1)
+				f.fail(entries[tag])
+				break
+			}
+		}
+	}
+}
+
+// encode builds a PackedForward message, [tag, entries, option], returning
+// the message and the chunk id that the server will acknowledge.
+func (f *Fluent) encode(tag string, stream []byte, count int) ([]byte, string, error) {
+	var chunk string
+	if f.config.RequireAck {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, "", err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+	}
+
+	b := make([]byte, 0, len(stream)+len(tag)+64)
+	b = msgp.AppendArrayHeader(b, 3)
+	b = msgp.AppendString(b, tag)
+	b = msgp.AppendBytes(b, stream)
+
+	if chunk != "" {
+		b = msgp.AppendMapHeader(b, 2)
+		b = msgp.AppendString(b, "chunk")
+		b = msgp.AppendString(b, chunk)
+	} else {
+		b = msgp.AppendMapHeader(b, 1)
+	}
+	b = msgp.AppendString(b, "size")
+	b = msgp.AppendInt(b, count)
+
+	return b, chunk, nil
+}
+
+// do writes a single message and waits for the acknowledgement if one was
+// requested.  The connection is dropped on any error so it will be
+// reestablished on the next attempt.
+func (f *Fluent) do(msg []byte, chunk string) (err error) {
+	if f.conn == nil {
+		if err := f.dial(); err != nil {
+			return err
+		}
+	}
+
+	defer func() {
+		if err != nil {
+			f.conn.Close()
+			f.conn = nil
+		}
+	}()
+
+	if err := f.conn.SetDeadline(time.Now().Add(f.config.Timeout)); err != nil {
+		return err
+	}
+
+	if _, err := f.conn.Write(msg); err != nil {
+		return err
+	}
+
+	if chunk == "" {
+		return nil
+	}
+
+	ack, err := f.ack()
+	if err != nil {
+		return err
+	}
+
+	if ack != chunk {
+		return fmt.Errorf("unexpected ack: %s", ack)
+	}
+
+	return nil
+}
+
+// ack reads the acknowledgement response, {"ack": chunk}, from the server.
+func (f *Fluent) ack() (string, error) {
+	size, err := f.reader.ReadMapHeader()
+	if err != nil {
+		return "", err
+	}
+
+	var ack string
+	for i := uint32(0); i < size; i++ {
+		key, err := f.reader.ReadString()
+		if err != nil {
+			return "", err
+		}
+
+		if key != "ack" {
+			if err := f.reader.Skip(); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if ack, err = f.reader.ReadString(); err != nil {
+			return "", err
+		}
+	}
+
+	return ack, nil
+}
+
+// dial connects to the server.
+func (f *Fluent) dial() error {
+	dialer := &net.Dialer{Timeout: f.config.Timeout}
+
+	var conn net.Conn
+	var err error
+	if f.config.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", f.config.Address, f.config.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", f.config.Address)
+	}
+	if err != nil {
+		return err
+	}
+
+	f.conn = conn
+	f.reader = msgp.NewReader(conn)
+	return nil
+}
+
+var _ output.Output = &Fluent{}
+var _ output.FailureReporter = &Fluent{}
@@ -0,0 +1,310 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/output"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// DefaultContentType is used when a content type header has not been
+	// configured.  Batches are sent as newline delimited encoded metrics.
+	DefaultContentType string = "application/x-ndjson"
+
+	// queueSize is the number of full batches that can be waiting to be sent.
+	queueSize int = 8
+)
+
+// Config represents the configuration for the http output.
+type Config struct {
+	// URL is the endpoint that batches are sent to.
+	URL string
+	// Method is the http method used for requests.
+	Method string
+	// Headers are added to every request.
+	Headers map[string]string
+	// Gzip enables compression of the request body.
+	Gzip bool
+	// BatchSize is the maximum number of metrics in a request.
+	BatchSize int
+	// FlushInterval is the maximum time a partial batch is held.
+	FlushInterval time.Duration
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// Timeout is the timeout for a single request.
+	Timeout time.Duration
+	// TLS is the optional TLS configuration for the client.
+	TLS *tls.Config
+	// Logger is used to report failed requests.
+	Logger logr.Logger
+}
+
+// HTTP is an output that batches encoded metrics and pushes them to an http
+// endpoint.  Batches are sent in the background so sending a metric never
+// blocks on the endpoint.
+type HTTP struct {
+	config  Config
+	client  *http.Client
+	batch   []*output.Message
+	batchCh chan []*output.Message
+	failed  output.FailureHandler
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	doneChan chan struct{}
+	sync.Mutex
+}
+
+// New returns a new http output.
+func New(config Config) *HTTP {
+	headers := make(map[string]string, len(config.Headers)+1)
+	for k, v := range config.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+
+	if _, ok := headers["Content-Type"]; !ok {
+		headers["Content-Type"] = DefaultContentType
+	}
+	config.Headers = headers
+
+	return &HTTP{
+		config:   config,
+		batch:    make([]*output.Message, 0, config.BatchSize),
+		batchCh:  make(chan []*output.Message, queueSize),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+}
+
+// Connect creates the client and starts the background sender.
+func (h *HTTP) Connect() error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = h.config.TLS
+
+	h.client = &http.Client{
+		Timeout:   h.config.Timeout,
+		Transport: transport,
+	}
+
+	go h.run()
+	return nil
+}
+
+// OnFailure sets the handler called with the messages of batches that could
+// not be delivered.  It must be called before Connect.
+func (h *HTTP) OnFailure(fn output.FailureHandler) {
+	h.failed = fn
+}
+
+// Send adds the message to the current batch.  Full batches are handed off
+// to the background sender.  Send never blocks on the sender, if the send
+// queue is full the batch is failed.
+func (h *HTTP) Send(msg *output.Message) error {
+	h.Lock()
+	h.batch = append(h.batch, msg)
+	if len(h.batch) < h.config.BatchSize {
+		h.Unlock()
+		return nil
+	}
+	batch := h.take()
+	h.Unlock()
+
+	select {
+	case h.batchCh <- batch:
+	default:
+		h.config.Logger.Info("send queue is full, failing batch", "count", len(batch))
+		h.fail(batch)
+	}
+	return nil
+}
+
+// Close flushes any remaining metrics and stops the background sender.  The
+// queued batches are sent once without retrying and any that fail are passed
+// to the failure handler.
+func (h *HTTP) Close() {
+	h.stopOnce.Do(func() {
+		close(h.stopChan)
+	})
+
+	if h.client != nil {
+		<-h.doneChan
+	}
+}
+
+// take returns the current batch and starts a new one.  The lock must be
+// held by the caller.
+func (h *HTTP) take() []*output.Message {
+	batch := h.batch
+	h.batch = make([]*output.Message, 0, h.config.BatchSize)
+	return batch
+}
+
+func (h *HTTP) run() {
+	defer close(h.doneChan)
+
+	ticker := time.NewTicker(h.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case batch := <-h.batchCh:
+			h.write(batch)
+		case <-ticker.C:
+			h.flush()
+		case <-h.stopChan:
+			for len(h.batchCh) > 0 {
+				h.write(<-h.batchCh)
+			}
+			h.flush()
+			return
+		}
+	}
+}
+
+func (h *HTTP) flush() {
+	h.Lock()
+	batch := h.take()
+	h.Unlock()
+
+	h.write(batch)
+}
+
+// write sends the batch to the endpoint retrying on connection errors, 429,
+// and 5xx responses with an exponential backoff.  Retry-After headers sent by
+// the server take precedence over the backoff.  The retries stop when the
+// output is closed.  Batches that can't be sent are passed to the failure
+// handler.
+func (h *HTTP) write(batch []*output.Message) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := h.encode(batch)
+	if err != nil {
+		h.config.Logger.Error(err, "unable to encode batch", "count", len(batch))
+		h.fail(batch)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		wait, retry, err := h.do(body)
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt >= h.config.MaxRetries {
+			h.config.Logger.Error(err, "unable to send batch", "count", len(batch), "attempts", attempt+1)
+			h.fail(batch)
+			return
+		}
+
+		if wait == 0 {
+			wait = output.Backoff(attempt)
+		}
+
+		h.config.Logger.V(8).Info("retrying batch", "error", err.Error(), "wait", wait)
+		if !output.Wait(wait, h.stopChan) {
+			h.config.Logger.Error(err, "output closed while retrying batch", "count", len(batch), "attempts", attempt+1)
+			h.fail(batch)
+			return
+		}
+	}
+}
+
+func (h *HTTP) fail(batch []*output.Message) {
+	if h.failed != nil {
+		h.failed(batch)
+	}
+}
+
+// do sends a single request.  It returns the time the server asked us to wait,
+// whether or not the request can be retried and any error.
+func (h *HTTP) do(body []byte) (time.Duration, bool, error) {
+	req, err := http.NewRequest(h.config.Method, h.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	for k, v := range h.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if h.config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+
+	err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if output.Retryable(resp.StatusCode) {
+		return output.RetryAfter(resp.Header.Get("Retry-After")), true, err
+	}
+
+	return 0, false, err
+}
+
+// encode joins the batch into a newline delimited body, compressing it if
+// gzip has been enabled.
+func (h *HTTP) encode(batch []*output.Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if h.config.Gzip {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+
+	for _, msg := range batch {
+		if _, err := w.Write(msg.Data); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte("\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+var _ output.Output = &HTTP{}
+var _ output.FailureReporter = &HTTP{}
@@ -0,0 +1,136 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/output"
+	"github.com/go-logr/logr"
+)
+
+func TestSendDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	h := New(Config{
+		URL:           srv.URL,
+		Method:        http.MethodPost,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		Timeout:       5 * time.Second,
+		Logger:        logr.Discard(),
+	})
+
+	var mu sync.Mutex
+	var failed int
+	h.OnFailure(func(msgs []*output.Message) {
+		mu.Lock()
+		failed += len(msgs)
+		mu.Unlock()
+	})
+
+	if err := h.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sender is stuck on the first request, so the queue fills and
+	// further batches fail instead of blocking.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < queueSize*4; i++ {
+			_ = h.Send(&output.Message{Data: []byte("{}")})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("send blocked on the sender")
+	}
+
+	close(release)
+	h.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if failed == 0 {
+		t.Fatal("expected batches to fail once the queue was full")
+	}
+}
+
+func TestCloseInterruptsRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	h := New(Config{
+		URL:           srv.URL,
+		Method:        http.MethodPost,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		MaxRetries:    10,
+		Timeout:       5 * time.Second,
+		Logger:        logr.Discard(),
+	})
+
+	failed := make(chan int, 1)
+	h.OnFailure(func(msgs []*output.Message) {
+		failed <- len(msgs)
+	})
+
+	if err := h.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Send(&output.Message{Data: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Give the sender time to make the first request and start waiting for
+	// the hour long retry.
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		h.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close waited for the retries")
+	}
+
+	select {
+	case n := <-failed:
+		if n != 1 {
+			t.Errorf("expected 1 failed message, got %d", n)
+		}
+	default:
+		t.Fatal("expected the batch to be failed when closed")
+	}
+}
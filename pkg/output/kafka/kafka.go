@@ -0,0 +1,243 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/output"
+	"github.com/go-logr/logr"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// ErrNotConnected is returned when sending before the writer has been created.
+var ErrNotConnected = errors.New("kafka writer is not connected")
+
+// PartitionKey is the strategy used to generate message keys.
+type PartitionKey string
+
+const (
+	// PartitionKeyNone does not set a key and messages are distributed across
+	// all partitions.
+	PartitionKeyNone PartitionKey = "none"
+	// PartitionKeyName uses the metric name as the key.
+	PartitionKeyName PartitionKey = "name"
+	// PartitionKeySeries uses a hash of the metric name and tags as the key.
+	PartitionKeySeries PartitionKey = "series"
+)
+
+// Config represents the producer configuration for the kafka output.
+type Config struct {
+	// Brokers is the list of bootstrap brokers.
+	Brokers []string
+	// Topic is the topic that messages are produced to.
+	Topic string
+	// Acks is the required acknowledgements: none, leader, or all.
+	Acks string
+	// Compression is the compression codec: none, gzip, snappy, lz4, or zstd.
+	Compression string
+	// PartitionKey is the strategy used to generate message keys.
+	PartitionKey PartitionKey
+	// BatchSize is the maximum number of messages in a batch.
+	BatchSize int
+	// BatchTimeout is the maximum time a partial batch is held.
+	BatchTimeout time.Duration
+	// SASLMechanism is the SASL mechanism: plain, scram-sha-256, or scram-sha-512.
+	// SASL is disabled if it is empty.
+	SASLMechanism string
+	// Username and Password are the SASL credentials.
+	Username string
+	Password string
+	// TLS is the optional TLS configuration for the broker connections.
+	TLS *tls.Config
+	// Logger is used to report asynchronous write errors.
+	Logger logr.Logger
+}
+
+type Kafka struct {
+	config Config
+	writer *kafka.Writer
+	failed output.FailureHandler
+}
+
+// New returns a new kafka output.
+func New(config Config) *Kafka {
+	return &Kafka{
+		config: config,
+	}
+}
+
+// OnFailure sets the handler called with the messages that the writer failed
+// to deliver.  It must be called before Connect.
+func (k *Kafka) OnFailure(fn output.FailureHandler) {
+	k.failed = fn
+}
+
+// Connect creates the writer.  Connections to the brokers are established
+// lazily on the first write.
+func (k *Kafka) Connect() error {
+	acks, err := requiredAcks(k.config.Acks)
+	if err != nil {
+		return err
+	}
+
+	compression, err := compressionCodec(k.config.Compression)
+	if err != nil {
+		return err
+	}
+
+	mechanism, err := saslMechanism(k.config.SASLMechanism, k.config.Username, k.config.Password)
+	if err != nil {
+		return err
+	}
+
+	log := k.config.Logger
+
+	k.writer = &kafka.Writer{
+		Addr:  kafka.TCP(k.config.Brokers...),
+		Topic: k.config.Topic,
+		// Use the same partitioner as the java client so keys are assigned to the
+		// same partitions as other producers.
+		Balancer:     &kafka.Murmur2Balancer{},
+		RequiredAcks: acks,
+		Compression:  compression,
+		BatchSize:    k.config.BatchSize,
+		BatchTimeout: k.config.BatchTimeout,
+		Async:        true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err == nil {
+				return
+			}
+
+			log.Error(err, "failed to write messages", "count", len(messages))
+			if k.failed == nil {
+				return
+			}
+
+			msgs := make([]*output.Message, 0, len(messages))
+			for _, m := range messages {
+				if msg, ok := m.WriterData.(*output.Message); ok {
+					msgs = append(msgs, msg)
+				}
+			}
+			k.failed(msgs)
+		},
+		Transport: &kafka.Transport{
+			ClientID: "strata-collector",
+			TLS:      k.config.TLS,
+			SASL:     mechanism,
+		},
+	}
+
+	return nil
+}
+
+// Send queues the message for delivery.  Writes are asynchronous so delivery
+// errors are reported through the failure handler.
+func (k *Kafka) Send(msg *output.Message) error {
+	if k.writer == nil {
+		return ErrNotConnected
+	}
+
+	return k.writer.WriteMessages(context.Background(), kafka.Message{
+		Key:        k.key(msg),
+		Value:      msg.Data,
+		WriterData: msg,
+	})
+}
+
+// key returns the message key based on the partition key strategy.
+func (k *Kafka) key(msg *output.Message) []byte {
+	switch k.config.PartitionKey {
+	case PartitionKeyName:
+		return []byte(msg.Metric.Name)
+	case PartitionKeySeries:
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, msg.Metric.Hash())
+		return key
+	default:
+		return nil
+	}
+}
+
+// Close flushes any pending messages and closes the writer.
+func (k *Kafka) Close() {
+	if k.writer == nil {
+		return
+	}
+
+	if err := k.writer.Close(); err != nil {
+		k.config.Logger.Error(err, "unable to close kafka writer")
+	}
+}
+
+func requiredAcks(acks string) (kafka.RequiredAcks, error) {
+	switch acks {
+	case "none":
+		return kafka.RequireNone, nil
+	case "leader":
+		return kafka.RequireOne, nil
+	case "all", "":
+		return kafka.RequireAll, nil
+	default:
+		return kafka.RequireAll, fmt.Errorf("invalid acks: %s", acks)
+	}
+}
+
+func compressionCodec(codec string) (kafka.Compression, error) {
+	switch codec {
+	case "none", "":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("invalid compression codec: %s", codec)
+	}
+}
+
+func saslMechanism(mechanism, username, password string) (sasl.Mechanism, error) {
+	switch mechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{
+			Username: username,
+			Password: password,
+		}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, username, password)
+	default:
+		return nil, fmt.Errorf("invalid sasl mechanism: %s", mechanism)
+	}
+}
+
+var _ output.Output = &Kafka{}
+var _ output.FailureReporter = &Kafka{}
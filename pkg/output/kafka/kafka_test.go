@@ -0,0 +1,290 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/output"
+	"github.com/go-logr/logr"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+)
+
+// record is a record received by the broker.
+type record struct {
+	key   []byte
+	value []byte
+}
+
+// broker is a single node kafka protocol stand-in that answers the api
+// versions, metadata and produce requests made by the writer.  Produce
+// requests are answered with errorCode.
+type broker struct {
+	t         *testing.T
+	listener  net.Listener
+	topic     string
+	errorCode int16
+
+	records []record
+	sync.Mutex
+}
+
+func newBroker(t *testing.T, topic string, errorCode int16) *broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &broker{
+		t:         t,
+		listener:  l,
+		topic:     topic,
+		errorCode: errorCode,
+	}
+	go b.serve()
+	t.Cleanup(func() { l.Close() })
+
+	return b
+}
+
+func (b *broker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *broker) received() []record {
+	b.Lock()
+	defer b.Unlock()
+	return append([]record(nil), b.records...)
+}
+
+func (b *broker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *broker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		version, correlationID, _, msg, err := protocol.ReadRequest(r)
+		if err != nil {
+			return
+		}
+
+		var resp protocol.Message
+		switch req := msg.(type) {
+		case *apiversions.Request:
+			resp = &apiversions.Response{
+				ApiKeys: []apiversions.ApiKeyResponse{
+					{ApiKey: int16(protocol.Produce), MinVersion: 0, MaxVersion: 8},
+					{ApiKey: int16(protocol.Metadata), MinVersion: 0, MaxVersion: 8},
+					{ApiKey: int16(protocol.ApiVersions), MinVersion: 0, MaxVersion: 2},
+				},
+			}
+		case *metadata.Request:
+			resp = b.metadata()
+		case *produce.Request:
+			resp = b.produce(req)
+		default:
+			b.t.Errorf("unexpected request: %T", msg)
+			return
+		}
+
+		if err := protocol.WriteResponse(conn, version, correlationID, resp); err != nil {
+			return
+		}
+	}
+}
+
+func (b *broker) metadata() *metadata.Response {
+	host, port, _ := net.SplitHostPort(b.addr())
+	p, _ := strconv.Atoi(port)
+
+	return &metadata.Response{
+		Brokers: []metadata.ResponseBroker{
+			{NodeID: 0, Host: host, Port: int32(p)},
+		},
+		Topics: []metadata.ResponseTopic{
+			{
+				Name: b.topic,
+				Partitions: []metadata.ResponsePartition{
+					{PartitionIndex: 0, LeaderID: 0, ReplicaNodes: []int32{0}, IsrNodes: []int32{0}},
+				},
+			},
+		},
+	}
+}
+
+func (b *broker) produce(req *produce.Request) *produce.Response {
+	resp := &produce.Response{}
+	for _, topic := range req.Topics {
+		rt := produce.ResponseTopic{Topic: topic.Topic}
+		for _, partition := range topic.Partitions {
+			if b.errorCode == 0 {
+				b.store(partition.RecordSet.Records)
+			}
+			rt.Partitions = append(rt.Partitions, produce.ResponsePartition{
+				Partition: partition.Partition,
+				ErrorCode: b.errorCode,
+			})
+		}
+		resp.Topics = append(resp.Topics, rt)
+	}
+	return resp
+}
+
+func (b *broker) store(records protocol.RecordReader) {
+	b.Lock()
+	defer b.Unlock()
+
+	for {
+		rec, err := records.ReadRecord()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				b.t.Errorf("unable to read record: %v", err)
+			}
+			return
+		}
+
+		key, _ := protocol.ReadAll(rec.Key)
+		value, _ := protocol.ReadAll(rec.Value)
+		b.records = append(b.records, record{key: key, value: value})
+	}
+}
+
+func testMessages(n int) []*output.Message {
+	msgs := make([]*output.Message, n)
+	for i := range msgs {
+		m := &metric.Metric{
+			Name:      "requests_total",
+			Tags:      map[string]string{"code": strconv.Itoa(i)},
+			Value:     float64(i),
+			Timestamp: time.Now(),
+		}
+		msgs[i] = &output.Message{
+			Data:   []byte("requests_total{code=\"" + strconv.Itoa(i) + "\"}"),
+			Metric: m,
+		}
+	}
+	return msgs
+}
+
+func testKafka(addr string) *Kafka {
+	return New(Config{
+		Brokers:      []string{addr},
+		Topic:        "metrics",
+		Acks:         "all",
+		PartitionKey: PartitionKeySeries,
+		BatchSize:    10,
+		BatchTimeout: 10 * time.Millisecond,
+		Logger:       logr.Discard(),
+	})
+}
+
+func TestSend(t *testing.T) {
+	b := newBroker(t, "metrics", 0)
+	k := testKafka(b.addr())
+	if err := k.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := testMessages(25)
+	for _, msg := range msgs {
+		if err := k.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k.Close()
+
+	records := b.received()
+	if len(records) != len(msgs) {
+		t.Fatalf("expected %d records, got %d", len(msgs), len(records))
+	}
+
+	values := make(map[string][]byte, len(records))
+	for _, r := range records {
+		values[string(r.value)] = r.key
+	}
+
+	for _, msg := range msgs {
+		key, ok := values[string(msg.Data)]
+		if !ok {
+			t.Fatalf("missing record %s", msg.Data)
+		}
+		if string(key) != string(k.key(msg)) {
+			t.Errorf("expected the series key for %s", msg.Data)
+		}
+	}
+}
+
+func TestSendFailure(t *testing.T) {
+	// MESSAGE_TOO_LARGE is not retried by the writer.
+	b := newBroker(t, "metrics", 10)
+	k := testKafka(b.addr())
+
+	var failed []*output.Message
+	var mu sync.Mutex
+	k.OnFailure(func(msgs []*output.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, msgs...)
+	})
+
+	if err := k.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := testMessages(5)
+	for _, msg := range msgs {
+		if err := k.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != len(msgs) {
+		t.Fatalf("expected %d failed messages, got %d", len(msgs), len(failed))
+	}
+}
+
+func TestSendNotConnected(t *testing.T) {
+	k := New(Config{Acks: "invalid", Logger: logr.Discard()})
+	if err := k.Connect(); err == nil {
+		t.Fatal("expected an error connecting with invalid acks")
+	}
+
+	if err := k.Send(testMessages(1)[0]); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected, got %v", err)
+	}
+}
@@ -15,32 +15,242 @@
 package nats
 
 import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
 	"ctx.sh/strata-collector/pkg/output"
+	"github.com/go-logr/logr"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
 )
 
-type Nats struct {
+var (
+	// ErrInvalidSubject is returned when a rendered subject has an empty
+	// token and can't be published to.
+	ErrInvalidSubject = errors.New("invalid subject")
+
+	// subjectReplacer replaces the characters that are not allowed in the
+	// tokens of a subject.  Whitespace separates the protocol fields and the
+	// wildcards are only valid when subscribing.
+	subjectReplacer = strings.NewReplacer(
+		" ", "_",
+		"\t", "_",
+		"\r", "_",
+		"\n", "_",
+		"*", "_",
+		">", "_",
+	)
+)
+
+// Config represents the connection configuration for the nats output.
+type Config struct {
+	// Servers is the list of server urls used to connect to the cluster.
+	Servers []string
+	// Subject is the subject template that messages are published to.
 	Subject string
+	// Name is the connection name reported to the server.
+	Name string
+	// Username and Password are used for user/password authentication.
+	Username string
+	Password string
+	// Token is used for token authentication.
+	Token string
+	// NKeySeed is used for nkey authentication.
+	NKeySeed string
+	// Credentials is the contents of a decorated user credentials file.
+	Credentials string
+	// TLS is the optional TLS configuration for the connection.
+	TLS *tls.Config
+	// MaxReconnects is the number of reconnect attempts.  Negative values
+	// will retry forever.
+	MaxReconnects int
+	// ReconnectWait is the time to wait between reconnect attempts.
+	ReconnectWait time.Duration
+	// ConnectTimeout is the dial timeout for each connection attempt.
+	ConnectTimeout time.Duration
+	// DrainTimeout is the time allowed to flush pending messages on close.
+	DrainTimeout time.Duration
+	// Logger is used to report connection state changes.
+	Logger logr.Logger
+}
+
+type Nats struct {
+	config  Config
+	subject *template.Template
 	conn    *nats.Conn
+	closed  chan struct{}
+	bufPool sync.Pool
 }
 
-func New() *Nats {
-	return &Nats{}
+// New returns a new nats output.  The subject is parsed as a template and
+// an error is returned if it is not valid.
+func New(config Config) (*Nats, error) {
+	n := &Nats{
+		config: config,
+		closed: make(chan struct{}),
+		bufPool: sync.Pool{
+			New: func() any { return new(bytes.Buffer) },
+		},
+	}
+
+	// Only use the template when there is something to render, otherwise we
+	// publish directly to the subject.
+	if strings.Contains(config.Subject, "{{") {
+		tmpl, err := template.New("subject").Option("missingkey=zero").Parse(config.Subject)
+		if err != nil {
+			return nil, err
+		}
+		n.subject = tmpl
+	}
+
+	return n, nil
 }
 
 func (n *Nats) Connect() (err error) {
-	n.conn, err = nats.Connect(nats.DefaultURL)
+	opts, err := n.options()
+	if err != nil {
+		return err
+	}
+
+	n.conn, err = nats.Connect(strings.Join(n.config.Servers, ","), opts...)
 	return
 }
 
-func (n *Nats) Send(data []byte) error {
-	return n.conn.Publish(n.Subject, data)
+func (n *Nats) options() ([]nats.Option, error) {
+	log := n.config.Logger
+
+	opts := []nats.Option{
+		nats.Name(n.config.Name),
+		nats.MaxReconnects(n.config.MaxReconnects),
+		nats.ReconnectWait(n.config.ReconnectWait),
+		nats.Timeout(n.config.ConnectTimeout),
+		nats.DrainTimeout(n.config.DrainTimeout),
+		// Allow the collector to start when the servers are not available.  The
+		// connection will continue to be retried in the background and messages
+		// will be buffered until the reconnect buffer fills up.
+		nats.RetryOnFailedConnect(true),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Error(err, "disconnected from nats server")
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			log.Info("reconnected to nats server", "server", c.ConnectedUrlRedacted())
+		}),
+		nats.ClosedHandler(func(_ *nats.Conn) {
+			close(n.closed)
+		}),
+	}
+
+	if n.config.TLS != nil {
+		opts = append(opts, nats.Secure(n.config.TLS))
+	}
+
+	switch {
+	case n.config.Credentials != "":
+		jwt, err := nkeys.ParseDecoratedJWT([]byte(n.config.Credentials))
+		if err != nil {
+			return nil, err
+		}
+		kp, err := nkeys.ParseDecoratedUserNKey([]byte(n.config.Credentials))
+		if err != nil {
+			return nil, err
+		}
+		seed, err := kp.Seed()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.UserJWTAndSeed(jwt, string(seed)))
+	case n.config.NKeySeed != "":
+		kp, err := nkeys.FromSeed([]byte(n.config.NKeySeed))
+		if err != nil {
+			return nil, err
+		}
+		pub, err := kp.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.Nkey(pub, kp.Sign))
+	case n.config.Token != "":
+		opts = append(opts, nats.Token(n.config.Token))
+	case n.config.Username != "":
+		opts = append(opts, nats.UserInfo(n.config.Username, n.config.Password))
+	}
+
+	return opts, nil
 }
 
+func (n *Nats) Send(msg *output.Message) error {
+	subject, err := n.render(msg)
+	if err != nil {
+		return err
+	}
+
+	return n.conn.Publish(subject, msg.Data)
+}
+
+// SendBatch publishes the batch as a single message.  The subject template is
+// rendered using the batch, so it may only refer to the resource.
+func (n *Nats) SendBatch(b *output.Batch) error {
+	subject, err := n.render(b)
+	if err != nil {
+		return err
+	}
+
+	return n.conn.Publish(subject, b.Data)
+}
+
+// render returns the subject for a message or batch.
+func (n *Nats) render(data any) (string, error) {
+	if n.subject == nil {
+		return n.config.Subject, nil
+	}
+
+	buf := n.bufPool.Get().(*bytes.Buffer)
+	defer n.bufPool.Put(buf)
+	buf.Reset()
+
+	if err := n.subject.Execute(buf, data); err != nil {
+		return "", err
+	}
+
+	// The rendered values come from the scraped metrics and resources, so
+	// they are sanitized rather than trusted to be valid tokens.
+	subject := subjectReplacer.Replace(buf.String())
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" {
+			return "", fmt.Errorf("%w: %q", ErrInvalidSubject, subject)
+		}
+	}
+
+	return subject, nil
+}
+
+// Close drains the connection, allowing any buffered messages to be flushed
+// to the server before the connection is closed.  If the connection can't be
+// drained or the drain does not complete before the drain timeout, the
+// connection is closed immediately.
 func (n *Nats) Close() {
-	// TODO: Drain? Does this wait for consumers to finish even though we are a publisher?
-	// n.conn.Drain()
-	n.conn.Close()
+	if n.conn == nil {
+		return
+	}
+
+	if err := n.conn.Drain(); err != nil {
+		n.conn.Close()
+		return
+	}
+
+	select {
+	case <-n.closed:
+	case <-time.After(n.config.DrainTimeout):
+		n.conn.Close()
+	}
 }
 
-var _ output.Output = &Nats{}
+var _ output.BatchOutput = &Nats{}
@@ -0,0 +1,61 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/output"
+	"ctx.sh/strata-collector/pkg/resource"
+)
+
+func TestRender(t *testing.T) {
+	n, err := New(Config{Subject: "strata.{{.Resource.Namespace}}.{{.Metric.Name}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		metric    string
+		expected  string
+		err       error
+	}{
+		{"plain", "default", "up", "strata.default.up", nil},
+		{"whitespace", "default", "up now\tand\nthen", "strata.default.up_now_and_then", nil},
+		{"wildcards", "default", "a*b>", "strata.default.a_b_", nil},
+		{"empty token", "", "up", "", ErrInvalidSubject},
+		{"dotted", "default", "up.", "", ErrInvalidSubject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := n.render(&output.Message{
+				Metric:   metric.New(time.Now(), tt.metric, 1, nil),
+				Resource: resource.Metadata{Namespace: tt.namespace},
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if subject != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,565 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/output"
+	"ctx.sh/strata-collector/pkg/resource"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	// ScopeName is the instrumentation scope reported for all metrics.
+	ScopeName string = "strata-collector"
+)
+
+// noRecordedValue marks the data points of stale series, which is the OTLP
+// equivalent of the prometheus staleness marker.
+var noRecordedValue = uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)
+
+// entry is a metric along with the metadata of the resource that it was
+// collected from.
+type entry struct {
+	metric   *metric.Metric
+	resource resource.Metadata
+	msg      *output.Message
+}
+
+// familyName returns the name of the family that the metric belongs to.  The
+// flattened series of a histogram or summary share the family name.
+func familyName(m *metric.Metric) string {
+	switch {
+	case m.Histogram != nil || m.Summary != nil:
+		return m.Name
+	case m.Type == metric.Histogram:
+		name, _ := family(m, metric.BucketLabel, metric.BucketSuffix)
+		return name
+	case m.Type == metric.Summary:
+		name, _ := family(m, metric.QuantileLabel, "")
+		return name
+	default:
+		return m.Name
+	}
+}
+
+// resourceAttributes maps the resource metadata to the OTLP kubernetes semantic
+// conventions.
+func resourceAttributes(md resource.Metadata) []*commonpb.KeyValue {
+	attrs := make([]*commonpb.KeyValue, 0, 2)
+
+	if md.Namespace != "" {
+		attrs = append(attrs, stringAttr("k8s.namespace.name", md.Namespace))
+	}
+
+	if md.Name != "" {
+		switch md.Kind {
+		case "Pod":
+			attrs = append(attrs, stringAttr("k8s.pod.name", md.Name))
+		case "Service":
+			attrs = append(attrs, stringAttr("k8s.service.name", md.Name))
+		default:
+			attrs = append(attrs, stringAttr("k8s.object.name", md.Name))
+		}
+	}
+
+	if md.Container != "" {
+		attrs = append(attrs, stringAttr("k8s.container.name", md.Container))
+	}
+
+	if md.Kind != "" {
+		attrs = append(attrs, stringAttr("k8s.object.kind", md.Kind))
+	}
+
+	return attrs
+}
+
+// convert groups the entries by resource and converts them to OTLP resource
+// metrics.  Flattened histogram buckets and summary quantiles belonging to the
+// same series are merged back into a single data point.  If metadata is true,
+// the description and unit are set from the metric metadata and if exemplars
+// is true, the exemplars are added to the sum and histogram data points.
+func convert(entries []entry, metadata bool, exemplars bool) []*metricspb.ResourceMetrics {
+	order := make([]resource.Metadata, 0)
+	grouped := make(map[resource.Metadata][]*metric.Metric)
+
+	for _, e := range entries {
+		if _, ok := grouped[e.resource]; !ok {
+			order = append(order, e.resource)
+		}
+		grouped[e.resource] = append(grouped[e.resource], e.metric)
+	}
+
+	rms := make([]*metricspb.ResourceMetrics, 0, len(order))
+	for _, md := range order {
+		rms = append(rms, &metricspb.ResourceMetrics{
+			Resource: &resourcepb.Resource{
+				Attributes: resourceAttributes(md),
+			},
+			ScopeMetrics: []*metricspb.ScopeMetrics{
+				{
+					Scope: &commonpb.InstrumentationScope{
+						Name: ScopeName,
+					},
+					Metrics: convertMetrics(grouped[md], metadata, exemplars),
+				},
+			},
+		})
+	}
+
+	return rms
+}
+
+// convertMetrics converts the metrics for a single resource.  The bucket, sum
+// and count series of histograms and the quantile, sum and count series of
+// summaries are merged back into a single data point.  Histograms and
+// summaries with a structured value are mapped directly.
+func convertMetrics(metrics []*metric.Metric, metadata bool, exemplars bool) []*metricspb.Metric {
+	order := make([]string, 0)
+	byName := make(map[string]*metricspb.Metric)
+	histograms := make(map[string]*histogram)
+	summaries := make(map[string]*metricspb.SummaryDataPoint)
+
+	get := func(name string, m *metric.Metric) *metricspb.Metric {
+		if out, ok := byName[name]; ok {
+			return out
+		}
+		out := newMetric(name, m.Type)
+		if metadata {
+			describe(out, m)
+		}
+		byName[name] = out
+		order = append(order, name)
+		return out
+	}
+
+	for _, m := range metrics {
+		ts := uint64(m.Timestamp.UnixNano())
+
+		// Native histograms map directly to exponential histograms.
+		if m.Histogram != nil && m.Histogram.Native != nil {
+			out, ok := byName[m.Name]
+			if !ok {
+				out = newExponentialMetric(m.Name)
+				if metadata {
+					describe(out, m)
+				}
+				byName[m.Name] = out
+				order = append(order, m.Name)
+			}
+			if data, ok := out.Data.(*metricspb.Metric_ExponentialHistogram); ok {
+				data.ExponentialHistogram.DataPoints = append(data.ExponentialHistogram.DataPoints, exponentialPoint(m, ts))
+			}
+			continue
+		}
+
+		switch m.Type {
+		case metric.Histogram:
+			name, suffix := family(m, metric.BucketLabel, metric.BucketSuffix)
+			if m.Histogram != nil {
+				name, suffix = m.Name, ""
+			}
+			data, ok := get(name, m).Data.(*metricspb.Metric_Histogram)
+			if !ok {
+				continue
+			}
+
+			key := seriesKey(name, m.Tags, metric.BucketLabel)
+			h, ok := histograms[key]
+			if !ok {
+				h = &histogram{
+					point: &metricspb.HistogramDataPoint{
+						Attributes:   attributes(m.Tags, metric.BucketLabel),
+						TimeUnixNano: ts,
+					},
+				}
+				histograms[key] = h
+				data.Histogram.DataPoints = append(data.Histogram.DataPoints, h.point)
+			}
+			if m.Stale {
+				h.point.Flags = noRecordedValue
+			}
+
+			switch {
+			case m.Histogram != nil:
+				for _, b := range m.Histogram.Buckets {
+					h.buckets = append(h.buckets, bucket{bound: b.UpperBound, count: b.Count})
+				}
+				sum := m.Histogram.Sum
+				h.point.Sum = &sum
+				if exemplars {
+					for _, b := range m.Histogram.Buckets {
+						if b.Exemplar != nil {
+							h.point.Exemplars = append(h.point.Exemplars, exemplar(b.Exemplar))
+						}
+					}
+				}
+				count := uint64(m.Histogram.Count)
+				h.count = &count
+			case suffix == metric.BucketSuffix:
+				bound, err := strconv.ParseFloat(m.Tags[metric.BucketLabel], 64)
+				if err != nil {
+					continue
+				}
+				h.buckets = append(h.buckets, bucket{bound: bound, count: m.Value})
+				if exemplars && m.Exemplar != nil {
+					h.point.Exemplars = append(h.point.Exemplars, exemplar(m.Exemplar))
+				}
+			case suffix == metric.SumSuffix:
+				sum := m.Value
+				h.point.Sum = &sum
+			case suffix == metric.CountSuffix:
+				count := uint64(m.Value)
+				h.count = &count
+			}
+		case metric.Summary:
+			name, suffix := family(m, metric.QuantileLabel, "")
+			if m.Summary != nil {
+				name, suffix = m.Name, ""
+			}
+			data, ok := get(name, m).Data.(*metricspb.Metric_Summary)
+			if !ok {
+				continue
+			}
+
+			key := seriesKey(name, m.Tags, metric.QuantileLabel)
+			point, ok := summaries[key]
+			if !ok {
+				point = &metricspb.SummaryDataPoint{
+					Attributes:   attributes(m.Tags, metric.QuantileLabel),
+					TimeUnixNano: ts,
+				}
+				summaries[key] = point
+				data.Summary.DataPoints = append(data.Summary.DataPoints, point)
+			}
+			if m.Stale {
+				point.Flags = noRecordedValue
+			}
+
+			switch {
+			case m.Summary != nil:
+				for _, q := range m.Summary.Quantiles {
+					point.QuantileValues = append(point.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+						Quantile: q.Quantile,
+						Value:    q.Value,
+					})
+				}
+				point.Sum = m.Summary.Sum
+				point.Count = uint64(m.Summary.Count)
+			case suffix == metric.SumSuffix:
+				point.Sum = m.Value
+			case suffix == metric.CountSuffix:
+				point.Count = uint64(m.Value)
+			default:
+				quantile, err := strconv.ParseFloat(m.Tags[metric.QuantileLabel], 64)
+				if err != nil {
+					continue
+				}
+				point.QuantileValues = append(point.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+					Quantile: quantile,
+					Value:    m.Value,
+				})
+			}
+		default:
+			switch data := get(m.Name, m).Data.(type) {
+			case *metricspb.Metric_Sum:
+				point := numberPoint(m, ts)
+				if exemplars && m.Exemplar != nil {
+					point.Exemplars = append(point.Exemplars, exemplar(m.Exemplar))
+				}
+				data.Sum.DataPoints = append(data.Sum.DataPoints, point)
+			case *metricspb.Metric_Gauge:
+				data.Gauge.DataPoints = append(data.Gauge.DataPoints, numberPoint(m, ts))
+			}
+		}
+	}
+
+	for _, h := range histograms {
+		h.finalize()
+	}
+
+	out := make([]*metricspb.Metric, 0, len(order))
+	for _, name := range order {
+		out = append(out, byName[name])
+	}
+
+	return out
+}
+
+// family returns the name of the histogram or summary that the series belongs
+// to and the suffix that was removed.  Series with the label are the buckets
+// or quantiles, all others are the sum or count series.
+func family(m *metric.Metric, label string, labelSuffix string) (string, string) {
+	if _, ok := m.Tags[label]; ok {
+		return strings.TrimSuffix(m.Name, labelSuffix), labelSuffix
+	}
+
+	for _, suffix := range []string{metric.SumSuffix, metric.CountSuffix} {
+		if strings.HasSuffix(m.Name, suffix) {
+			return strings.TrimSuffix(m.Name, suffix), suffix
+		}
+	}
+
+	return m.Name, ""
+}
+
+func newMetric(name string, t metric.MetricsType) *metricspb.Metric {
+	out := &metricspb.Metric{
+		Name: name,
+	}
+
+	switch t {
+	case metric.Counter:
+		out.Data = &metricspb.Metric_Sum{
+			Sum: &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			},
+		}
+	case metric.Histogram:
+		out.Data = &metricspb.Metric_Histogram{
+			Histogram: &metricspb.Histogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			},
+		}
+	case metric.Summary:
+		out.Data = &metricspb.Metric_Summary{
+			Summary: &metricspb.Summary{},
+		}
+	default:
+		out.Data = &metricspb.Metric_Gauge{
+			Gauge: &metricspb.Gauge{},
+		}
+	}
+
+	return out
+}
+
+func newExponentialMetric(name string) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: name,
+		Data: &metricspb.Metric_ExponentialHistogram{
+			ExponentialHistogram: &metricspb.ExponentialHistogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			},
+		},
+	}
+}
+
+// exponentialPoint converts a native histogram.  The prometheus schema is the
+// same as the OTLP scale, but prometheus buckets are upper inclusive so the
+// OTLP bucket index is one less than the prometheus index.
+func exponentialPoint(m *metric.Metric, ts uint64) *metricspb.ExponentialHistogramDataPoint {
+	h := m.Histogram
+	n := h.Native
+	sum := h.Sum
+
+	point := &metricspb.ExponentialHistogramDataPoint{
+		Attributes:    attributes(m.Tags, ""),
+		TimeUnixNano:  ts,
+		Count:         uint64(h.Count),
+		Sum:           &sum,
+		Scale:         n.Schema,
+		ZeroCount:     uint64(n.ZeroCount),
+		ZeroThreshold: n.ZeroThreshold,
+		Positive:      exponentialBuckets(n.PositiveSpans, n.PositiveCounts),
+		Negative:      exponentialBuckets(n.NegativeSpans, n.NegativeCounts),
+	}
+
+	if m.Stale {
+		point.Flags = noRecordedValue
+	}
+
+	return point
+}
+
+// exponentialBuckets converts the sparse prometheus buckets into the dense
+// OTLP buckets, filling the gaps between the spans with empty buckets.
+func exponentialBuckets(spans []metric.BucketSpan, counts []float64) *metricspb.ExponentialHistogramDataPoint_Buckets {
+	buckets := &metricspb.ExponentialHistogramDataPoint_Buckets{}
+	if len(spans) == 0 {
+		return buckets
+	}
+
+	buckets.Offset = spans[0].Offset - 1
+
+	var idx int
+	for i, span := range spans {
+		if i > 0 {
+			for j := int32(0); j < span.Offset; j++ {
+				buckets.BucketCounts = append(buckets.BucketCounts, 0)
+			}
+		}
+		for j := uint32(0); j < span.Length && idx < len(counts); j++ {
+			buckets.BucketCounts = append(buckets.BucketCounts, uint64(counts[idx]))
+			idx++
+		}
+	}
+
+	return buckets
+}
+
+// describe sets the description and unit from the metric metadata.
+func describe(out *metricspb.Metric, m *metric.Metric) {
+	if m.Metadata == nil {
+		return
+	}
+
+	out.Description = m.Metadata.Help
+	out.Unit = m.Metadata.Unit
+}
+
+// exemplar converts the exemplar.  The prometheus trace_id and span_id labels
+// are mapped to the OTLP trace and span ids when they are valid hex encoded
+// ids, all other labels are added as filtered attributes.
+func exemplar(e *metric.Exemplar) *metricspb.Exemplar {
+	out := &metricspb.Exemplar{
+		Value: &metricspb.Exemplar_AsDouble{
+			AsDouble: e.Value,
+		},
+	}
+
+	if e.Timestamp != nil {
+		out.TimeUnixNano = uint64(e.Timestamp.UnixNano())
+	}
+
+	keys := make([]string, 0, len(e.Labels))
+	for k := range e.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := e.Labels[k]
+		switch id, err := hex.DecodeString(v); {
+		case k == "trace_id" && err == nil && len(id) == 16:
+			out.TraceId = id
+		case k == "span_id" && err == nil && len(id) == 8:
+			out.SpanId = id
+		default:
+			out.FilteredAttributes = append(out.FilteredAttributes, stringAttr(k, v))
+		}
+	}
+
+	return out
+}
+
+func numberPoint(m *metric.Metric, ts uint64) *metricspb.NumberDataPoint {
+	point := &metricspb.NumberDataPoint{
+		Attributes:   attributes(m.Tags, ""),
+		TimeUnixNano: ts,
+		Value: &metricspb.NumberDataPoint_AsDouble{
+			AsDouble: m.Value,
+		},
+	}
+
+	if m.Stale {
+		point.Flags = noRecordedValue
+	}
+
+	return point
+}
+
+type bucket struct {
+	bound float64
+	count float64
+}
+
+type histogram struct {
+	point   *metricspb.HistogramDataPoint
+	buckets []bucket
+	count   *uint64
+}
+
+// finalize converts the cumulative prometheus buckets into the OTLP explicit
+// bounds and per bucket counts.  The count series is used as the total count,
+// falling back to the +Inf bucket if it was not seen.
+func (h *histogram) finalize() {
+	sort.Slice(h.buckets, func(i, j int) bool {
+		return h.buckets[i].bound < h.buckets[j].bound
+	})
+
+	var prev float64
+	for i, b := range h.buckets {
+		if i < len(h.buckets)-1 {
+			h.point.ExplicitBounds = append(h.point.ExplicitBounds, b.bound)
+		}
+		h.point.BucketCounts = append(h.point.BucketCounts, uint64(b.count-prev))
+		prev = b.count
+	}
+
+	h.point.Count = uint64(prev)
+	if h.count != nil {
+		h.point.Count = *h.count
+	}
+}
+
+// attributes converts the tags into OTLP attributes skipping the excluded tag.
+func attributes(tags map[string]string, exclude string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		if k != exclude {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	attrs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, stringAttr(k, tags[k]))
+	}
+
+	return attrs
+}
+
+// seriesKey returns a key identifying the series ignoring the excluded tag.
+func seriesKey(name string, tags map[string]string, exclude string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		if k != exclude {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, k := range keys {
+		sb.WriteByte(0xff)
+		sb.WriteString(k)
+		sb.WriteByte(0xff)
+		sb.WriteString(tags[k])
+	}
+
+	return sb.String()
+}
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key: k,
+		Value: &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_StringValue{
+				StringValue: v,
+			},
+		},
+	}
+}
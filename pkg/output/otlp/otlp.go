@@ -0,0 +1,414 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/output"
+	"ctx.sh/strata-collector/pkg/resource"
+	"github.com/go-logr/logr"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Protocol is the transport used to export metrics.
+type Protocol string
+
+const (
+	// queueSize is the number of full batches that can be waiting to be
+	// exported.  Batches are failed rather than blocking Send once the queue
+	// is full.
+	queueSize int = 8
+)
+
+const (
+	// ProtocolGRPC exports metrics using the OTLP gRPC service.
+	ProtocolGRPC Protocol = "grpc"
+	// ProtocolHTTP exports metrics using OTLP/HTTP with binary protobuf.
+	ProtocolHTTP Protocol = "http"
+)
+
+// Config represents the configuration for the OTLP output.
+type Config struct {
+	// Endpoint is the host:port of the gRPC receiver or the full url of the
+	// http receiver, i.e. https://collector:4318/v1/metrics.
+	Endpoint string
+	// Protocol is the transport used to export metrics.
+	Protocol Protocol
+	// Headers are added to every request.
+	Headers map[string]string
+	// Gzip enables compression of the requests.
+	Gzip bool
+	// BatchSize is the maximum number of metrics in a request.
+	BatchSize int
+	// FlushInterval is the maximum time a partial batch is held.
+	FlushInterval time.Duration
+	// MaxRetries is the number of times a recoverable failure is retried.
+	MaxRetries int
+	// Timeout is the timeout for a single export.
+	Timeout time.Duration
+	// TLS is the TLS configuration.  If nil, gRPC connections are insecure.
+	TLS *tls.Config
+	// Metadata sets the description and unit of the metrics from the HELP
+	// and UNIT of the metric family.
+	Metadata bool
+	// Exemplars adds the exemplars to the data points.
+	Exemplars bool
+	// Logger is used to report failed exports.
+	Logger logr.Logger
+}
+
+// OTLP is an output that converts metrics into OTLP resource metrics and
+// exports them to an OpenTelemetry collector.
+//
+// The flattened series of a histogram or summary are merged back into a single
+// data point, so a family is never split across batches.  The entries of the
+// family currently being sent are held open until a metric from another family
+// is sent, or until a flush finds that nothing has been sent since the last
+// one.
+type OTLP struct {
+	config  Config
+	conn    *grpc.ClientConn
+	grpc    collectorpb.MetricsServiceClient
+	http    *http.Client
+	batch   []entry
+	batchCh chan []entry
+	failed  output.FailureHandler
+
+	open     []entry
+	openName string
+	openRes  resource.Metadata
+	idle     bool
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	doneChan chan struct{}
+	sync.Mutex
+}
+
+// New returns a new OTLP output.
+func New(config Config) *OTLP {
+	return &OTLP{
+		config:   config,
+		batch:    make([]entry, 0, config.BatchSize),
+		batchCh:  make(chan []entry, queueSize),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+}
+
+// Connect creates the client for the configured protocol and starts the
+// background exporter.
+func (o *OTLP) Connect() error {
+	switch o.config.Protocol {
+	case ProtocolHTTP:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = o.config.TLS
+		o.http = &http.Client{
+			Timeout:   o.config.Timeout,
+			Transport: transport,
+		}
+	default:
+		creds := insecure.NewCredentials()
+		if o.config.TLS != nil {
+			creds = credentials.NewTLS(o.config.TLS)
+		}
+
+		opts := []grpc.DialOption{
+			grpc.WithTransportCredentials(creds),
+		}
+		if o.config.Gzip {
+			opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(grpcgzip.Name)))
+		}
+
+		// Dial does not block, the connection is established in the background.
+		conn, err := grpc.Dial(o.config.Endpoint, opts...)
+		if err != nil {
+			return err
+		}
+		o.conn = conn
+		o.grpc = collectorpb.NewMetricsServiceClient(conn)
+	}
+
+	go o.run()
+	return nil
+}
+
+// OnFailure sets the handler called with the messages of batches that could
+// not be exported.  It must be called before Connect.
+func (o *OTLP) OnFailure(fn output.FailureHandler) {
+	o.failed = fn
+}
+
+// Send adds the metric to the current family.  Once the family is complete it
+// is added to the batch and full batches are handed off to the background
+// exporter.  Send never blocks on the exporter, if the export queue is full
+// the batch is failed.
+func (o *OTLP) Send(msg *output.Message) error {
+	e := entry{
+		metric:   msg.Metric,
+		resource: msg.Resource,
+		msg:      msg,
+	}
+	name := familyName(msg.Metric)
+
+	o.Lock()
+	var batch []entry
+	if len(o.open) > 0 && (name != o.openName || msg.Resource != o.openRes) {
+		batch = o.close()
+	}
+	o.open = append(o.open, e)
+	o.openName = name
+	o.openRes = msg.Resource
+	o.idle = false
+	o.Unlock()
+
+	if batch != nil {
+		o.queue(batch)
+	}
+	return nil
+}
+
+// queue hands the batch off to the background exporter without blocking.
+func (o *OTLP) queue(batch []entry) {
+	select {
+	case o.batchCh <- batch:
+	default:
+		o.config.Logger.Info("export queue is full, failing batch", "count", len(batch))
+		o.fail(batch)
+	}
+}
+
+// fail passes the messages of the batch to the failure handler.
+func (o *OTLP) fail(batch []entry) {
+	if o.failed == nil {
+		return
+	}
+
+	msgs := make([]*output.Message, 0, len(batch))
+	for _, e := range batch {
+		msgs = append(msgs, e.msg)
+	}
+	o.failed(msgs)
+}
+
+// close adds the open family to the batch and returns the batch if it is full.
+// The lock must be held by the caller.
+func (o *OTLP) close() []entry {
+	o.batch = append(o.batch, o.open...)
+	o.open = o.open[:0]
+
+	if len(o.batch) < o.config.BatchSize {
+		return nil
+	}
+	return o.take()
+}
+
+// Close exports any remaining metrics and closes the connection.
+func (o *OTLP) Close() {
+	o.stopOnce.Do(func() {
+		close(o.stopChan)
+	})
+
+	if o.conn == nil && o.http == nil {
+		return
+	}
+	<-o.doneChan
+
+	if o.conn != nil {
+		o.conn.Close()
+	}
+}
+
+// take returns the current batch and starts a new one.  The lock must be
+// held by the caller.
+func (o *OTLP) take() []entry {
+	batch := o.batch
+	o.batch = make([]entry, 0, o.config.BatchSize)
+	return batch
+}
+
+func (o *OTLP) run() {
+	defer close(o.doneChan)
+
+	ticker := time.NewTicker(o.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case batch := <-o.batchCh:
+			o.export(batch)
+		case <-ticker.C:
+			o.flush(false)
+		case <-o.stopChan:
+			for len(o.batchCh) > 0 {
+				o.export(<-o.batchCh)
+			}
+			o.flush(true)
+			return
+		}
+	}
+}
+
+// flush exports the current batch.  The open family is included if nothing
+// has been sent since the last flush, as the family is then complete, or if
+// the output is being closed.
+func (o *OTLP) flush(final bool) {
+	o.Lock()
+	if final || o.idle {
+		o.batch = append(o.batch, o.open...)
+		o.open = o.open[:0]
+	}
+	o.idle = true
+	batch := o.take()
+	o.Unlock()
+
+	o.export(batch)
+}
+
+// export converts and sends the batch retrying recoverable errors with an
+// exponential backoff until the output is closed.
+func (o *OTLP) export(batch []entry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	req := &collectorpb.ExportMetricsServiceRequest{
+		ResourceMetrics: convert(batch, o.config.Metadata, o.config.Exemplars),
+	}
+
+	for attempt := 0; ; attempt++ {
+		var wait time.Duration
+		var retry bool
+		var err error
+
+		if o.http != nil {
+			wait, retry, err = o.exportHTTP(req)
+		} else {
+			retry, err = o.exportGRPC(req)
+		}
+
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt >= o.config.MaxRetries {
+			o.config.Logger.Error(err, "unable to export metrics", "count", len(batch), "attempts", attempt+1)
+			o.fail(batch)
+			return
+		}
+
+		if wait == 0 {
+			wait = output.Backoff(attempt)
+		}
+
+		o.config.Logger.V(8).Info("retrying export", "error", err.Error(), "wait", wait)
+		if !output.Wait(wait, o.stopChan) {
+			o.config.Logger.Error(err, "output closed while retrying export", "count", len(batch), "attempts", attempt+1)
+			o.fail(batch)
+			return
+		}
+	}
+}
+
+func (o *OTLP) exportGRPC(req *collectorpb.ExportMetricsServiceRequest) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), o.config.Timeout)
+	defer cancel()
+
+	if len(o.config.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(o.config.Headers))
+	}
+
+	_, err := o.grpc.Export(ctx, req)
+	if err == nil {
+		return false, nil
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+		return true, err
+	default:
+		return false, err
+	}
+}
+
+func (o *OTLP) exportHTTP(req *collectorpb.ExportMetricsServiceRequest) (time.Duration, bool, error) {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if o.config.Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return 0, false, err
+		}
+		if err := gz.Close(); err != nil {
+			return 0, false, err
+		}
+		data = buf.Bytes()
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, o.config.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return 0, false, err
+	}
+
+	for k, v := range o.config.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	if o.config.Gzip {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := o.http.Do(httpReq)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+
+	err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if output.Retryable(resp.StatusCode) {
+		return output.RetryAfter(resp.Header.Get("Retry-After")), true, err
+	}
+
+	return 0, false, err
+}
+
+var _ output.Output = &OTLP{}
+var _ output.FailureReporter = &OTLP{}
@@ -0,0 +1,192 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/output"
+	"ctx.sh/strata-collector/pkg/resource"
+	"github.com/go-logr/logr"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func flattenedHistogram(now time.Time, name string) []*metric.Metric {
+	series := []struct {
+		name  string
+		le    string
+		value float64
+	}{
+		{name + "_bucket", "0.1", 1},
+		{name + "_bucket", "1", 3},
+		{name + "_bucket", "+Inf", 4},
+		{name + "_sum", "", 2.5},
+		{name + "_count", "", 4},
+	}
+
+	metrics := make([]*metric.Metric, 0, len(series))
+	for _, s := range series {
+		tags := map[string]string{"path": "/"}
+		if s.le != "" {
+			tags[metric.BucketLabel] = s.le
+		}
+		m := metric.New(now, s.name, s.value, tags)
+		m.SetType(metric.Histogram)
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func TestSendKeepsFamiliesTogether(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*collectorpb.ExportMetricsServiceRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		req := &collectorpb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Error(err)
+			return
+		}
+
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	// The batch size is smaller than a family so a family would be split if
+	// batches were cut at the batch size.
+	o := New(Config{
+		Endpoint:      srv.URL,
+		Protocol:      ProtocolHTTP,
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		Timeout:       5 * time.Second,
+		Logger:        logr.Discard(),
+	})
+	if err := o.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	res := resource.Metadata{Kind: "Pod", Name: "app", Namespace: "default"}
+	for _, name := range []string{"first_seconds", "second_seconds"} {
+		for _, m := range flattenedHistogram(now, name) {
+			if err := o.Send(&output.Message{Metric: m, Resource: res}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	o.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	points := make(map[string][]*metricspb.HistogramDataPoint)
+	for _, req := range requests {
+		for _, rm := range req.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					points[m.Name] = append(points[m.Name], m.GetHistogram().GetDataPoints()...)
+				}
+			}
+		}
+	}
+
+	for _, name := range []string{"first_seconds", "second_seconds"} {
+		dps := points[name]
+		if len(dps) != 1 {
+			t.Fatalf("expected a single data point for %s, got %d", name, len(dps))
+		}
+		if dps[0].Count != 4 || dps[0].GetSum() != 2.5 {
+			t.Errorf("unexpected count %d and sum %v for %s", dps[0].Count, dps[0].GetSum(), name)
+		}
+		if len(dps[0].ExplicitBounds) != 2 || len(dps[0].BucketCounts) != 3 {
+			t.Errorf("unexpected buckets for %s: %v %v", name, dps[0].ExplicitBounds, dps[0].BucketCounts)
+		}
+	}
+}
+
+func TestSendDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	o := New(Config{
+		Endpoint:      srv.URL,
+		Protocol:      ProtocolHTTP,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		Timeout:       5 * time.Second,
+		Logger:        logr.Discard(),
+	})
+
+	var mu sync.Mutex
+	var failed int
+	o.OnFailure(func(msgs []*output.Message) {
+		mu.Lock()
+		failed += len(msgs)
+		mu.Unlock()
+	})
+
+	if err := o.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every gauge closes the previous one into a full batch.  The exporter is
+	// stuck on the first request, so the queue fills and further batches fail
+	// instead of blocking.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < queueSize*4; i++ {
+			m := metric.New(time.Now(), "gauge_"+strconv.Itoa(i), float64(i), nil)
+			m.SetType(metric.Gauge)
+			_ = o.Send(&output.Message{Metric: m})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("send blocked on the exporter")
+	}
+
+	close(release)
+	o.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if failed == 0 {
+		t.Fatal("expected batches to fail once the queue was full")
+	}
+}
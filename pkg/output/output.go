@@ -14,8 +14,55 @@
 
 package output
 
+import (
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/resource"
+)
+
+// Message represents an encoded metric that is ready to be sent to an output.
+// The original metric and the metadata of the resource that it was collected
+// from are included so outputs are able to route the message, i.e. subjects,
+// topics, or partition keys.
+type Message struct {
+	// Data is the encoded metric.
+	Data []byte
+	// Metric is the metric that was encoded.
+	Metric *metric.Metric
+	// Resource is the metadata of the resource the metric was collected from.
+	Resource resource.Metadata
+}
+
+// Batch represents a batch of metrics collected from a single resource that
+// have been encoded into a single payload.
+type Batch struct {
+	// Data is the encoded batch.
+	Data []byte
+	// Metrics are the metrics that were encoded.
+	Metrics []*metric.Metric
+	// Resource is the metadata of the resource the metrics were collected from.
+	Resource resource.Metadata
+}
+
 type Output interface {
 	Connect() error
-	Send(data []byte) error
+	Send(msg *Message) error
 	Close()
 }
+
+// FailureHandler is called with the messages that an output was unable to
+// deliver once it has given up retrying them.
+type FailureHandler func(msgs []*Message)
+
+// FailureReporter is implemented by outputs that deliver messages in the
+// background.  Send only reports errors queueing the message, so delivery
+// failures are reported through the handler instead.
+type FailureReporter interface {
+	OnFailure(fn FailureHandler)
+}
+
+// BatchOutput is implemented by outputs that are able to send an encoded
+// batch of metrics at once.
+type BatchOutput interface {
+	Output
+	SendBatch(b *Batch) error
+}
@@ -0,0 +1,285 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"math"
+	"sort"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The remote write protocol only needs a handful of messages so they are
+// encoded by hand instead of pulling in the generated prometheus types.
+//
+//	message WriteRequest {
+//	  repeated TimeSeries timeseries = 1;
+//	}
+//
+//	message TimeSeries {
+//	  repeated Label labels         = 1;
+//	  repeated Sample samples       = 2;
+//	  repeated Exemplar exemplars   = 3;
+//	  repeated Histogram histograms = 4;
+//	}
+//
+//	message Label {
+//	  string name  = 1;
+//	  string value = 2;
+//	}
+//
+//	message Sample {
+//	  double value    = 1;
+//	  int64 timestamp = 2;
+//	}
+//
+//	message Exemplar {
+//	  repeated Label labels = 1;
+//	  double value          = 2;
+//	  int64 timestamp       = 3;
+//	}
+//
+//	message Histogram {
+//	  double count_float              = 2;
+//	  double sum                      = 3;
+//	  sint32 schema                   = 4;
+//	  double zero_threshold           = 5;
+//	  double zero_count_float         = 7;
+//	  repeated BucketSpan negative_spans = 8;
+//	  repeated double negative_counts = 10;
+//	  repeated BucketSpan positive_spans = 11;
+//	  repeated double positive_counts = 13;
+//	  int64 timestamp                 = 15;
+//	}
+//
+//	message BucketSpan {
+//	  sint32 offset = 1;
+//	  uint32 length = 2;
+//	}
+//
+// Native histograms are always encoded using the float counts.
+
+// Label is a single name/value pair.  Labels in a series must be sorted by name.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value at a point in time for a series.  If Histogram is
+// set, the sample is a native histogram and the value is not used.  The
+// exemplar is optional.
+type Sample struct {
+	Labels    []Label
+	Value     float64
+	Timestamp int64
+	Histogram *metric.HistogramValue
+	Exemplar  *metric.Exemplar
+}
+
+// AppendWriteRequest appends the protobuf encoded write request containing a
+// time series for every sample to buf.
+func AppendWriteRequest(buf []byte, samples []Sample) []byte {
+	for _, s := range samples {
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendVarint(buf, uint64(timeSeriesSize(s)))
+		buf = appendTimeSeries(buf, s)
+	}
+
+	return buf
+}
+
+func appendTimeSeries(buf []byte, s Sample) []byte {
+	for _, l := range s.Labels {
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendVarint(buf, uint64(labelSize(l)))
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendString(buf, l.Name)
+		buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+		buf = protowire.AppendString(buf, l.Value)
+	}
+
+	if s.Exemplar != nil {
+		buf = protowire.AppendTag(buf, 3, protowire.BytesType)
+		buf = protowire.AppendVarint(buf, uint64(exemplarSize(s.Exemplar)))
+		buf = appendExemplar(buf, s.Exemplar)
+	}
+
+	if s.Histogram != nil {
+		buf = protowire.AppendTag(buf, 4, protowire.BytesType)
+		buf = protowire.AppendVarint(buf, uint64(histogramSize(s)))
+		return appendHistogram(buf, s)
+	}
+
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	buf = protowire.AppendVarint(buf, uint64(sampleSize(s)))
+	buf = protowire.AppendTag(buf, 1, protowire.Fixed64Type)
+	buf = protowire.AppendFixed64(buf, math.Float64bits(s.Value))
+	buf = protowire.AppendTag(buf, 2, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, uint64(s.Timestamp))
+
+	return buf
+}
+
+// appendExemplar appends the exemplar with the labels sorted by name.
+func appendExemplar(buf []byte, e *metric.Exemplar) []byte {
+	for _, l := range exemplarLabels(e) {
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendVarint(buf, uint64(labelSize(l)))
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendString(buf, l.Name)
+		buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+		buf = protowire.AppendString(buf, l.Value)
+	}
+
+	buf = appendDouble(buf, 2, e.Value)
+	if e.Timestamp != nil {
+		buf = protowire.AppendTag(buf, 3, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, uint64(e.Timestamp.UnixMilli()))
+	}
+
+	return buf
+}
+
+func exemplarLabels(e *metric.Exemplar) []Label {
+	labels := make([]Label, 0, len(e.Labels))
+	for k, v := range e.Labels {
+		labels = append(labels, Label{Name: k, Value: v})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
+}
+
+func appendHistogram(buf []byte, s Sample) []byte {
+	h := s.Histogram
+	n := h.Native
+
+	buf = appendDouble(buf, 2, h.Count)
+	buf = appendDouble(buf, 3, h.Sum)
+	buf = protowire.AppendTag(buf, 4, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, protowire.EncodeZigZag(int64(n.Schema)))
+	buf = appendDouble(buf, 5, n.ZeroThreshold)
+	buf = appendDouble(buf, 7, n.ZeroCount)
+	buf = appendSpans(buf, 8, n.NegativeSpans)
+	buf = appendCounts(buf, 10, n.NegativeCounts)
+	buf = appendSpans(buf, 11, n.PositiveSpans)
+	buf = appendCounts(buf, 13, n.PositiveCounts)
+	buf = protowire.AppendTag(buf, 15, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, uint64(s.Timestamp))
+
+	return buf
+}
+
+func appendDouble(buf []byte, num protowire.Number, v float64) []byte {
+	buf = protowire.AppendTag(buf, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(buf, math.Float64bits(v))
+}
+
+func appendSpans(buf []byte, num protowire.Number, spans []metric.BucketSpan) []byte {
+	for _, span := range spans {
+		buf = protowire.AppendTag(buf, num, protowire.BytesType)
+		buf = protowire.AppendVarint(buf, uint64(spanSize(span)))
+		buf = protowire.AppendTag(buf, 1, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, protowire.EncodeZigZag(int64(span.Offset)))
+		buf = protowire.AppendTag(buf, 2, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, uint64(span.Length))
+	}
+	return buf
+}
+
+// appendCounts appends the counts as a packed repeated double.
+func appendCounts(buf []byte, num protowire.Number, counts []float64) []byte {
+	if len(counts) == 0 {
+		return buf
+	}
+
+	buf = protowire.AppendTag(buf, num, protowire.BytesType)
+	buf = protowire.AppendVarint(buf, uint64(len(counts)*8))
+	for _, c := range counts {
+		buf = protowire.AppendFixed64(buf, math.Float64bits(c))
+	}
+	return buf
+}
+
+func timeSeriesSize(s Sample) int {
+	n := 0
+	for _, l := range s.Labels {
+		n += protowire.SizeTag(1) + protowire.SizeBytes(labelSize(l))
+	}
+	if s.Exemplar != nil {
+		n += protowire.SizeTag(3) + protowire.SizeBytes(exemplarSize(s.Exemplar))
+	}
+	if s.Histogram != nil {
+		n += protowire.SizeTag(4) + protowire.SizeBytes(histogramSize(s))
+	} else {
+		n += protowire.SizeTag(2) + protowire.SizeBytes(sampleSize(s))
+	}
+	return n
+}
+
+func labelSize(l Label) int {
+	return protowire.SizeTag(1) + protowire.SizeBytes(len(l.Name)) +
+		protowire.SizeTag(2) + protowire.SizeBytes(len(l.Value))
+}
+
+func sampleSize(s Sample) int {
+	return protowire.SizeTag(1) + protowire.SizeFixed64() +
+		protowire.SizeTag(2) + protowire.SizeVarint(uint64(s.Timestamp))
+}
+
+func histogramSize(s Sample) int {
+	n := s.Histogram.Native
+
+	size := 4 * (protowire.SizeTag(2) + protowire.SizeFixed64())
+	size += protowire.SizeTag(4) + protowire.SizeVarint(protowire.EncodeZigZag(int64(n.Schema)))
+	size += spansSize(8, n.NegativeSpans) + countsSize(10, n.NegativeCounts)
+	size += spansSize(11, n.PositiveSpans) + countsSize(13, n.PositiveCounts)
+	size += protowire.SizeTag(15) + protowire.SizeVarint(uint64(s.Timestamp))
+	return size
+}
+
+func spanSize(span metric.BucketSpan) int {
+	return protowire.SizeTag(1) + protowire.SizeVarint(protowire.EncodeZigZag(int64(span.Offset))) +
+		protowire.SizeTag(2) + protowire.SizeVarint(uint64(span.Length))
+}
+
+func spansSize(num protowire.Number, spans []metric.BucketSpan) int {
+	size := 0
+	for _, span := range spans {
+		size += protowire.SizeTag(num) + protowire.SizeBytes(spanSize(span))
+	}
+	return size
+}
+
+func countsSize(num protowire.Number, counts []float64) int {
+	if len(counts) == 0 {
+		return 0
+	}
+	return protowire.SizeTag(num) + protowire.SizeBytes(len(counts)*8)
+}
+
+func exemplarSize(e *metric.Exemplar) int {
+	size := 0
+	for _, l := range exemplarLabels(e) {
+		size += protowire.SizeTag(1) + protowire.SizeBytes(labelSize(l))
+	}
+	size += protowire.SizeTag(2) + protowire.SizeFixed64()
+	if e.Timestamp != nil {
+		size += protowire.SizeTag(3) + protowire.SizeVarint(uint64(e.Timestamp.UnixMilli()))
+	}
+	return size
+}
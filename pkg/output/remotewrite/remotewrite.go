@@ -0,0 +1,367 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/output"
+	"github.com/go-logr/logr"
+	"github.com/golang/snappy"
+)
+
+// Config represents the configuration for the remote write output.
+type Config struct {
+	// URL is the remote write endpoint.
+	URL string
+	// Headers are added to every request.
+	Headers map[string]string
+	// TenantHeader is the header used to pass the tenant to the endpoint.  If
+	// empty, the tenant header is not sent.
+	TenantHeader string
+	// Tenant is a static tenant.  If empty, the namespace of the resource that
+	// the metric was collected from is used.
+	Tenant string
+	// Shards is the number of concurrent senders.
+	Shards int
+	// Capacity is the number of samples queued per shard before Send blocks.
+	Capacity int
+	// MaxSamplesPerSend is the maximum number of samples in a request.
+	MaxSamplesPerSend int
+	// BatchSendDeadline is the maximum time a partial batch is held.
+	BatchSendDeadline time.Duration
+	// MaxRetries is the number of times a recoverable failure is retried.
+	MaxRetries int
+	// Timeout is the timeout for a single request.
+	Timeout time.Duration
+	// Exemplars sends the exemplars attached to counters and histogram
+	// buckets.
+	Exemplars bool
+	// TLS is the optional TLS configuration for the client.
+	TLS *tls.Config
+	// Logger is used to report failed requests.
+	Logger logr.Logger
+}
+
+// RemoteWrite is an output that sends metrics to a prometheus remote write
+// endpoint.  Samples are distributed across a fixed number of shards by series
+// so the samples for a series are always sent in order.  Each shard batches
+// samples per tenant.
+type RemoteWrite struct {
+	config Config
+	client *http.Client
+	shards []*shard
+	failed output.FailureHandler
+	wg     sync.WaitGroup
+
+	stopChan chan struct{}
+}
+
+// New returns a new remote write output.
+func New(config Config) *RemoteWrite {
+	return &RemoteWrite{
+		config:   config,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Connect creates the client and starts the shards.
+func (rw *RemoteWrite) Connect() error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = rw.config.TLS
+
+	rw.client = &http.Client{
+		Timeout:   rw.config.Timeout,
+		Transport: transport,
+	}
+
+	rw.shards = make([]*shard, rw.config.Shards)
+	for i := range rw.shards {
+		rw.shards[i] = newShard(rw)
+		rw.wg.Add(1)
+		go rw.shards[i].run()
+	}
+
+	return nil
+}
+
+// OnFailure sets the handler called with the messages whose samples could not
+// be delivered.  It must be called before Connect.
+func (rw *RemoteWrite) OnFailure(fn output.FailureHandler) {
+	rw.failed = fn
+}
+
+// Send converts the metric to one or more samples and queues them on the
+// shards that own the series.  The encoded data in the message is not used.
+func (rw *RemoteWrite) Send(msg *output.Message) error {
+	tenant := rw.config.Tenant
+	if tenant == "" {
+		tenant = msg.Resource.Namespace
+	}
+
+	// Native histograms are sent as a single histogram sample.
+	if h := msg.Metric.Histogram; h != nil && h.Native != nil {
+		rw.queue(msg, tenant, msg.Metric, h)
+		return nil
+	}
+
+	// Remote write has no classic histogram or summary sample, so structured
+	// values are sent as the individual prometheus series.
+	for _, m := range msg.Metric.Flatten() {
+		rw.queue(msg, tenant, m, nil)
+	}
+
+	return nil
+}
+
+// queue converts the metric to a sample and queues it on the shard that owns
+// the series.  The message is kept with the sample so that it can be reported
+// if the sample can't be delivered.
+func (rw *RemoteWrite) queue(msg *output.Message, tenant string, m *metric.Metric, h *metric.HistogramValue) {
+	labels := make([]Label, 0, len(m.Tags)+1)
+	labels = append(labels, Label{Name: "__name__", Value: m.Name})
+	for k, v := range m.Tags {
+		labels = append(labels, Label{Name: k, Value: v})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+
+	sample := Sample{
+		Labels:    labels,
+		Value:     m.Value,
+		Timestamp: m.Timestamp.UnixMilli(),
+		Histogram: h,
+	}
+
+	// Stale markers are sent as the prometheus StaleNaN.  Native histogram
+	// series are ended with an empty histogram sample carrying the StaleNaN
+	// sum as prometheus does.
+	if m.Stale {
+		sample.Value = metric.StaleValue()
+		if h != nil && h.Native != nil {
+			sample.Histogram = &metric.HistogramValue{
+				Sum: metric.StaleValue(),
+				Native: &metric.NativeHistogram{
+					Schema:        h.Native.Schema,
+					ZeroThreshold: h.Native.ZeroThreshold,
+				},
+			}
+		}
+	}
+
+	if rw.config.Exemplars {
+		sample.Exemplar = m.Exemplar
+	}
+
+	idx := m.Hash() % uint64(len(rw.shards))
+	rw.shards[idx].queue <- queued{
+		tenant: tenant,
+		sample: sample,
+		msg:    msg,
+	}
+}
+
+// Close flushes all pending samples and stops the shards.  The retries of
+// batches that are being sent are interrupted and the remaining batches are
+// sent once, failing them as soon as a shard is unable to send.
+func (rw *RemoteWrite) Close() {
+	close(rw.stopChan)
+	for _, s := range rw.shards {
+		close(s.queue)
+	}
+	rw.wg.Wait()
+}
+
+type queued struct {
+	tenant string
+	sample Sample
+	msg    *output.Message
+}
+
+type shard struct {
+	rw      *RemoteWrite
+	queue   chan queued
+	pending map[string][]queued
+	samples []Sample
+	buf     []byte
+	cbuf    []byte
+	// down is set when a send fails while the output is closing.  The
+	// remaining batches are failed without waiting on the endpoint.
+	down bool
+}
+
+func newShard(rw *RemoteWrite) *shard {
+	return &shard{
+		rw:      rw,
+		queue:   make(chan queued, rw.config.Capacity),
+		pending: make(map[string][]queued),
+	}
+}
+
+func (s *shard) run() {
+	defer s.rw.wg.Done()
+
+	ticker := time.NewTicker(s.rw.config.BatchSendDeadline)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case q, ok := <-s.queue:
+			if !ok {
+				s.flush()
+				return
+			}
+
+			batch := append(s.pending[q.tenant], q)
+			if len(batch) >= s.rw.config.MaxSamplesPerSend {
+				s.send(q.tenant, batch)
+				batch = batch[:0]
+			}
+			s.pending[q.tenant] = batch
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// flush sends the pending samples for all tenants.
+func (s *shard) flush() {
+	for tenant, batch := range s.pending {
+		if len(batch) == 0 {
+			continue
+		}
+		s.send(tenant, batch)
+		s.pending[tenant] = batch[:0]
+	}
+}
+
+// send writes the batch to the endpoint retrying recoverable errors with an
+// exponential backoff until the output is closed.  The messages of the
+// samples are passed to the failure handler after the retries have been
+// exhausted or on unrecoverable errors.
+func (s *shard) send(tenant string, batch []queued) {
+	if s.down {
+		s.fail(batch)
+		return
+	}
+
+	s.samples = s.samples[:0]
+	for _, q := range batch {
+		s.samples = append(s.samples, q.sample)
+	}
+
+	s.buf = AppendWriteRequest(s.buf[:0], s.samples)
+	s.cbuf = snappy.Encode(s.cbuf[:cap(s.cbuf)], s.buf)
+
+	log := s.rw.config.Logger
+	for attempt := 0; ; attempt++ {
+		wait, retry, err := s.do(tenant, s.cbuf)
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt >= s.rw.config.MaxRetries {
+			log.Error(err, "unable to send samples", "tenant", tenant, "count", len(batch), "attempts", attempt+1)
+			s.fail(batch)
+			return
+		}
+
+
+		if wait == 0 {
+			wait = output.Backoff(attempt)
+		}
+
+		log.V(8).Info("retrying samples", "tenant", tenant, "error", err.Error(), "wait", wait)
+		if !output.Wait(wait, s.rw.stopChan) {
+			log.Error(err, "output closed while retrying samples", "tenant", tenant, "count", len(batch), "attempts", attempt+1)
+			s.down = true
+			s.fail(batch)
+			return
+		}
+	}
+}
+
+// fail reports the messages of the samples in the batch.  Flattened metrics
+// queue multiple samples for the same message, so each message is only
+// reported once.
+func (s *shard) fail(batch []queued) {
+	if s.rw.failed == nil {
+		return
+	}
+
+	seen := make(map[*output.Message]struct{}, len(batch))
+	msgs := make([]*output.Message, 0, len(batch))
+	for _, q := range batch {
+		if _, ok := seen[q.msg]; ok {
+			continue
+		}
+		seen[q.msg] = struct{}{}
+		msgs = append(msgs, q.msg)
+	}
+
+	s.rw.failed(msgs)
+}
+
+func (s *shard) do(tenant string, body []byte) (time.Duration, bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.rw.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	for k, v := range s.rw.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "strata-collector")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	if s.rw.config.TenantHeader != "" && tenant != "" {
+		req.Header.Set(s.rw.config.TenantHeader, tenant)
+	}
+
+	resp, err := s.rw.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return 0, false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+
+	if output.Retryable(resp.StatusCode) {
+		return output.RetryAfter(resp.Header.Get("Retry-After")), true, err
+	}
+
+	return 0, false, err
+}
+
+var _ output.Output = &RemoteWrite{}
+var _ output.FailureReporter = &RemoteWrite{}
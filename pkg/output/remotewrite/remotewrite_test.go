@@ -0,0 +1,527 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/output"
+	"ctx.sh/strata-collector/pkg/resource"
+	"github.com/go-logr/logr"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// writeRequestDescriptor builds the subset of the prometheus remote write
+// schema used by the output so requests can be decoded independently of the
+// hand written encoder.
+func writeRequestDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(num),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+
+	const (
+		optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		message  = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		str      = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		double   = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+		int64    = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		sint32   = descriptorpb.FieldDescriptorProto_TYPE_SINT32
+		uint32   = descriptorpb.FieldDescriptorProto_TYPE_UINT32
+	)
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("remote.proto"),
+		Package: proto.String("prometheus"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("WriteRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("timeseries", 1, message, repeated, ".prometheus.TimeSeries"),
+				},
+			},
+			{
+				Name: proto.String("TimeSeries"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("labels", 1, message, repeated, ".prometheus.Label"),
+					field("samples", 2, message, repeated, ".prometheus.Sample"),
+					field("exemplars", 3, message, repeated, ".prometheus.Exemplar"),
+					field("histograms", 4, message, repeated, ".prometheus.Histogram"),
+				},
+			},
+			{
+				Name: proto.String("Label"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, str, optional, ""),
+					field("value", 2, str, optional, ""),
+				},
+			},
+			{
+				Name: proto.String("Sample"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("value", 1, double, optional, ""),
+					field("timestamp", 2, int64, optional, ""),
+				},
+			},
+			{
+				Name: proto.String("Exemplar"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("labels", 1, message, repeated, ".prometheus.Label"),
+					field("value", 2, double, optional, ""),
+					field("timestamp", 3, int64, optional, ""),
+				},
+			},
+			{
+				Name: proto.String("Histogram"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("count_float", 2, double, optional, ""),
+					field("sum", 3, double, optional, ""),
+					field("schema", 4, sint32, optional, ""),
+					field("zero_threshold", 5, double, optional, ""),
+					field("zero_count_float", 7, double, optional, ""),
+					field("negative_spans", 8, message, repeated, ".prometheus.BucketSpan"),
+					field("negative_counts", 10, double, repeated, ""),
+					field("positive_spans", 11, message, repeated, ".prometheus.BucketSpan"),
+					field("positive_counts", 13, double, repeated, ""),
+					field("timestamp", 15, int64, optional, ""),
+				},
+			},
+			{
+				Name: proto.String("BucketSpan"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("offset", 1, sint32, optional, ""),
+					field("length", 2, uint32, optional, ""),
+				},
+			},
+		},
+	}
+
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fd.Messages().ByName("WriteRequest")
+}
+
+// series is a decoded time series keyed by metric name.
+type series struct {
+	labels     map[string]string
+	samples    []protoreflect.Message
+	histograms []protoreflect.Message
+}
+
+// receiver is a remote write endpoint that decodes the received requests.
+type receiver struct {
+	t      *testing.T
+	desc   protoreflect.MessageDescriptor
+	series map[string]series
+	sync.Mutex
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if got := req.Header.Get("Content-Encoding"); got != "snappy" {
+		r.t.Errorf("expected snappy encoding, got %q", got)
+	}
+	if got := req.Header.Get("X-Prometheus-Remote-Write-Version"); got != "0.1.0" {
+		r.t.Errorf("expected remote write version 0.1.0, got %q", got)
+	}
+
+	compressed, err := io.ReadAll(req.Body)
+	if err != nil {
+		r.t.Error(err)
+		return
+	}
+
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		r.t.Errorf("invalid snappy body: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	wr := dynamicpb.NewMessage(r.desc)
+	if err := proto.Unmarshal(body, wr); err != nil {
+		r.t.Errorf("invalid write request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if unknown := wr.GetUnknown(); len(unknown) > 0 {
+		r.t.Errorf("unexpected unknown fields in write request")
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	tsField := r.desc.Fields().ByName("timeseries")
+	list := wr.Get(tsField).List()
+	for i := 0; i < list.Len(); i++ {
+		ts := list.Get(i).Message()
+		fields := ts.Descriptor().Fields()
+
+		s := series{labels: make(map[string]string)}
+		labels := ts.Get(fields.ByName("labels")).List()
+		for j := 0; j < labels.Len(); j++ {
+			l := labels.Get(j).Message()
+			lf := l.Descriptor().Fields()
+			s.labels[l.Get(lf.ByName("name")).String()] = l.Get(lf.ByName("value")).String()
+		}
+
+		samples := ts.Get(fields.ByName("samples")).List()
+		for j := 0; j < samples.Len(); j++ {
+			s.samples = append(s.samples, samples.Get(j).Message())
+		}
+
+		histograms := ts.Get(fields.ByName("histograms")).List()
+		for j := 0; j < histograms.Len(); j++ {
+			s.histograms = append(s.histograms, histograms.Get(j).Message())
+		}
+
+		r.series[s.labels["__name__"]] = s
+	}
+}
+
+func get(m protoreflect.Message, name protoreflect.Name) protoreflect.Value {
+	return m.Get(m.Descriptor().Fields().ByName(name))
+}
+
+func TestRemoteWrite(t *testing.T) {
+	r := &receiver{
+		t:      t,
+		desc:   writeRequestDescriptor(t),
+		series: make(map[string]series),
+	}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	rw := New(Config{
+		URL:               srv.URL,
+		Shards:            2,
+		Capacity:          100,
+		MaxSamplesPerSend: 100,
+		BatchSendDeadline: time.Second,
+		Timeout:           5 * time.Second,
+		Logger:            logr.Discard(),
+	})
+
+	var failed int
+	rw.OnFailure(func(msgs []*output.Message) {
+		failed += len(msgs)
+	})
+
+	if err := rw.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.UnixMilli(1700000000000)
+
+	counter := metric.New(now, "requests_total", 42, map[string]string{"code": "200"})
+	counter.SetType(metric.Counter)
+
+	gauge := metric.New(now, "temperature", 21.5, nil)
+	gauge.SetType(metric.Gauge)
+
+	native := metric.New(now, "latency_seconds", 0, nil)
+	native.SetType(metric.Histogram)
+	native.Histogram = &metric.HistogramValue{
+		Sum:   12.5,
+		Count: 6,
+		Native: &metric.NativeHistogram{
+			Schema:         3,
+			ZeroThreshold:  0.001,
+			ZeroCount:      1,
+			PositiveSpans:  []metric.BucketSpan{{Offset: -2, Length: 2}, {Offset: 1, Length: 1}},
+			PositiveCounts: []float64{1, 2, 1},
+			NegativeSpans:  []metric.BucketSpan{{Offset: 0, Length: 1}},
+			NegativeCounts: []float64{1},
+		},
+	}
+
+	staleNative := metric.New(now, "stale_latency_seconds", 0, nil)
+	staleNative.SetType(metric.Histogram)
+	staleNative.Histogram = &metric.HistogramValue{
+		Native: &metric.NativeHistogram{Schema: 1},
+	}
+
+	metrics := []*metric.Metric{
+		counter,
+		gauge.StaleMarker(now),
+		native,
+		staleNative.StaleMarker(now),
+	}
+	for _, m := range metrics {
+		if err := rw.Send(&output.Message{Metric: m}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rw.Close()
+
+	if failed != 0 {
+		t.Fatalf("expected no failed messages, got %d", failed)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	t.Run("float", func(t *testing.T) {
+		s, ok := r.series["requests_total"]
+		if !ok {
+			t.Fatal("missing series")
+		}
+		if s.labels["code"] != "200" {
+			t.Errorf("expected code label 200, got %q", s.labels["code"])
+		}
+		if len(s.samples) != 1 || len(s.histograms) != 0 {
+			t.Fatalf("expected a single float sample, got %d samples and %d histograms", len(s.samples), len(s.histograms))
+		}
+		if v := get(s.samples[0], "value").Float(); v != 42 {
+			t.Errorf("expected 42, got %v", v)
+		}
+		if ts := get(s.samples[0], "timestamp").Int(); ts != now.UnixMilli() {
+			t.Errorf("expected timestamp %d, got %d", now.UnixMilli(), ts)
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		s, ok := r.series["temperature"]
+		if !ok {
+			t.Fatal("missing series")
+		}
+		if len(s.samples) != 1 {
+			t.Fatalf("expected a single sample, got %d", len(s.samples))
+		}
+		if v := get(s.samples[0], "value").Float(); math.Float64bits(v) != math.Float64bits(metric.StaleValue()) {
+			t.Errorf("expected StaleNaN, got %x", math.Float64bits(v))
+		}
+	})
+
+	t.Run("native histogram", func(t *testing.T) {
+		s, ok := r.series["latency_seconds"]
+		if !ok {
+			t.Fatal("missing series")
+		}
+		if len(s.histograms) != 1 || len(s.samples) != 0 {
+			t.Fatalf("expected a single histogram, got %d samples and %d histograms", len(s.samples), len(s.histograms))
+		}
+
+		h := s.histograms[0]
+		if v := get(h, "count_float").Float(); v != 6 {
+			t.Errorf("expected count 6, got %v", v)
+		}
+		if v := get(h, "sum").Float(); v != 12.5 {
+			t.Errorf("expected sum 12.5, got %v", v)
+		}
+		if v := get(h, "schema").Int(); v != 3 {
+			t.Errorf("expected schema 3, got %d", v)
+		}
+		if v := get(h, "zero_threshold").Float(); v != 0.001 {
+			t.Errorf("expected zero threshold 0.001, got %v", v)
+		}
+		if v := get(h, "zero_count_float").Float(); v != 1 {
+			t.Errorf("expected zero count 1, got %v", v)
+		}
+		if ts := get(h, "timestamp").Int(); ts != now.UnixMilli() {
+			t.Errorf("expected timestamp %d, got %d", now.UnixMilli(), ts)
+		}
+
+		spans := get(h, "positive_spans").List()
+		if spans.Len() != 2 {
+			t.Fatalf("expected 2 positive spans, got %d", spans.Len())
+		}
+		if o := get(spans.Get(0).Message(), "offset").Int(); o != -2 {
+			t.Errorf("expected offset -2, got %d", o)
+		}
+		if l := get(spans.Get(1).Message(), "length").Uint(); l != 1 {
+			t.Errorf("expected length 1, got %d", l)
+		}
+
+		counts := get(h, "positive_counts").List()
+		if counts.Len() != 3 || counts.Get(1).Float() != 2 {
+			t.Errorf("unexpected positive counts")
+		}
+		if n := get(h, "negative_counts").List(); n.Len() != 1 || n.Get(0).Float() != 1 {
+			t.Errorf("unexpected negative counts")
+		}
+	})
+
+	t.Run("stale native histogram", func(t *testing.T) {
+		s, ok := r.series["stale_latency_seconds"]
+		if !ok {
+			t.Fatal("missing series")
+		}
+		if len(s.histograms) != 1 || len(s.samples) != 0 {
+			t.Fatalf("expected a single histogram, got %d samples and %d histograms", len(s.samples), len(s.histograms))
+		}
+
+		h := s.histograms[0]
+		if v := get(h, "sum").Float(); math.Float64bits(v) != math.Float64bits(metric.StaleValue()) {
+			t.Errorf("expected StaleNaN sum, got %x", math.Float64bits(v))
+		}
+		if v := get(h, "schema").Int(); v != 1 {
+			t.Errorf("expected schema 1, got %d", v)
+		}
+	})
+}
+
+func TestRemoteWriteFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	rw := New(Config{
+		URL:               srv.URL,
+		Shards:            1,
+		Capacity:          10,
+		MaxSamplesPerSend: 10,
+		BatchSendDeadline: time.Second,
+		Timeout:           5 * time.Second,
+		Logger:            logr.Discard(),
+	})
+
+	var failed []*output.Message
+	rw.OnFailure(func(msgs []*output.Message) {
+		failed = append(failed, msgs...)
+	})
+
+	if err := rw.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flattened histogram queues several samples for the one message, which
+	// should only be reported once.
+	h := metric.New(time.Now(), "latency_seconds", 0, nil)
+	h.SetType(metric.Histogram)
+	h.Histogram = &metric.HistogramValue{
+		Sum:     1,
+		Count:   2,
+		Buckets: []metric.Bucket{{UpperBound: 1, Count: 1}, {UpperBound: math.Inf(1), Count: 2}},
+	}
+
+	msg := &output.Message{Metric: h}
+	if err := rw.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	rw.Close()
+
+	if len(failed) != 1 || failed[0] != msg {
+		t.Fatalf("expected the message to be reported once, got %d", len(failed))
+	}
+}
+
+func TestRemoteWriteCloseInterruptsRetries(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	rw := New(Config{
+		URL:               srv.URL,
+		Shards:            1,
+		Capacity:          10,
+		MaxSamplesPerSend: 10,
+		MaxRetries:        10,
+		BatchSendDeadline: 10 * time.Millisecond,
+		Timeout:           5 * time.Second,
+		Logger:            logr.Discard(),
+	})
+
+	failed := make(chan *output.Message, 2)
+	rw.OnFailure(func(msgs []*output.Message) {
+		for _, msg := range msgs {
+			failed <- msg
+		}
+	})
+
+	if err := rw.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	first := &output.Message{
+		Metric:   metric.New(time.Now(), "up", 1, nil),
+		Resource: resource.Metadata{Namespace: "a"},
+	}
+	if err := rw.Send(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the shard to send the first batch and start waiting for the
+	// hour long retry before queueing a batch for another tenant.
+	time.Sleep(100 * time.Millisecond)
+	second := &output.Message{
+		Metric:   metric.New(time.Now(), "up", 1, nil),
+		Resource: resource.Metadata{Namespace: "b"},
+	}
+	if err := rw.Send(second); err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		rw.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close waited for the retries")
+	}
+
+	reported := map[*output.Message]bool{}
+	for len(failed) > 0 {
+		reported[<-failed] = true
+	}
+	if !reported[first] || !reported[second] {
+		t.Errorf("expected both messages to be reported, got %d", len(reported))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 1 {
+		t.Errorf("expected a single request once the endpoint was down, got %d", requests)
+	}
+}
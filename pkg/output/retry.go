@@ -0,0 +1,81 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultInitialBackoff is the wait time before the first retry.
+	DefaultInitialBackoff time.Duration = 500 * time.Millisecond
+	// DefaultMaxBackoff is the maximum wait time between retries.
+	DefaultMaxBackoff time.Duration = 30 * time.Second
+)
+
+// Backoff returns the exponential backoff for the retry attempt starting at
+// DefaultInitialBackoff and capped at DefaultMaxBackoff.
+func Backoff(attempt int) time.Duration {
+	wait := time.Duration(float64(DefaultInitialBackoff) * math.Pow(2, float64(attempt)))
+	if wait > DefaultMaxBackoff || wait <= 0 {
+		return DefaultMaxBackoff
+	}
+	return wait
+}
+
+// Retryable returns true if the http status code represents a failure that
+// can be retried.
+func Retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// RetryAfter parses the Retry-After header which can either be the number of
+// seconds to wait or an http date.  Zero is returned if the header is not set
+// or invalid.
+func RetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
+
+// Wait waits for the retry backoff.  It returns false as soon as stop is
+// closed so that closing an output is not held up by the retries of a
+// failing endpoint.
+func Wait(d time.Duration, stop <-chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/output"
+	"github.com/go-logr/logr"
+)
+
+// Config represents the configuration for the statsd output.
+type Config struct {
+	// Address is the host:port of the statsd server.
+	Address string
+	// Protocol is either udp or tcp.
+	Protocol string
+	// MTU is the maximum size of a single udp datagram.  Lines are packed into
+	// a single datagram until the next line would exceed the MTU.
+	MTU int
+	// FlushInterval is the maximum time lines are buffered before being sent.
+	FlushInterval time.Duration
+	// Logger is used to report write errors during background flushes.
+	Logger logr.Logger
+}
+
+// Statsd is an output which sends statsd encoded lines to a statsd server.
+type Statsd struct {
+	config Config
+	conn   net.Conn
+	buf    []byte
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	doneChan chan struct{}
+	sync.Mutex
+}
+
+// New returns a new statsd output.
+func New(config Config) *Statsd {
+	return &Statsd{
+		config:   config,
+		buf:      make([]byte, 0, config.MTU),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+}
+
+// Connect dials the statsd server and starts the background flusher.  A failed
+// tcp connection will be retried on the next flush.
+func (s *Statsd) Connect() error {
+	go s.run()
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.dial()
+}
+
+// Send packs the lines in the message into the send buffer.  The buffer is
+// flushed whenever adding a line would exceed the MTU.
+func (s *Statsd) Send(msg *output.Message) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, line := range bytes.Split(msg.Data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		if len(s.buf) > 0 && len(s.buf)+len(line)+1 > s.config.MTU {
+			if err := s.flush(); err != nil {
+				return err
+			}
+		}
+
+		if len(s.buf) > 0 {
+			s.buf = append(s.buf, '\n')
+		}
+		s.buf = append(s.buf, line...)
+	}
+
+	return nil
+}
+
+// SendBatch packs the lines in the batch into the send buffer.
+func (s *Statsd) SendBatch(b *output.Batch) error {
+	return s.Send(&output.Message{Data: b.Data, Resource: b.Resource})
+}
+
+// Close flushes any buffered lines and closes the connection.
+func (s *Statsd) Close() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+	<-s.doneChan
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.flush(); err != nil {
+		s.config.Logger.Error(err, "unable to flush statsd buffer")
+	}
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *Statsd) run() {
+	defer close(s.doneChan)
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.Lock()
+			if err := s.flush(); err != nil {
+				s.config.Logger.Error(err, "unable to flush statsd buffer")
+			}
+			s.Unlock()
+		}
+	}
+}
+
+// flush writes the buffer to the connection.  The lock must be held by the
+// caller.  The buffer is always reset, statsd is lossy by design and we don't
+// want a dead server to cause the buffer to grow.
+func (s *Statsd) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	defer func() {
+		s.buf = s.buf[:0]
+	}()
+
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+
+	data := s.buf
+	if s.config.Protocol == "tcp" {
+		data = append(data, '\n')
+	}
+
+	if _, err := s.conn.Write(data); err != nil {
+		// Drop the connection so it will be reestablished on the next flush.
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+// dial connects to the statsd server.  The lock must be held by the caller.
+func (s *Statsd) dial() error {
+	conn, err := net.DialTimeout(s.config.Protocol, s.config.Address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	return nil
+}
+
+var _ output.BatchOutput = &Statsd{}
@@ -31,12 +31,17 @@ func (s *Stdout) Connect() error {
 	return nil
 }
 
-func (s *Stdout) Send(data []byte) error {
-	fmt.Println(string(data))
+func (s *Stdout) Send(msg *output.Message) error {
+	fmt.Println(string(msg.Data))
+	return nil
+}
+
+func (s *Stdout) SendBatch(b *output.Batch) error {
+	fmt.Println(string(b.Data))
 	return nil
 }
 
 func (s *Stdout) Close() {
 }
 
-var _ output.Output = &Stdout{}
+var _ output.BatchOutput = &Stdout{}
@@ -0,0 +1,92 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Auth represents the TLS and authentication overrides for a single target
+// that have been set using annotations.  Any secrets are pulled from the
+// namespace of the target.
+type Auth struct {
+	// TLSServerName overrides the server name used to verify the certificate.
+	TLSServerName string
+	// TLSInsecureSkipVerify overrides certificate verification if set.
+	TLSInsecureSkipVerify *bool
+	// TLSSecret is the name of a kubernetes.io/tls secret containing the
+	// client certificate and key and optionally the CA certificate.
+	TLSSecret string
+	// BearerTokenSecret is the name of a secret containing the bearer token
+	// in the token key.
+	BearerTokenSecret string
+	// BasicAuthSecret is the name of a kubernetes.io/basic-auth secret
+	// containing the username and password.
+	BasicAuthSecret string
+}
+
+// HasSecrets returns true if any of the overrides reference a secret.
+func (a Auth) HasSecrets() bool {
+	return a.TLSSecret != "" || a.BearerTokenSecret != "" || a.BasicAuthSecret != ""
+}
+
+// IsZero returns true if no overrides have been set.
+func (a Auth) IsZero() bool {
+	return a.TLSServerName == "" && a.TLSInsecureSkipVerify == nil &&
+		a.TLSSecret == "" && a.BearerTokenSecret == "" && a.BasicAuthSecret == ""
+}
+
+// HasTLS returns true if any of the TLS settings have been overridden.
+func (a Auth) HasTLS() bool {
+	return a.TLSServerName != "" || a.TLSInsecureSkipVerify != nil || a.TLSSecret != ""
+}
+
+// Key returns a string that uniquely identifies the overrides.
+func (a Auth) Key() string {
+	var insecure string
+	if a.TLSInsecureSkipVerify != nil {
+		insecure = strconv.FormatBool(*a.TLSInsecureSkipVerify)
+	}
+
+	return fmt.Sprintf("%s|%s|%s|%s|%s", a.TLSServerName, insecure, a.TLSSecret, a.BearerTokenSecret, a.BasicAuthSecret)
+}
+
+func parseAuth(annotations map[string]string, prefix string) Auth {
+	var auth Auth
+
+	if a, ok := annotations[fmt.Sprintf("%s/tls-server-name", prefix)]; ok {
+		auth.TLSServerName = a
+	}
+
+	if a, ok := annotations[fmt.Sprintf("%s/tls-insecure-skip-verify", prefix)]; ok {
+		insecure := a == "true"
+		auth.TLSInsecureSkipVerify = &insecure
+	}
+
+	if a, ok := annotations[fmt.Sprintf("%s/tls-secret", prefix)]; ok {
+		auth.TLSSecret = a
+	}
+
+	if a, ok := annotations[fmt.Sprintf("%s/bearer-token-secret", prefix)]; ok {
+		auth.BearerTokenSecret = a
+	}
+
+	if a, ok := annotations[fmt.Sprintf("%s/basic-auth-secret", prefix)]; ok {
+		auth.BasicAuthSecret = a
+	}
+
+	return auth
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Sidecar is the well known metrics endpoint of a proxy sidecar.
+type Sidecar struct {
+	Port string
+	Path string
+}
+
+// Sidecars are the sidecars that are scraped when the scrape-sidecars
+// annotation is set, keyed by container name.
+var Sidecars = map[string]Sidecar{
+	"istio-proxy": {Port: "15090", Path: "/stats/prometheus"},
+	"envoy":       {Port: "9901", Path: "/stats/prometheus"},
+}
+
+// NewEndpoints returns a defaulted resource for each of the scrape endpoints of
+// an object.  By default an object has a single endpoint described by the scrape
+// annotations.  Additional endpoints can be added with the following annotations:
+//
+// <prefix>/scrape-ports
+// A comma separated list of port numbers or names.  An endpoint is created for each
+// of the ports in place of the port annotation, all other annotations are shared.
+//
+// <prefix>/<n>.<annotation>
+// Indexed annotations create an additional endpoint for each index.  The endpoint
+// uses the unindexed annotations with the indexed ones (e.g. '<prefix>/1.path' or
+// '<prefix>/1.port') taking precedence.
+func NewEndpoints(a map[string]string, prefix string) []*Resource {
+	var res []*Resource
+
+	if ports, ok := a[fmt.Sprintf("%s/scrape-ports", prefix)]; ok {
+		for _, port := range strings.Split(ports, ",") {
+			port = strings.TrimSpace(port)
+			if port == "" {
+				continue
+			}
+
+			r := New(withPort(a, prefix, port), prefix)
+			res = append(res, r)
+		}
+	}
+
+	if len(res) == 0 {
+		res = append(res, New(a, prefix))
+	}
+
+	indexed := withIndex(a, prefix)
+	indices := make([]int, 0, len(indexed))
+	for n := range indexed {
+		indices = append(indices, n)
+	}
+	sort.Ints(indices)
+
+	for _, n := range indices {
+		merged := make(map[string]string, len(a)+len(indexed[n]))
+		for k, v := range a {
+			merged[k] = v
+		}
+
+		// An indexed port replaces both of the unindexed port annotations so
+		// that the port annotation doesn't take precedence over an indexed
+		// port name.
+		_, hasPort := indexed[n]["port"]
+		_, hasPortName := indexed[n]["port-name"]
+		if hasPort || hasPortName {
+			delete(merged, fmt.Sprintf("%s/port", prefix))
+			delete(merged, fmt.Sprintf("%s/port-name", prefix))
+		}
+
+		for k, v := range indexed[n] {
+			merged[fmt.Sprintf("%s/%s", prefix, k)] = v
+		}
+
+		res = append(res, New(merged, prefix))
+	}
+
+	return res
+}
+
+// NewSidecars returns a resource for each of the known sidecars running in the
+// pod if the scrape-sidecars annotation has been set to 'true'.  The sidecar
+// endpoints share the timeouts, intervals and limits of the pod but not the
+// scheme, path, parameters, headers or authentication.
+//
+// <prefix>/scrape-sidecars
+// Enables scraping of the istio-proxy and envoy sidecars.
+func NewSidecars(a map[string]string, prefix string, containers []corev1.Container) []*Resource {
+	if a[fmt.Sprintf("%s/scrape-sidecars", prefix)] != "true" {
+		return nil
+	}
+
+	var res []*Resource
+	for _, c := range containers {
+		sidecar, ok := Sidecars[c.Name]
+		if !ok {
+			continue
+		}
+
+		r := New(a, prefix)
+		r.Scheme = DefaultSchemeAnnotation
+		r.Port = sidecar.Port
+		r.PortName = ""
+		r.Path = sidecar.Path
+		r.Params = nil
+		r.Headers = nil
+		r.Auth = Auth{}
+		r.Container = c.Name
+		res = append(res, r)
+	}
+
+	return res
+}
+
+// WithContainer sets the container of the resource to the container of the pod
+// exposing the scrape port.  It must be called after the port has been resolved.
+func (r *Resource) WithContainer(containers []corev1.Container) *Resource {
+	if r.Container != "" {
+		return r
+	}
+
+	port, err := strconv.ParseInt(r.Port, 10, 32)
+	if err != nil {
+		return r
+	}
+
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if int64(p.ContainerPort) == port {
+				r.Container = c.Name
+				r.Metadata.Container = c.Name
+				return r
+			}
+		}
+	}
+
+	return r
+}
+
+// withPort returns a copy of the annotations with the port annotation replaced.
+func withPort(a map[string]string, prefix string, port string) map[string]string {
+	out := make(map[string]string, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+
+	delete(out, fmt.Sprintf("%s/port-name", prefix))
+	out[fmt.Sprintf("%s/port", prefix)] = port
+	return out
+}
+
+// withIndex returns the indexed annotations grouped by index and keyed by the
+// unindexed annotation name.
+func withIndex(a map[string]string, prefix string) map[int]map[string]string {
+	out := make(map[int]map[string]string)
+	for name, value := range withPrefix(a, fmt.Sprintf("%s/", prefix)) {
+		index, key, ok := strings.Cut(name, ".")
+		if !ok || key == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(index)
+		if err != nil || n < 0 {
+			continue
+		}
+
+		if out[n] == nil {
+			out[n] = make(map[string]string)
+		}
+		out[n][key] = value
+	}
+	return out
+}
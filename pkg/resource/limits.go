@@ -0,0 +1,64 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Limits represents the scrape limits for a single target that have been set
+// using annotations.  Limits that have not been set are nil and the collector
+// limits are used.  A limit of 0 disables the limit for the target.
+type Limits struct {
+	// BodySize is the maximum size of the uncompressed response in bytes.
+	BodySize *int64
+	// Samples is the maximum number of samples after filtering.
+	Samples *int64
+	// Labels is the maximum number of labels per sample.
+	Labels *int64
+	// LabelNameLength is the maximum length of a label name.
+	LabelNameLength *int64
+	// LabelValueLength is the maximum length of a label value.
+	LabelValueLength *int64
+}
+
+func parseLimits(annotations map[string]string, prefix string) Limits {
+	var limits Limits
+
+	limits.BodySize = parseLimit(annotations, fmt.Sprintf("%s/body-size-limit", prefix))
+	limits.Samples = parseLimit(annotations, fmt.Sprintf("%s/sample-limit", prefix))
+	limits.Labels = parseLimit(annotations, fmt.Sprintf("%s/label-limit", prefix))
+	limits.LabelNameLength = parseLimit(annotations, fmt.Sprintf("%s/label-name-length-limit", prefix))
+	limits.LabelValueLength = parseLimit(annotations, fmt.Sprintf("%s/label-value-length-limit", prefix))
+
+	return limits
+}
+
+// parseLimit returns the value of the limit annotation.  Missing, invalid and
+// negative values are ignored.
+func parseLimit(annotations map[string]string, name string) *int64 {
+	a, ok := annotations[name]
+	if !ok {
+		return nil
+	}
+
+	v, err := strconv.ParseInt(a, 10, 64)
+	if err != nil || v < 0 {
+		return nil
+	}
+
+	return &v
+}
@@ -23,15 +23,32 @@ import (
 // pass on as tags.
 type Metadata struct {
 	Kind            string
+	Name            string
 	ResourceVersion string
 	Namespace       string
+	// Container is the name of the container exposing the scrape endpoint
+	// of a pod.  It's only set when it can be determined from the pod spec.
+	Container string
 }
 
 // NewMetadata creates a new metadata object using information found from a client.Object
 // interface.
 func NewMetadata(obj client.Object) Metadata {
+	kind := obj.GetObjectKind().GroupVersionKind().GroupKind().String()
+	// Typed objects pulled from the cache don't have their type meta populated
+	// so fall back to the known types.
+	if kind == "" {
+		switch obj.(type) {
+		case *corev1.Pod:
+			kind = "Pod"
+		case *corev1.Service:
+			kind = "Service"
+		}
+	}
+
 	return Metadata{
-		Kind:            obj.GetObjectKind().GroupVersionKind().GroupKind().String(),
+		Kind:            kind,
+		Name:            obj.GetName(),
 		Namespace:       obj.GetNamespace(),
 		ResourceVersion: obj.GetResourceVersion(),
 	}
@@ -42,6 +59,7 @@ func NewMetadata(obj client.Object) Metadata {
 func NewMetadataFromRef(obj corev1.ObjectReference) Metadata {
 	return Metadata{
 		Kind:            obj.GetObjectKind().GroupVersionKind().GroupKind().String(),
+		Name:            obj.Name,
 		Namespace:       obj.Namespace,
 		ResourceVersion: obj.ResourceVersion,
 	}
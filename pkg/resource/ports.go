@@ -0,0 +1,85 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Ports maps the names of the ports exposed by a discovered object to their
+// port numbers.
+type Ports map[string]int32
+
+// ContainerPorts returns the named ports of the containers of a pod.
+func ContainerPorts(containers []corev1.Container) Ports {
+	ports := make(Ports)
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if p.Name != "" {
+				ports[p.Name] = p.ContainerPort
+			}
+		}
+	}
+	return ports
+}
+
+// ServicePorts returns the named ports of a service.
+func ServicePorts(servicePorts []corev1.ServicePort) Ports {
+	ports := make(Ports)
+	for _, p := range servicePorts {
+		if p.Name != "" {
+			ports[p.Name] = p.Port
+		}
+	}
+	return ports
+}
+
+// EndpointPorts returns the named ports of an endpoint subset.
+func EndpointPorts(endpointPorts []corev1.EndpointPort) Ports {
+	ports := make(Ports)
+	for _, p := range endpointPorts {
+		if p.Name != "" {
+			ports[p.Name] = p.Port
+		}
+	}
+	return ports
+}
+
+// ResolvePort replaces a named port with its number.  An error is returned if
+// the object does not expose a port with the name, in which case the resource
+// can not be scraped.
+func (r *Resource) ResolvePort(ports Ports) error {
+	if r.PortName == "" {
+		return nil
+	}
+
+	port, ok := ports[r.PortName]
+	if !ok {
+		return fmt.Errorf("port %s not found", r.PortName)
+	}
+
+	r.Port = strconv.Itoa(int(port))
+	return nil
+}
+
+// isPortNumber returns true if the port annotation is a port number rather
+// than the name of a port.
+func isPortNumber(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
@@ -16,6 +16,9 @@ package resource
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -39,6 +42,8 @@ type Resource struct {
 	Scrape             bool
 	Scheme             string
 	Port               string
+	PortName           string
+	Container          string
 	Path               string
 	IncludeMetadata    bool
 	Metadata           Metadata
@@ -46,6 +51,13 @@ type Resource struct {
 	Labels             Labels
 	IncludeAnnotations []string
 	Annotations        Annotations
+	Auth               Auth
+	Limits             Limits
+	Timeout            time.Duration
+	Interval           time.Duration
+	Params             url.Values
+	Headers            map[string]string
+	Removed            bool
 	Timestamp          time.Time
 }
 
@@ -76,6 +88,7 @@ func (r *Resource) WithLabels(labels map[string]string) *Resource {
 // that will be used for tags in the collection process.
 func (r *Resource) WithMetadata(obj client.Object) *Resource {
 	r.Metadata = NewMetadata(obj)
+	r.Metadata.Container = r.Container
 	return r
 }
 
@@ -84,9 +97,22 @@ func (r *Resource) WithMetadata(obj client.Object) *Resource {
 // since they point back to existing pods and not the parent service.
 func (r *Resource) WithMetadataRef(obj *corev1.ObjectReference) *Resource {
 	r.Metadata = NewMetadataFromRef(*obj)
+	r.Metadata.Container = r.Container
 	return r
 }
 
+// URL returns the scrape url of the resource including any query parameters.
+// IPv6 addresses are bracketed.
+func (r *Resource) URL() string {
+	u := url.URL{
+		Scheme:   r.Scheme,
+		Host:     net.JoinHostPort(r.IP, r.Port),
+		Path:     r.Path,
+		RawQuery: r.Params.Encode(),
+	}
+	return u.String()
+}
+
 // defaulted returns a new resources defaulted with the scrap annotations. By default
 // we support the common prometheus annotations using the prefix "prometheus.io" as
 // to be a drop in replacement for the prometheus operator.  The prefix can be changed
@@ -106,12 +132,67 @@ func (r *Resource) WithMetadataRef(obj *corev1.ObjectReference) *Resource {
 // will need to add TLS information in the Collector manifest.
 //
 // <prefix>/port
-// The port annotation is used to override the default scrape port of 9090.
+// The port annotation is used to override the default scrape port of 9090.  Either the
+// port number or the name of a port exposed by the target (e.g. 'metrics') can be used.
+// Named ports are resolved against the container ports of pods and the ports of services
+// and endpoints during discovery.
+//
+// <prefix>/port-name
+// The name of the port to scrape when the port annotation has not been set.
 //
 // <prefix>/path
 // The path annotation is used to overrid the default scrape path which is set to
 // '/metrics' by default.
 //
+// <prefix>/tls-server-name
+// The server name used to verify the certificate of the target.  Overrides the
+// collector TLS configuration.
+//
+// <prefix>/tls-insecure-skip-verify
+// Disables certificate verification when set to 'true'.  Overrides the collector
+// TLS configuration.
+//
+// <prefix>/tls-secret
+// The name of a kubernetes.io/tls secret in the namespace of the target holding
+// the client certificate (tls.crt), key (tls.key) and optionally the CA (ca.crt).
+// Only honored when the collector enables targetSecrets.
+//
+// <prefix>/bearer-token-secret
+// The name of a secret in the namespace of the target holding the bearer token in
+// the token key.  Overrides the collector authentication.  Only honored when the
+// collector enables targetSecrets.
+//
+// <prefix>/basic-auth-secret
+// The name of a kubernetes.io/basic-auth secret in the namespace of the target.
+// Overrides the collector authentication.  Only honored when the collector enables
+// targetSecrets.
+//
+// <prefix>/timeout
+// The scrape timeout of the target as a duration (e.g. '10s').  Overrides the default
+// timeout of the collector.
+//
+// <prefix>/interval
+// The scrape interval of the target as a duration (e.g. '1m').  Overrides the interval
+// of the discovery service.
+//
+// <prefix>/param-<name>
+// Adds the <name> query parameter to the scrape url.
+//
+// <prefix>/header-<name>
+// Adds the <name> header to the scrape request.
+//
+// <prefix>/body-size-limit
+// The maximum size of the uncompressed scrape response in bytes.  Overrides the collector
+// limit, 0 disables the limit.
+//
+// <prefix>/sample-limit
+// The maximum number of samples accepted after filtering.  Overrides the collector limit,
+// 0 disables the limit.
+//
+// <prefix>/label-limit, <prefix>/label-name-length-limit, <prefix>/label-value-length-limit
+// The maximum number of labels per sample and the maximum length of the label names and
+// values.  Overrides the collector limits, 0 disables the limit.
+//
 // TODO:
 // Warning, remember that tags can explode cardinality in certain systems which can degrade
 // performance signifcantly and increase cost - be it from self managed or vendor solutions.
@@ -151,9 +232,19 @@ func defaulted(annotations map[string]string, prefix string) *Resource {
 		res.Scheme = a
 	}
 
+	portNameAnnotation := fmt.Sprintf("%s/port-name", prefix)
+	if a, ok := annotations[portNameAnnotation]; ok && a != "" {
+		res.PortName = a
+	}
+
 	portAnnotation := fmt.Sprintf("%s/port", prefix)
 	if a, ok := annotations[portAnnotation]; ok {
-		res.Port = a
+		if isPortNumber(a) {
+			res.Port = a
+			res.PortName = ""
+		} else {
+			res.PortName = a
+		}
 	}
 
 	pathAnnotation := fmt.Sprintf("%s/path", prefix)
@@ -161,6 +252,33 @@ func defaulted(annotations map[string]string, prefix string) *Resource {
 		res.Path = a
 	}
 
+	timeoutAnnotation := fmt.Sprintf("%s/timeout", prefix)
+	if a, ok := annotations[timeoutAnnotation]; ok {
+		res.Timeout = parseDuration(a)
+	}
+
+	intervalAnnotation := fmt.Sprintf("%s/interval", prefix)
+	if a, ok := annotations[intervalAnnotation]; ok {
+		res.Interval = parseDuration(a)
+	}
+
+	for name, value := range withPrefix(annotations, fmt.Sprintf("%s/param-", prefix)) {
+		if res.Params == nil {
+			res.Params = make(url.Values)
+		}
+		res.Params.Set(name, value)
+	}
+
+	for name, value := range withPrefix(annotations, fmt.Sprintf("%s/header-", prefix)) {
+		if res.Headers == nil {
+			res.Headers = make(map[string]string)
+		}
+		res.Headers[name] = value
+	}
+
+	res.Auth = parseAuth(annotations, prefix)
+	res.Limits = parseLimits(annotations, prefix)
+
 	// TODO: add annotation for metadata inclusion.  Right now we only allow this
 	// in the manifest, but that's an all or nothing approach and it would be better
 	// just to add an annotation as an option to selectively enable metadata scraping.
@@ -169,3 +287,25 @@ func defaulted(annotations map[string]string, prefix string) *Resource {
 
 	return res
 }
+
+// parseDuration parses the duration annotation.  Invalid or non-positive values
+// are ignored and zero is returned so the defaults are used.
+func parseDuration(s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// withPrefix returns the annotations that start with the prefix keyed by the
+// remainder of the annotation name.
+func withPrefix(annotations map[string]string, prefix string) map[string]string {
+	out := make(map[string]string)
+	for k, v := range annotations {
+		if name, ok := strings.CutPrefix(k, prefix); ok && name != "" {
+			out[name] = v
+		}
+	}
+	return out
+}
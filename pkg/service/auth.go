@@ -0,0 +1,131 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"ctx.sh/strata-collector/pkg/apis/strata.ctx.sh/v1beta1"
+	"golang.org/x/oauth2/clientcredentials"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Authenticator adds the credentials to a scrape request.
+type Authenticator func(*http.Request) error
+
+// AuthenticatorFactory creates the authenticator from the scrape auth
+// configuration.  A nil authenticator is returned if no authentication has
+// been configured.
+func AuthenticatorFactory(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.ScrapeAuth) (Authenticator, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	switch {
+	case obj.BearerToken != nil:
+		token, err := GetSecretValue(ctx, c, namespace, obj.BearerToken)
+		if err != nil {
+			return nil, err
+		}
+		return bearerAuth(string(token)), nil
+	case obj.BearerTokenFile != nil:
+		return bearerFileAuth(*obj.BearerTokenFile), nil
+	case obj.Basic != nil:
+		username, err := GetSecretValue(ctx, c, namespace, obj.Basic.Username)
+		if err != nil {
+			return nil, err
+		}
+
+		password, err := GetSecretValue(ctx, c, namespace, obj.Basic.Password)
+		if err != nil {
+			return nil, err
+		}
+		return basicAuth(string(username), string(password)), nil
+	case obj.OAuth2 != nil:
+		return oauth2Auth(ctx, c, namespace, obj.OAuth2)
+	default:
+		return nil, nil
+	}
+}
+
+func bearerAuth(token string) Authenticator {
+	token = strings.TrimSpace(token)
+	return func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// bearerFileAuth reads the token on every request so that rotated tokens are
+// picked up.
+func bearerFileAuth(path string) Authenticator {
+	return func(req *http.Request) error {
+		token, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		return nil
+	}
+}
+
+func basicAuth(username, password string) Authenticator {
+	return func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	}
+}
+
+// oauth2Auth uses the client credentials flow.  Tokens are cached and only
+// refreshed when they expire.
+func oauth2Auth(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.OAuth2) (Authenticator, error) {
+	id, err := GetSecretValue(ctx, c, namespace, obj.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := GetSecretValue(ctx, c, namespace, obj.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	config := clientcredentials.Config{
+		ClientID:     strings.TrimSpace(string(id)),
+		ClientSecret: strings.TrimSpace(string(secret)),
+		TokenURL:     *obj.TokenURL,
+		Scopes:       obj.Scopes,
+	}
+
+	if len(obj.EndpointParams) > 0 {
+		config.EndpointParams = make(map[string][]string, len(obj.EndpointParams))
+		for k, v := range obj.EndpointParams {
+			config.EndpointParams.Set(k, v)
+		}
+	}
+
+	// The token source outlives the reconcile so it can't use its context.
+	source := config.TokenSource(context.Background())
+	return func(req *http.Request) error {
+		token, err := source.Token()
+		if err != nil {
+			return err
+		}
+		token.SetAuthHeader(req)
+		return nil
+	}, nil
+}
@@ -23,17 +23,20 @@ import (
 	"ctx.sh/strata-collector/pkg/apis/strata.ctx.sh/v1beta1"
 	"ctx.sh/strata-collector/pkg/encoder"
 	"ctx.sh/strata-collector/pkg/filter"
-	"ctx.sh/strata-collector/pkg/output"
 	"ctx.sh/strata-collector/pkg/resource"
 	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type CollectionPoolOpts struct {
-	Cache    cache.Cache
-	Client   client.Client
+	Cache  cache.Cache
+	Client client.Client
+	// Secrets is used to read the secrets referenced by the collector and
+	// the scrape targets.  It should not be backed by the cache.
+	Secrets  client.Reader
 	Discard  bool
 	Logger   logr.Logger
 	Metrics  *strata.Metrics
@@ -46,14 +49,15 @@ type CollectionPool struct {
 	cache      cache.Cache
 	client     client.Client
 	numWorkers int64
-	encoder    encoder.Encoder
 	filters    *filter.Filter
 	workers    []*CollectionWorker
+	outputs    []*OutputWorker
 	registry   *Registry
 	logger     logr.Logger
 	metrics    *strata.Metrics
-	output     output.Output
 	stats      *CollectionStats
+	targets    *TargetStats
+	scraper    *Scraper
 	obj        *v1beta1.Collector
 
 	stopChan chan struct{}
@@ -61,36 +65,94 @@ type CollectionPool struct {
 	sync.Mutex
 }
 
-func NewCollectionPool(obj *v1beta1.Collector, opts *CollectionPoolOpts) *CollectionPool {
+func NewCollectionPool(ctx context.Context, obj *v1beta1.Collector, opts *CollectionPoolOpts) (*CollectionPool, error) {
+	stats := NewCollectionStats()
+
+	configs := outputConfigs(obj)
+	outputs := make([]*OutputWorker, 0, len(configs))
+	for _, cfg := range configs {
+		log := opts.Logger.WithValues("outputName", cfg.Name)
+
+		encoding := encoder.Options{
+			Metadata:  *cfg.IncludeMetricMetadata,
+			Exemplars: *cfg.IncludeExemplars,
+		}
+
+		out, err := OutputFactory(ctx, opts.Secrets, obj.GetNamespace(), &cfg.CollectorOutput, encoding, log)
+		if err != nil {
+			return nil, err
+		}
+
+		outputs = append(outputs, NewOutputWorker(&OutputWorkerOpts{
+			Name:          cfg.Name,
+			Logger:        log,
+			Output:        out,
+			Encoder:       EncoderFactory(*cfg.Encoder, encoding, log),
+			Filters:       FilterFactory(cfg.Filters),
+			BufferSize:    *cfg.BufferSize,
+			BatchSize:     *cfg.BatchSize,
+			FlushInterval: time.Duration(*cfg.FlushIntervalMilliseconds) * time.Millisecond,
+			Buffer:        BufferFactory(obj, cfg.Name, log),
+			PoolStats:     stats,
+		}))
+	}
+
+	tlsConfig, err := TLSConfigFactory(ctx, opts.Secrets, obj.GetNamespace(), obj.Spec.Scrape.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := AuthenticatorFactory(ctx, opts.Secrets, obj.GetNamespace(), obj.Spec.Scrape.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	scraper := NewScraper(&ScraperOpts{
+		Client:        opts.Secrets,
+		TLS:           tlsConfig,
+		Auth:          auth,
+		TargetSecrets: obj.Spec.Scrape.TargetSecrets != nil && *obj.Spec.Scrape.TargetSecrets,
+	})
+
 	return &CollectionPool{
 		name:       obj.GetName(),
 		namespace:  obj.GetNamespace(),
 		client:     opts.Client,
 		cache:      opts.Cache,
 		registry:   opts.Registry,
-		output:     OutputFactory(obj.Spec.Output),
-		encoder:    EncoderFactory(*obj.Spec.Encoder),
+		outputs:    outputs,
 		obj:        obj,
 		filters:    FilterFactory(obj.Spec.Filters),
 		numWorkers: *obj.Spec.Workers,
 		workers:    make([]*CollectionWorker, *obj.Spec.Workers),
 		logger:     opts.Logger,
 		metrics:    opts.Metrics,
-		stats:      NewCollectionStats(),
+		stats:      stats,
+		targets:    NewTargetStats(),
+		scraper:    scraper,
 		stopChan:   make(chan struct{}),
-	}
+	}, nil
 }
 
 func (p *CollectionPool) Start(ch <-chan resource.Resource) {
 	ctx := context.Background()
 
+	for _, o := range p.outputs {
+		o.Start()
+	}
+
 	for i := int64(0); i < p.numWorkers; i++ {
 		p.workers[i] = NewCollectionWorker(&CollectionWorkerOpts{
-			Logger:  p.logger.WithValues("worker", i),
-			Output:  p.output,
-			Encoder: p.encoder,
-			Filters: p.filters,
-			Stats:   p.stats,
+			Logger:            p.logger.WithValues("worker", i),
+			Scraper:           p.scraper,
+			Outputs:           p.outputs,
+			Filters:           p.filters,
+			Stats:             p.stats,
+			Targets:           p.targets,
+			Limits:            ScrapeLimitsFactory(p.obj.Spec.Scrape),
+			FlattenHistograms: *p.obj.Spec.FlattenHistograms,
+			HonorTimestamps:   *p.obj.Spec.HonorTimestamps,
+			MaxResourceAge:    time.Duration(*p.obj.Spec.MaxResourceAgeSeconds) * time.Second,
 		})
 		p.workers[i].Start(ch)
 	}
@@ -102,6 +164,20 @@ func (p *CollectionPool) Stop() {
 	p.logger.V(8).Info("stopping collection pool")
 	p.stopOnce.Do(func() {
 		close(p.stopChan)
+
+		// Wait for the workers to finish any in progress collections before
+		// stopping the outputs so everything that has been collected is flushed.
+		for _, w := range p.workers {
+			if w != nil {
+				w.Stop()
+			}
+		}
+
+		for _, o := range p.outputs {
+			o.Stop()
+		}
+
+		p.scraper.Close()
 	})
 }
 
@@ -119,6 +195,8 @@ func (p *CollectionPool) status(ctx context.Context) {
 		case <-p.stopChan:
 			return
 		case <-ticker.C:
+			p.expire(time.Now())
+
 			err := p.updateStatus(ctx)
 			if err != nil {
 				p.logger.Error(err, "unable to update status")
@@ -149,6 +227,36 @@ func (p *CollectionPool) updateStatus(ctx context.Context) error {
 		TotalErrors:           p.stats.TotalErrors.Load(),
 		TotalFiltered:         p.stats.TotalFiltered.Load(),
 		MetricsCollected:      p.stats.MetricsCollected.Load(),
+		TotalExpired:          p.stats.TotalExpired.Load(),
+		TotalLimitExceeded:    p.stats.TotalLimitExceeded.Load(),
+		Outputs:               make([]v1beta1.CollectorOutputStatus, 0, len(p.outputs)),
+	}
+
+	for _, o := range p.outputs {
+		stats := o.Stats()
+		obj.Status.Outputs = append(obj.Status.Outputs, v1beta1.CollectorOutputStatus{
+			Name:          o.Name(),
+			TotalSent:     stats.TotalSent.Load(),
+			TotalErrors:   stats.TotalErrors.Load(),
+			TotalFiltered: stats.TotalFiltered.Load(),
+			TotalDropped:  stats.TotalDropped.Load(),
+			TotalBuffered: stats.TotalBuffered.Load(),
+			TotalReplayed: stats.TotalReplayed.Load(),
+		})
+	}
+
+	targets := p.targets.List()
+	obj.Status.TotalTargets = int64(len(targets))
+	if len(targets) > DefaultMaxStatusTargets {
+		targets = targets[:DefaultMaxStatusTargets]
+	}
+
+	for _, t := range targets {
+		obj.Status.Targets = append(obj.Status.Targets, v1beta1.CollectorTargetStatus{
+			URL:        t.URL,
+			Format:     string(t.Format),
+			LastScrape: metav1.NewTime(t.LastScrape),
+		})
 	}
 
 	p.logger.V(8).Info("updating collector status", "status", obj.Status)
@@ -160,4 +268,59 @@ func (p *CollectionPool) updateStatus(ctx context.Context) error {
 	return p.client.Status().Update(ctx, &obj)
 }
 
+// expire ends the series of the targets that have not been scraped within
+// their expiry, including the health series, the same as when a target is
+// no longer discovered.
+func (p *CollectionPool) expire(now time.Time) {
+	for _, t := range p.targets.Expire(now, DefaultTargetExpiry) {
+		p.logger.V(8).Info("ending series of expired target", "resource", t.Resource)
+
+		stale := t.Stale
+		for _, m := range (ScrapeHealth{}).Metrics(t.Resource, now) {
+			if p.filters.Do(m) {
+				continue
+			}
+			stale = append(stale, m.StaleMarker(now))
+		}
+
+		for _, o := range p.outputs {
+			o.Enqueue(t.Resource.Metadata, stale)
+		}
+	}
+}
+
+// outputConfigs returns the outputs configured for the collector.  The single
+// output configuration is treated as an output named default which uses the
+// collector encoder.  Metrics are written to stdout when no outputs have been
+// configured.
+func outputConfigs(obj *v1beta1.Collector) []v1beta1.CollectorOutputConfig {
+	configs := make([]v1beta1.CollectorOutputConfig, 0, len(obj.Spec.Outputs)+1)
+	configs = append(configs, obj.Spec.Outputs...)
+	switch {
+	case obj.Spec.Output != nil:
+		configs = append(configs, defaultOutputConfig(obj, *obj.Spec.Output))
+	case len(configs) == 0:
+		configs = append(configs, defaultOutputConfig(obj, v1beta1.CollectorOutput{Stdout: &v1beta1.Stdout{}}))
+	}
+	return configs
+}
+
+// defaultOutputConfig returns the config of the output named default.
+func defaultOutputConfig(obj *v1beta1.Collector, output v1beta1.CollectorOutput) v1beta1.CollectorOutputConfig {
+	bufferSize := v1beta1.DefaultCollectorOutputBufferSize
+	batchSize := v1beta1.DefaultCollectorOutputBatchSize
+	flushInterval := v1beta1.DefaultCollectorOutputFlushIntervalMilliseconds
+	return v1beta1.CollectorOutputConfig{
+		Name:                      v1beta1.DefaultCollectorOutputName,
+		Encoder:                   obj.Spec.Encoder,
+		IncludeMetricMetadata:     obj.Spec.IncludeMetricMetadata,
+		IncludeExemplars:          obj.Spec.IncludeExemplars,
+		Filters:                   &v1beta1.CollectorFilters{},
+		BufferSize:                &bufferSize,
+		BatchSize:                 &batchSize,
+		FlushIntervalMilliseconds: &flushInterval,
+		CollectorOutput:           output,
+	}
+}
+
 var _ Collector = &CollectionPool{}
@@ -21,6 +21,12 @@ type CollectionStats struct {
 	// MetricsCollected is the number of metrics collected by the collector. This
 	// value is reset at the end of each update cycle.
 	MetricsCollected atomic.Int64
+	// TotalExpired is the number of resources that were dropped because they
+	// waited too long to be collected.
+	TotalExpired atomic.Int64
+	// TotalLimitExceeded is the number of scrapes that failed because they
+	// exceeded one of the scrape limits.
+	TotalLimitExceeded atomic.Int64
 }
 
 func NewCollectionStats() *CollectionStats {
@@ -51,9 +57,19 @@ func (s *CollectionStats) SetMetricsCollected(i int) {
 	s.MetricsCollected.Add(int64(i))
 }
 
+func (s *CollectionStats) SetTotalExpired(i int64) {
+	s.TotalExpired.Add(i)
+}
+
+func (s *CollectionStats) SetTotalLimitExceeded(i int64) {
+	s.TotalLimitExceeded.Add(i)
+}
+
 func (s *CollectionStats) Reset() {
 	s.TotalSent.Store(0)
 	s.TotalErrors.Store(0)
 	s.TotalFiltered.Store(0)
 	s.MetricsCollected.Store(0)
+	s.TotalExpired.Store(0)
+	s.TotalLimitExceeded.Store(0)
 }
@@ -15,15 +15,14 @@
 package service
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"io"
-	"net/http"
+	"sync"
 	"time"
 
-	"ctx.sh/strata-collector/pkg/encoder"
 	"ctx.sh/strata-collector/pkg/filter"
 	"ctx.sh/strata-collector/pkg/metric"
-	"ctx.sh/strata-collector/pkg/output"
 	"ctx.sh/strata-collector/pkg/resource"
 	"github.com/go-logr/logr"
 )
@@ -33,33 +32,50 @@ const (
 )
 
 type CollectionWorkerOpts struct {
-	Logger  logr.Logger
-	Output  output.Output
-	Encoder encoder.Encoder
-	Filters *filter.Filter
-	Stats   *CollectionStats
+	Logger            logr.Logger
+	Scraper           *Scraper
+	Outputs           []*OutputWorker
+	Filters           *filter.Filter
+	Stats             *CollectionStats
+	Targets           *TargetStats
+	Limits            ScrapeLimits
+	FlattenHistograms bool
+	HonorTimestamps   bool
+	MaxResourceAge    time.Duration
 }
 
 type CollectionWorker struct {
-	httpClient http.Client
-	output     output.Output
-	logger     logr.Logger
-	encoder    encoder.Encoder
-	filters    *filter.Filter
-	stats      *CollectionStats
+	scraper   *Scraper
+	outputs   []*OutputWorker
+	logger    logr.Logger
+	filters   *filter.Filter
+	stats     *CollectionStats
+	targets   *TargetStats
+	limits    ScrapeLimits
+	parseOpts metric.ParseOpts
+	maxAge    time.Duration
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	doneChan chan struct{}
 }
 
 func NewCollectionWorker(opts *CollectionWorkerOpts) *CollectionWorker {
 	return &CollectionWorker{
-		// TODO: better client creation and config
-		httpClient: http.Client{
-			Timeout: DefaultTimeout,
-		},
-		encoder: opts.Encoder,
-		output:  opts.Output,
+		scraper: opts.Scraper,
+		outputs: opts.Outputs,
 		logger:  opts.Logger,
 		filters: opts.Filters,
 		stats:   opts.Stats,
+		targets: opts.Targets,
+		limits:  opts.Limits,
+		parseOpts: metric.ParseOpts{
+			Flatten:         opts.FlattenHistograms,
+			HonorTimestamps: opts.HonorTimestamps,
+		},
+		maxAge:   opts.MaxResourceAge,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
 	}
 }
 
@@ -67,81 +83,217 @@ func (w *CollectionWorker) Start(recvChan <-chan resource.Resource) {
 	go w.start(recvChan)
 }
 
+// Stop signals the worker to shut down and blocks until any in progress
+// collection has completed.
+func (w *CollectionWorker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+	})
+	<-w.doneChan
+}
+
 func (w *CollectionWorker) start(recvChan <-chan resource.Resource) {
-	for r := range recvChan {
-		w.collectAndSend(r)
-	}
+	defer close(w.doneChan)
 
-	w.logger.V(8).Info("worker shutting down")
+	for {
+		select {
+		case <-w.stopChan:
+			w.logger.V(8).Info("worker shutting down")
+			return
+		case r, ok := <-recvChan:
+			if !ok {
+				w.logger.V(8).Info("worker shutting down")
+				return
+			}
+			w.collectAndSend(r)
+		}
+	}
 }
 
 func (w *CollectionWorker) collectAndSend(r resource.Resource) {
+	// Removals are never expired, otherwise the series of the target would
+	// not be ended when the queue is backed up.
+	if r.Removed {
+		w.logger.V(8).Info("ending series of removed resource", "resource", r)
+		w.remove(r)
+		return
+	}
+
+	// Resources that have been waiting too long are dropped rather than
+	// collected out of step with the discovery interval.
+	if w.maxAge > 0 && time.Since(r.Timestamp) > w.maxAge {
+		w.logger.V(8).Info("dropping expired resource", "resource", r, "age", time.Since(r.Timestamp))
+		w.stats.SetTotalExpired(1)
+		return
+	}
+
 	w.logger.V(8).Info("collecting resource", "resource", r)
-	metrics, err := w.collect(r)
+	limits := w.limits.For(r)
+	start := time.Now()
+	series := make(map[uint64]metric.Series)
+	scraped, samples, err := w.collect(r, limits, series)
+	duration := time.Since(start)
+
+	// Series that were in the previous scrape but are now missing are ended
+	// with stale markers.  Without limits the kept metrics are sent while the
+	// target is being scraped, so when the scrape fails part way through the
+	// series that were already sent are ended along with those of the
+	// previous scrape, the same as if nothing had been sent.
+	added, stale := w.targets.SetSeries(r, start, series)
 	if err != nil {
+		if errors.Is(err, ErrLimitExceeded) {
+			w.stats.SetTotalLimitExceeded(1)
+		}
 		w.logger.Error(err, "failed to collect resource", "resource", r)
-		return
+
+		_, sent := w.targets.SetSeries(r, start, nil)
+		stale = append(stale, sent...)
+		added = 0
 	}
 
-	err = w.send(metrics)
+	// The health series are sent whether or not the scrape succeeded so that
+	// down targets can be alerted on.
+	health := ScrapeHealth{
+		Up:                 err == nil,
+		Duration:           duration,
+		SamplesScraped:     scraped,
+		SamplesPostRelabel: samples,
+		SeriesAdded:        added,
+	}
+	metrics := append(stale, w.filter(health.Metrics(r, start))...)
+
+	err = w.send(r, metrics)
 	if err != nil {
 		w.logger.Error(err, "failed to send resource", "resource", r)
 		return
 	}
 }
 
-func (w *CollectionWorker) collect(r resource.Resource) ([]*metric.Metric, error) {
-	// TODO: Add timeout, scheme, and other options - this is just a quick
-	// implementation to get things working.
-	url := fmt.Sprintf("%s://%s:%s%s", r.Scheme, r.IP, r.Port, r.Path)
-	req, _ := http.NewRequest("GET", url, nil)
-	resp, err := w.httpClient.Do(req)
+// remove ends all of the series of a target that is no longer discovered,
+// including the health series.
+func (w *CollectionWorker) remove(r resource.Resource) {
+	now := time.Now()
+	stale := w.targets.Remove(r.URL(), now)
+	if stale == nil {
+		return
+	}
+
+	for _, m := range w.filter(ScrapeHealth{}.Metrics(r, now)) {
+		stale = append(stale, m.StaleMarker(now))
+	}
+
+	err := w.send(r, stale)
 	if err != nil {
-		return nil, err
+		w.logger.Error(err, "failed to send resource", "resource", r)
 	}
-	defer resp.Body.Close()
+}
 
-	buf, err := io.ReadAll(resp.Body)
+// collect scrapes the target and streams the exposition through the parser
+// and filters one metric family at a time, so neither the body nor the
+// unfiltered metrics are held in memory.  The sample and label limits apply
+// after filtering and are checked as each family is decoded so that a scrape
+// exceeding them is abandoned early.  When no limits are set the kept metrics
+// are sent to the outputs in chunks as they are decoded, otherwise they are
+// held until the whole scrape is within the limits so that nothing is sent
+// from a scrape that exceeds them.  Each sent metric is recorded in series.
+// The number of samples scraped and kept is returned.
+func (w *CollectionWorker) collect(r resource.Resource, limits ScrapeLimits, series map[uint64]metric.Series) (int, int, error) {
+	timeout := DefaultTimeout
+	if r.Timeout > 0 {
+		timeout = r.Timeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	url := r.URL()
+	resp, err := w.scraper.Get(ctx, r, url)
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
+	defer resp.Body.Close()
 
 	// TODO: determine tags and fields from our config and use the resource struct
 	// to actually return them.
-	m, err := metric.FromPrometheusMetric(time.Now(), buf)
-	if err != nil {
-		return nil, err
+	format := metric.FormatFromContentType(resp.Header.Get("Content-Type"))
+	w.targets.SetFormat(url, format)
+
+	dec := metric.NewDecoder(limits.LimitBody(resp.Body), format, time.Now(), w.parseOpts)
+	defer dec.Close()
+
+	var pending []*metric.Metric
+	flush := func() {
+		for _, m := range pending {
+			series[m.Hash()] = m.Series()
+		}
+
+		if err := w.send(r, pending); err != nil {
+			w.logger.Error(err, "failed to send resource", "resource", r)
+		}
+		pending = nil
+	}
+
+	stream := limits.IsZero()
+
+	var scraped, samples int
+	for {
+		metrics, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return scraped, samples, err
+		}
+
+		w.stats.SetMetricsCollected(len(metrics))
+		scraped += metric.Samples(metrics)
+
+		kept := w.filter(metrics)
+		samples += metric.Samples(kept)
+		if err := limits.CheckSamples(samples); err != nil {
+			return scraped, samples, err
+		}
+		if err := limits.CheckLabels(kept); err != nil {
+			return scraped, samples, err
+		}
+
+		pending = append(pending, kept...)
+		if stream && len(pending) >= DefaultSendChunkSize {
+			flush()
+		}
 	}
+	flush()
 
-	w.stats.SetMetricsCollected(len(m))
-	return m, nil
+	return scraped, samples, nil
 }
 
-func (w *CollectionWorker) send(metrics []*metric.Metric) error {
-	var sent, errors, filtered int64
+// filter applies the collector filters and returns the remaining metrics.
+func (w *CollectionWorker) filter(metrics []*metric.Metric) []*metric.Metric {
+	var filtered int64
 	defer func() {
-		w.stats.SetTotalSent(sent)
-		w.stats.SetTotalErrors(errors)
 		w.stats.SetTotalFiltered(filtered)
 	}()
 
+	keep := make([]*metric.Metric, 0, len(metrics))
 	for _, m := range metrics {
 		if w.filters.Do(m) {
 			filtered++
 			continue
 		}
+		keep = append(keep, m)
+	}
 
-		data, err := w.encoder.Encode(m)
-		if err != nil {
-			errors++
-			w.logger.Error(err, "failed to encode metric", "metric", m)
-			continue
-		}
+	return keep
+}
 
-		if err = w.output.Send(data); err != nil {
-			errors++
-			continue
-		}
+// send fans the metrics out to each of the outputs.
+func (w *CollectionWorker) send(r resource.Resource, metrics []*metric.Metric) error {
+	if len(metrics) == 0 {
+		return nil
 	}
+
+	for _, o := range w.outputs {
+		o.Enqueue(r.Metadata, metrics)
+	}
+
 	return nil
 }
@@ -0,0 +1,203 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"ctx.sh/strata-collector/pkg/filter"
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/resource"
+	"github.com/go-logr/logr"
+)
+
+// exposition serves the body set on it as the text exposition format.
+type exposition struct {
+	body string
+	sync.Mutex
+}
+
+func (e *exposition) set(body string) {
+	e.Lock()
+	defer e.Unlock()
+	e.body = body
+}
+
+func (e *exposition) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.Lock()
+	defer e.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, e.body)
+}
+
+func gauges(names ...string) string {
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n%s 1\n", name, name)
+	}
+	return b.String()
+}
+
+func newTestWorker(t *testing.T, limits ScrapeLimits) (*CollectionWorker, *OutputWorker, *exposition, resource.Resource) {
+	t.Helper()
+
+	exp := &exposition{}
+	srv := httptest.NewServer(exp)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := NewCollectionStats()
+	out := NewOutputWorker(&OutputWorkerOpts{
+		Name:       "test",
+		Logger:     logr.Discard(),
+		BufferSize: 100,
+		PoolStats:  stats,
+	})
+
+	scraper := NewScraper(&ScraperOpts{})
+	t.Cleanup(scraper.Close)
+
+	w := NewCollectionWorker(&CollectionWorkerOpts{
+		Logger:  logr.Discard(),
+		Scraper: scraper,
+		Outputs: []*OutputWorker{out},
+		Filters: filter.New(),
+		Stats:   stats,
+		Targets: NewTargetStats(),
+		Limits:  limits,
+	})
+
+	r := resource.Resource{
+		Scheme: "http",
+		IP:     host,
+		Port:   port,
+		Path:   "/metrics",
+	}
+
+	return w, out, exp, r
+}
+
+// queued returns the metrics that have been queued for the output, split into
+// the scraped metrics and the stale markers by name.  The health series are
+// left out.
+func queued(out *OutputWorker) (map[string]*metric.Metric, map[string]*metric.Metric) {
+	health := map[string]bool{
+		UpMetric:                          true,
+		ScrapeDurationMetric:              true,
+		ScrapeSamplesScrapedMetric:        true,
+		ScrapeSamplesPostRelabelingMetric: true,
+		ScrapeSeriesAddedMetric:           true,
+	}
+
+	metrics := make(map[string]*metric.Metric)
+	stale := make(map[string]*metric.Metric)
+	for {
+		select {
+		case b := <-out.sendChan:
+			for _, m := range b.metrics {
+				switch {
+				case m.Stale:
+					stale[m.Name] = m
+				case !health[m.Name]:
+					metrics[m.Name] = m
+				}
+			}
+		default:
+			return metrics, stale
+		}
+	}
+}
+
+func TestCollectLimitExceeded(t *testing.T) {
+	w, out, exp, r := newTestWorker(t, ScrapeLimits{Samples: DefaultSendChunkSize + 1})
+
+	// Enough series for a chunk to be sent before the limit is exceeded if
+	// the scrape was streamed.
+	names := make([]string, DefaultSendChunkSize+2)
+	for i := range names {
+		names[i] = fmt.Sprintf("series_%d", i)
+	}
+	exp.set(gauges(names...))
+
+	w.collectAndSend(r)
+
+	metrics, stale := queued(out)
+	if len(metrics) != 0 {
+		t.Errorf("expected nothing to be sent from a scrape exceeding the limits, got %d metrics", len(metrics))
+	}
+	if len(stale) != 0 {
+		t.Errorf("expected no stale markers, got %d", len(stale))
+	}
+
+	if n := w.stats.TotalLimitExceeded.Load(); n != 1 {
+		t.Errorf("expected the limit to be exceeded once, got %d", n)
+	}
+}
+
+func TestCollectWithinLimits(t *testing.T) {
+	w, out, exp, r := newTestWorker(t, ScrapeLimits{Samples: 2})
+
+	exp.set(gauges("a", "b"))
+	w.collectAndSend(r)
+
+	metrics, _ := queued(out)
+	if len(metrics) != 2 || metrics["a"] == nil || metrics["b"] == nil {
+		t.Errorf("expected a and b to be sent, got %v", metrics)
+	}
+}
+
+func TestCollectStaleMarkers(t *testing.T) {
+	w, out, exp, r := newTestWorker(t, ScrapeLimits{})
+
+	exp.set(gauges("a", "b"))
+	w.collectAndSend(r)
+	if metrics, stale := queued(out); len(metrics) != 2 || len(stale) != 0 {
+		t.Fatalf("expected 2 metrics and no stale markers, got %v and %v", metrics, stale)
+	}
+
+	// The series that disappears is ended.
+	exp.set(gauges("a"))
+	w.collectAndSend(r)
+	metrics, stale := queued(out)
+	if len(metrics) != 1 || metrics["a"] == nil {
+		t.Errorf("expected a to be sent, got %v", metrics)
+	}
+	if len(stale) != 1 || stale["b"] == nil {
+		t.Errorf("expected a stale marker for b, got %v", stale)
+	}
+
+	// Removing the target ends the remaining series and the health series.
+	r.Removed = true
+	w.collectAndSend(r)
+	_, stale = queued(out)
+	if stale["a"] == nil || stale[UpMetric] == nil {
+		t.Errorf("expected stale markers for a and %s, got %v", UpMetric, stale)
+	}
+}
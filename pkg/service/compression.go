@@ -0,0 +1,123 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// AcceptEncodingHeader is the Accept-Encoding header sent with every
+	// scrape.  zstd is preferred as it is cheaper to decompress.
+	AcceptEncodingHeader = "zstd, gzip;q=0.9, identity;q=0.1"
+)
+
+var (
+	gzipReaders sync.Pool
+	zstdReaders sync.Pool
+)
+
+// decompress replaces the body of the response with a reader that decompresses
+// the body as it is read.  The decoders are pooled and returned when the body
+// is closed.  Any limits applied when reading the body apply to the
+// decompressed size.
+func decompress(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		r, err := gzipReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		resp.Body = &decompressedBody{
+			Reader: r,
+			body:   resp.Body,
+			release: func() {
+				gzipReaders.Put(r)
+			},
+		}
+	case "zstd":
+		r, err := zstdReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		resp.Body = &decompressedBody{
+			Reader: r,
+			body:   resp.Body,
+			release: func() {
+				// Drop the reference to the body before pooling.
+				_ = r.Reset(nil)
+				zstdReaders.Put(r)
+			},
+		}
+	default:
+		return fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+func gzipReader(body io.Reader) (*gzip.Reader, error) {
+	if r, ok := gzipReaders.Get().(*gzip.Reader); ok {
+		if err := r.Reset(body); err != nil {
+			gzipReaders.Put(r)
+			return nil, err
+		}
+		return r, nil
+	}
+
+	return gzip.NewReader(body)
+}
+
+func zstdReader(body io.Reader) (*zstd.Decoder, error) {
+	if r, ok := zstdReaders.Get().(*zstd.Decoder); ok {
+		if err := r.Reset(body); err != nil {
+			zstdReaders.Put(r)
+			return nil, err
+		}
+		return r, nil
+	}
+
+	// A single goroutine is enough since the body is read sequentially and
+	// many scrapes already run concurrently.
+	return zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+}
+
+// decompressedBody reads the decompressed body and closes the original body
+// when it is closed.
+type decompressedBody struct {
+	io.Reader
+	body    io.Closer
+	release func()
+	once    sync.Once
+}
+
+func (d *decompressedBody) Close() error {
+	d.once.Do(d.release)
+	return d.body.Close()
+}
@@ -4,4 +4,36 @@ import "time"
 
 const (
 	DefaultStatusInterval = 5 * time.Second
+	// DefaultTargetExpiry is how long after a target was last scraped that its
+	// series are ended and it is removed from the collector status.
+	DefaultTargetExpiry = 5 * time.Minute
+	// DefaultTargetExpiryIntervals is the number of scrape intervals that a
+	// target is kept for when that is longer than DefaultTargetExpiry.
+	DefaultTargetExpiryIntervals = 3
+	// DefaultMaxStatusTargets is the maximum number of targets listed in the
+	// collector status.  The status object is stored in etcd, so large pools
+	// only list the first targets by url along with the total.
+	DefaultMaxStatusTargets = 100
+	// DefaultSendChunkSize is the number of kept metrics that are queued for
+	// the outputs at a time while a target without limits is being scraped.
+	// Sending the scrape in chunks bounds the metrics held by the collection
+	// worker without using up the output queues on large targets.  Scrapes
+	// with limits are held until they complete and are bounded by the limits.
+	DefaultSendChunkSize = 5000
+	// DefaultScheduleResolution is how often the discovery service checks for
+	// targets that are due to be scraped.  Per target intervals are rounded to
+	// this resolution.
+	DefaultScheduleResolution = time.Second
+	// DefaultScrapeDialTimeout is the maximum time to establish a connection
+	// to a target.
+	DefaultScrapeDialTimeout = 5 * time.Second
+	// DefaultScrapeKeepAlive is the interval between TCP keep-alive probes.
+	DefaultScrapeKeepAlive = 30 * time.Second
+	// DefaultScrapeIdleConnTimeout is how long an idle connection is kept
+	// open.  It needs to be longer than the scrape interval for connections
+	// to be reused between scrapes.
+	DefaultScrapeIdleConnTimeout = 5 * time.Minute
+	// DefaultScrapeMaxIdleConnsPerHost is the number of idle connections kept
+	// for each target.
+	DefaultScrapeMaxIdleConnsPerHost = 2
 )
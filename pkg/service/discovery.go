@@ -47,6 +47,8 @@ type Discovery struct {
 	registry  *Registry
 	enabled   bool
 	interval  time.Duration
+	resources []resource.Resource
+	lastSent  map[string]time.Time
 	logger    logr.Logger
 	metrics   *strata.Metrics
 	obj       *v1beta1.Discovery
@@ -67,6 +69,7 @@ func NewDiscovery(obj *v1beta1.Discovery, opts *DiscoveryOpts) *Discovery {
 		registry:  opts.Registry,
 		enabled:   *obj.Spec.Enabled,
 		interval:  time.Duration(*obj.Spec.IntervalSeconds) * time.Second,
+		lastSent:  make(map[string]time.Time),
 		logger:    opts.Logger,
 		metrics:   opts.Metrics,
 		obj:       obj,
@@ -113,6 +116,11 @@ func (s *Discovery) start(ctx context.Context) {
 	s.intervalRun(ctx)
 
 	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	schedule := time.NewTicker(DefaultScheduleResolution)
+	defer schedule.Stop()
+
 	for {
 		select {
 		case <-s.stopChan:
@@ -121,6 +129,8 @@ func (s *Discovery) start(ctx context.Context) {
 		case <-ticker.C:
 			s.logger.V(8).Info("running discovery")
 			s.intervalRun(ctx)
+		case <-schedule.C:
+			s.scheduledRun(ctx)
 		}
 	}
 }
@@ -139,7 +149,84 @@ func (s *Discovery) intervalRun(ctx context.Context) {
 	// service is blocked on the channel meaning that the collector workers are not
 	// ablel to keep up.  None of which are solved by adding more discovery workers.
 	resources := s.discover(ctx)
-	s.send(ctx, resources)
+	s.stats.SetTotalResources(int64(len(resources)))
+
+	removed := s.schedule(resources)
+	ready, inFlight := s.send(ctx, append(s.due(time.Now()), removed...))
+	s.stats.SetReadyCollectors(ready)
+	s.stats.SetInFlightResources(inFlight)
+}
+
+// scheduledRun sends the previously discovered resources that become due between
+// discovery runs, which allows targets to override the discovery interval.
+func (s *Discovery) scheduledRun(ctx context.Context) {
+	due := s.due(time.Now())
+	if len(due) == 0 {
+		return
+	}
+
+	s.logger.V(8).Info("sending scheduled resources", "count", len(due))
+	s.send(ctx, due)
+}
+
+// schedule replaces the resources that are tracked for scheduling.  The targets
+// that have disappeared since the last discovery are returned marked as removed
+// so the collectors can end their series.
+func (s *Discovery) schedule(resources []resource.Resource) []resource.Resource {
+	s.Lock()
+	defer s.Unlock()
+
+	seen := make(map[string]struct{}, len(resources))
+	for i := range resources {
+		seen[resources[i].URL()] = struct{}{}
+	}
+
+	removed := make([]resource.Resource, 0)
+	for _, r := range s.resources {
+		key := r.URL()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		if _, ok := s.lastSent[key]; !ok {
+			continue
+		}
+
+		delete(s.lastSent, key)
+		r.Removed = true
+		r.Timestamp = time.Now()
+		removed = append(removed, r)
+	}
+
+	s.resources = resources
+	return removed
+}
+
+// due returns the resources whose interval has elapsed since they were last
+// sent.  Resources without an interval override use the discovery interval,
+// which is set on the sent resource so the collectors know the interval.
+func (s *Discovery) due(now time.Time) []resource.Resource {
+	s.Lock()
+	defer s.Unlock()
+
+	due := make([]resource.Resource, 0)
+	for _, r := range s.resources {
+		interval := s.interval
+		if r.Interval > 0 {
+			interval = r.Interval
+		}
+
+		key := r.URL()
+		if last, ok := s.lastSent[key]; ok && now.Sub(last)+DefaultScheduleResolution/2 < interval {
+			continue
+		}
+
+		s.lastSent[key] = now
+		r.Timestamp = now
+		r.Interval = interval
+		due = append(due, r)
+	}
+
+	return due
 }
 
 func (s *Discovery) discover(ctx context.Context) []resource.Resource {
@@ -167,7 +254,9 @@ func (s *Discovery) discover(ctx context.Context) []resource.Resource {
 	return resources
 }
 
-func (s *Discovery) send(ctx context.Context, resources []resource.Resource) {
+// send forwards the resources to each of the collectors and returns the number
+// of ready collectors and the resources that are in flight.
+func (s *Discovery) send(ctx context.Context, resources []resource.Resource) (int64, int64) {
 	// TODO: look at some of the race conditions between getting the send channels
 	// and sending the resources.  There's a chance that the send channel may not
 	// exist because of a collector deletion, so we should probably make sure that
@@ -222,9 +311,7 @@ func (s *Discovery) send(ctx context.Context, resources []resource.Resource) {
 		inFlight += i
 	}
 
-	s.stats.SetReadyCollectors(ready)
-	s.stats.SetInFlightResources(inFlight)
-	s.stats.SetTotalResources(int64(len(resources)))
+	return ready, inFlight
 }
 
 // discoverPods lists all pods that match the selector and if the scrape annotation
@@ -243,19 +330,31 @@ func (s *Discovery) discoverPods(ctx context.Context, res *[]resource.Resource)
 	}
 
 	for _, pod := range list.Items {
-		// TODO: configurable prefix for annotations
-		cr := resource.New(pod.GetAnnotations(), s.prefix)
-		if !cr.Scrape {
-			continue
-		}
+		// A pod can expose multiple scrape endpoints, each of which is collected
+		// as a separate resource tagged with the container exposing it.
+		endpoints := resource.NewEndpoints(pod.GetAnnotations(), s.prefix)
+		endpoints = append(endpoints, resource.NewSidecars(pod.GetAnnotations(), s.prefix, pod.Spec.Containers)...)
+		ports := resource.ContainerPorts(pod.Spec.Containers)
+
+		for _, cr := range endpoints {
+			if !cr.Scrape {
+				continue
+			}
+
+			s.logger.V(8).Info("pod found", "obj", pod.ObjectMeta, "port", cr.Port, "path", cr.Path)
 
-		s.logger.V(8).Info("pod found", "obj", pod.ObjectMeta)
+			if err := cr.ResolvePort(ports); err != nil {
+				s.logger.Error(err, "unable to resolve scrape port", "pod", pod.Name, "namespace", pod.Namespace)
+				continue
+			}
 
-		cr = cr.WithMetadata(pod.DeepCopy()).
-			WithIP(pod.Status.PodIP).
-			WithAnnotations(pod.Annotations).
-			WithLabels(pod.Labels)
-		*res = append(*res, *cr)
+			cr = cr.WithContainer(pod.Spec.Containers).
+				WithMetadata(pod.DeepCopy()).
+				WithIP(pod.Status.PodIP).
+				WithAnnotations(pod.Annotations).
+				WithLabels(pod.Labels)
+			*res = append(*res, *cr)
+		}
 	}
 
 	return nil
@@ -291,11 +390,23 @@ func (s *Discovery) discoverServices(ctx context.Context, res *[]resource.Resour
 		}
 
 		s.logger.V(8).Info("service found", "obj", svc.ObjectMeta)
-		cr = cr.WithMetadata(svc.DeepCopy()).
-			WithIP(svc.Spec.ClusterIP).
-			WithAnnotations(svc.Annotations).
-			WithLabels(svc.Labels)
-		*res = append(*res, *cr)
+		ports := resource.ServicePorts(svc.Spec.Ports)
+		for _, cr := range resource.NewEndpoints(svc.Annotations, s.prefix) {
+			if !cr.Scrape {
+				continue
+			}
+
+			if err := cr.ResolvePort(ports); err != nil {
+				s.logger.Error(err, "unable to resolve scrape port", "service", svc.Name, "namespace", svc.Namespace)
+				continue
+			}
+
+			cr = cr.WithMetadata(svc.DeepCopy()).
+				WithIP(svc.Spec.ClusterIP).
+				WithAnnotations(svc.Annotations).
+				WithLabels(svc.Labels)
+			*res = append(*res, *cr)
+		}
 	}
 
 	return nil
@@ -317,16 +428,28 @@ func (s *Discovery) discoverEndpoints(ctx context.Context, svc corev1.Service, r
 	}
 
 	for _, sset := range endpoints.Subsets {
+		ports := resource.EndpointPorts(sset.Ports)
 		for _, addr := range sset.Addresses {
-			cr := resource.New(svc.Annotations, s.prefix)
-			// We're not checking for the scrape condition here as that we are using
-			// the parent service as the authority for this and it's already been checked.
+			// We're not checking for the scrape condition of the service here as that we
+			// are using the parent service as the authority for this and it's already been
+			// checked.  Indexed endpoints can still opt out.
 			s.logger.V(8).Info("pod found", "obj", svc.ObjectMeta, "ip", addr.IP)
-			cr = cr.WithMetadataRef(addr.TargetRef).
-				WithIP(addr.IP).
-				WithAnnotations(svc.Annotations).
-				WithLabels(svc.Labels)
-			*res = append(*res, *cr)
+			for _, cr := range resource.NewEndpoints(svc.Annotations, s.prefix) {
+				if !cr.Scrape {
+					continue
+				}
+
+				if err := cr.ResolvePort(ports); err != nil {
+					s.logger.Error(err, "unable to resolve scrape port", "service", svc.Name, "namespace", svc.Namespace, "ip", addr.IP)
+					continue
+				}
+
+				cr = cr.WithMetadataRef(addr.TargetRef).
+					WithIP(addr.IP).
+					WithAnnotations(svc.Annotations).
+					WithLabels(svc.Labels)
+				*res = append(*res, *cr)
+			}
 		}
 	}
 
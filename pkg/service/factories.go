@@ -15,41 +15,313 @@
 package service
 
 import (
-	"reflect"
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
 
 	"ctx.sh/strata-collector/pkg/apis/strata.ctx.sh/v1beta1"
+	"ctx.sh/strata-collector/pkg/buffer"
 	"ctx.sh/strata-collector/pkg/encoder"
+	"ctx.sh/strata-collector/pkg/encoder/fluentbit"
 	"ctx.sh/strata-collector/pkg/encoder/json"
+	statsdencoder "ctx.sh/strata-collector/pkg/encoder/statsd"
 	"ctx.sh/strata-collector/pkg/filter"
 	"ctx.sh/strata-collector/pkg/output"
+	"ctx.sh/strata-collector/pkg/output/fluent"
+	"ctx.sh/strata-collector/pkg/output/http"
+	"ctx.sh/strata-collector/pkg/output/kafka"
 	"ctx.sh/strata-collector/pkg/output/nats"
+	"ctx.sh/strata-collector/pkg/output/otlp"
+	"ctx.sh/strata-collector/pkg/output/remotewrite"
+	"ctx.sh/strata-collector/pkg/output/statsd"
 	"ctx.sh/strata-collector/pkg/output/stdout"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func OutputFactory(obj *v1beta1.CollectorOutput) output.Output {
-	var s any
-	// Iterate over the possible output configurations and choose the first non-nil
-	// config.  The validation step should ensure that only one output is configured.
-	output := reflect.ValueOf(*obj)
-	for i := 0; i < output.NumField(); i++ {
-		if !output.Field(i).IsNil() && output.Field(i).Kind() != reflect.String {
-			s = output.Field(i).Interface()
-			break
+// OutputFactory creates the output for the collector.  Any credentials or
+// certificates referenced by the output configuration are pulled from secrets
+// in the collector namespace.  The encoding options are used by the outputs
+// that convert the metrics themselves instead of using an encoder.
+func OutputFactory(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.CollectorOutput, encoding encoder.Options, log logr.Logger) (output.Output, error) {
+	// The validation step ensures that exactly one sink is configured, so the
+	// first one that is set is the only one.
+	switch {
+	case obj.Nats != nil:
+		return natsOutput(ctx, c, namespace, obj.Nats, log)
+	case obj.Kafka != nil:
+		return kafkaOutput(ctx, c, namespace, obj.Kafka, log)
+	case obj.HTTP != nil:
+		return httpOutput(ctx, c, namespace, obj.HTTP, log)
+	case obj.RemoteWrite != nil:
+		return remoteWriteOutput(ctx, c, namespace, obj.RemoteWrite, encoding, log)
+	case obj.OTLP != nil:
+		return otlpOutput(ctx, c, namespace, obj.OTLP, encoding, log)
+	case obj.Fluent != nil:
+		return fluentOutput(ctx, c, namespace, obj.Fluent, log)
+	case obj.Statsd != nil:
+		o := obj.Statsd
+		return statsd.New(statsd.Config{
+			Address:       *o.Address,
+			Protocol:      *o.Protocol,
+			MTU:           int(*o.MTU),
+			FlushInterval: time.Duration(*o.FlushIntervalMilliseconds) * time.Millisecond,
+			Logger:        log.WithValues("output", "statsd"),
+		}), nil
+	case obj.Stdout != nil:
+		return stdout.New(), nil
+	default:
+		return nil, fmt.Errorf("no data sink configured for the output")
+	}
+}
+
+func natsOutput(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.Nats, log logr.Logger) (output.Output, error) {
+	servers := obj.Servers
+	if len(servers) == 0 {
+		servers = []string{fmt.Sprintf("%s:%d", *obj.URL, *obj.Port)}
+	}
+
+	config := nats.Config{
+		Servers:        servers,
+		Subject:        *obj.Subject,
+		Name:           fmt.Sprintf("strata-collector.%s", namespace),
+		MaxReconnects:  int(*obj.MaxReconnects),
+		ReconnectWait:  time.Duration(*obj.ReconnectWaitSeconds) * time.Second,
+		ConnectTimeout: time.Duration(*obj.ConnectTimeoutSeconds) * time.Second,
+		DrainTimeout:   time.Duration(*obj.DrainTimeoutSeconds) * time.Second,
+		Logger:         log.WithValues("output", "nats"),
+	}
+
+	if auth := obj.Auth; auth != nil {
+		values := []struct {
+			sel   *corev1.SecretKeySelector
+			value *string
+		}{
+			{auth.Username, &config.Username},
+			{auth.Password, &config.Password},
+			{auth.Token, &config.Token},
+			{auth.NKeySeed, &config.NKeySeed},
+			{auth.Credentials, &config.Credentials},
+		}
+
+		for _, v := range values {
+			data, err := GetSecretValue(ctx, c, namespace, v.sel)
+			if err != nil {
+				return nil, err
+			}
+			*v.value = string(data)
 		}
 	}
 
-	switch s.(type) {
-	case *v1beta1.Nats:
-		return nats.New()
-	default:
-		return stdout.New()
+	tlsConfig, err := TLSConfigFactory(ctx, c, namespace, obj.TLS)
+	if err != nil {
+		return nil, err
+	}
+	config.TLS = tlsConfig
+
+	return nats.New(config)
+}
+
+func kafkaOutput(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.Kafka, log logr.Logger) (output.Output, error) {
+	config := kafka.Config{
+		Brokers:      obj.Brokers,
+		Topic:        *obj.Topic,
+		Acks:         *obj.Acks,
+		Compression:  *obj.Compression,
+		PartitionKey: kafka.PartitionKey(*obj.PartitionKey),
+		BatchSize:    int(*obj.BatchSize),
+		BatchTimeout: time.Duration(*obj.BatchTimeoutMilliseconds) * time.Millisecond,
+		Logger:       log.WithValues("output", "kafka"),
+	}
+
+	if obj.SASL != nil {
+		config.SASLMechanism = *obj.SASL.Mechanism
+
+		username, err := GetSecretValue(ctx, c, namespace, obj.SASL.Username)
+		if err != nil {
+			return nil, err
+		}
+		config.Username = string(username)
+
+		password, err := GetSecretValue(ctx, c, namespace, obj.SASL.Password)
+		if err != nil {
+			return nil, err
+		}
+		config.Password = string(password)
+	}
+
+	tlsConfig, err := TLSConfigFactory(ctx, c, namespace, obj.TLS)
+	if err != nil {
+		return nil, err
+	}
+	config.TLS = tlsConfig
+
+	return kafka.New(config), nil
+}
+
+func httpOutput(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.HTTP, log logr.Logger) (output.Output, error) {
+	config := http.Config{
+		URL:           *obj.URL,
+		Method:        *obj.Method,
+		Gzip:          *obj.Gzip,
+		BatchSize:     int(*obj.BatchSize),
+		FlushInterval: time.Duration(*obj.FlushIntervalMilliseconds) * time.Millisecond,
+		MaxRetries:    int(*obj.MaxRetries),
+		Timeout:       time.Duration(*obj.TimeoutSeconds) * time.Second,
+		Logger:        log.WithValues("output", "http"),
+	}
+
+	headers, err := headersFactory(ctx, c, namespace, obj.Headers)
+	if err != nil {
+		return nil, err
+	}
+	config.Headers = headers
+
+	tlsConfig, err := TLSConfigFactory(ctx, c, namespace, obj.TLS)
+	if err != nil {
+		return nil, err
+	}
+	config.TLS = tlsConfig
+
+	return http.New(config), nil
+}
+
+func remoteWriteOutput(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.RemoteWrite, encoding encoder.Options, log logr.Logger) (output.Output, error) {
+	config := remotewrite.Config{
+		URL:               *obj.URL,
+		TenantHeader:      *obj.TenantHeader,
+		Shards:            int(*obj.Shards),
+		Capacity:          int(*obj.Capacity),
+		MaxSamplesPerSend: int(*obj.MaxSamplesPerSend),
+		BatchSendDeadline: time.Duration(*obj.BatchSendDeadlineMilliseconds) * time.Millisecond,
+		MaxRetries:        int(*obj.MaxRetries),
+		Timeout:           time.Duration(*obj.TimeoutSeconds) * time.Second,
+		Exemplars:         encoding.Exemplars,
+		Logger:            log.WithValues("output", "remoteWrite"),
+	}
+
+	if obj.Tenant != nil {
+		config.Tenant = *obj.Tenant
+	}
+
+	headers, err := headersFactory(ctx, c, namespace, obj.Headers)
+	if err != nil {
+		return nil, err
+	}
+	config.Headers = headers
+
+	tlsConfig, err := TLSConfigFactory(ctx, c, namespace, obj.TLS)
+	if err != nil {
+		return nil, err
+	}
+	config.TLS = tlsConfig
+
+	return remotewrite.New(config), nil
+}
+
+func otlpOutput(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.OTLP, encoding encoder.Options, log logr.Logger) (output.Output, error) {
+	config := otlp.Config{
+		Endpoint:      *obj.Endpoint,
+		Protocol:      otlp.Protocol(*obj.Protocol),
+		Gzip:          *obj.Gzip,
+		BatchSize:     int(*obj.BatchSize),
+		FlushInterval: time.Duration(*obj.FlushIntervalMilliseconds) * time.Millisecond,
+		MaxRetries:    int(*obj.MaxRetries),
+		Timeout:       time.Duration(*obj.TimeoutSeconds) * time.Second,
+		Metadata:      encoding.Metadata,
+		Exemplars:     encoding.Exemplars,
+		Logger:        log.WithValues("output", "otlp"),
+	}
+
+	headers, err := headersFactory(ctx, c, namespace, obj.Headers)
+	if err != nil {
+		return nil, err
+	}
+	config.Headers = headers
+
+	tlsConfig, err := TLSConfigFactory(ctx, c, namespace, obj.TLS)
+	if err != nil {
+		return nil, err
+	}
+	config.TLS = tlsConfig
+
+	return otlp.New(config), nil
+}
+
+func fluentOutput(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.Fluent, log logr.Logger) (output.Output, error) {
+	config := fluent.Config{
+		Address:       *obj.Address,
+		Tag:           *obj.Tag,
+		RequireAck:    *obj.RequireAck,
+		BatchSize:     int(*obj.BatchSize),
+		FlushInterval: time.Duration(*obj.FlushIntervalMilliseconds) * time.Millisecond,
+		MaxRetries:    int(*obj.MaxRetries),
+		Timeout:       time.Duration(*obj.TimeoutSeconds) * time.Second,
+		Logger:        log.WithValues("output", "fluent"),
 	}
+
+	tlsConfig, err := TLSConfigFactory(ctx, c, namespace, obj.TLS)
+	if err != nil {
+		return nil, err
+	}
+	config.TLS = tlsConfig
+
+	return fluent.New(config)
 }
 
-func EncoderFactory(name string) encoder.Encoder {
+// headersFactory resolves the header values, pulling them from secrets in the
+// collector namespace when required.
+func headersFactory(ctx context.Context, c client.Reader, namespace string, obj []v1beta1.HTTPHeader) (map[string]string, error) {
+	headers := make(map[string]string, len(obj))
+
+	for _, header := range obj {
+		if header.ValueFrom != nil {
+			value, err := GetSecretValue(ctx, c, namespace, header.ValueFrom)
+			if err != nil {
+				return nil, err
+			}
+			headers[header.Name] = string(value)
+		} else if header.Value != nil {
+			headers[header.Name] = *header.Value
+		}
+	}
+
+	return headers, nil
+}
+
+func EncoderFactory(name string, opts encoder.Options, log logr.Logger) encoder.Encoder {
 	switch name {
+	case "statsd":
+		return statsdencoder.New(false, log.WithValues("encoder", name))
+	case "dogstatsd":
+		return statsdencoder.New(true, log.WithValues("encoder", name))
+	case "fluentbit":
+		return fluentbit.New(opts)
 	default:
-		return json.New()
+		return json.New(opts)
+	}
+}
+
+// BufferFactory returns the persistent buffer configuration for the output or
+// nil if the buffer has not been enabled.  Each output is given its own
+// directory under the configured path.
+func BufferFactory(obj *v1beta1.Collector, name string, log logr.Logger) *OutputBufferOpts {
+	cfg := obj.Spec.OutputBuffer
+	if cfg == nil {
+		return nil
+	}
+
+	return &OutputBufferOpts{
+		Config: buffer.Config{
+			Dir:            filepath.Join(*cfg.Path, obj.GetNamespace(), obj.GetName(), name),
+			MaxSize:        *cfg.MaxSizeBytes,
+			MaxSegmentSize: *cfg.MaxSegmentSizeBytes,
+			MaxAge:         time.Duration(*cfg.MaxAgeSeconds) * time.Second,
+			Logger:         log,
+		},
+		ReplayInterval: time.Duration(*cfg.ReplayIntervalSeconds) * time.Second,
 	}
 }
 
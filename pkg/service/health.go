@@ -0,0 +1,105 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"net/url"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/resource"
+)
+
+const (
+	// UpMetric is 1 if the target was scraped successfully and 0 otherwise.
+	UpMetric = "up"
+	// ScrapeDurationMetric is the time it took to scrape the target.
+	ScrapeDurationMetric = "scrape_duration_seconds"
+	// ScrapeSamplesScrapedMetric is the number of samples the target exposed.
+	ScrapeSamplesScrapedMetric = "scrape_samples_scraped"
+	// ScrapeSamplesPostRelabelingMetric is the number of samples remaining
+	// after the collector filters were applied.
+	ScrapeSamplesPostRelabelingMetric = "scrape_samples_post_metric_relabeling"
+	// ScrapeSeriesAddedMetric is the number of series that were not present
+	// in the previous scrape of the target.
+	ScrapeSeriesAddedMetric = "scrape_series_added"
+
+	// InstanceTag is the host and port of the scraped target.
+	InstanceTag = "instance"
+	// NamespaceTag is the namespace of the discovered resource.
+	NamespaceTag = "namespace"
+	// NameTag is the name of the discovered resource.
+	NameTag = "name"
+	// ContainerTag is the container exposing the scrape endpoint of a pod.
+	ContainerTag = "container"
+)
+
+// ScrapeHealth is the outcome of a single scrape.
+type ScrapeHealth struct {
+	Up                 bool
+	Duration           time.Duration
+	SamplesScraped     int
+	SamplesPostRelabel int
+	SeriesAdded        int
+}
+
+// Metrics returns the synthetic series that report the health of the scrape.
+// They mirror the series that prometheus generates for each target and are
+// tagged with the identity of the target so the series of each target are
+// distinct.
+func (h ScrapeHealth) Metrics(r resource.Resource, now time.Time) []*metric.Metric {
+	var up float64
+	if h.Up {
+		up = 1
+	}
+
+	values := []struct {
+		name  string
+		value float64
+	}{
+		{UpMetric, up},
+		{ScrapeDurationMetric, h.Duration.Seconds()},
+		{ScrapeSamplesScrapedMetric, float64(h.SamplesScraped)},
+		{ScrapeSamplesPostRelabelingMetric, float64(h.SamplesPostRelabel)},
+		{ScrapeSeriesAddedMetric, float64(h.SeriesAdded)},
+	}
+
+	metrics := make([]*metric.Metric, 0, len(values))
+	for _, v := range values {
+		m := metric.New(now, v.name, v.value, targetTags(r))
+		m.SetType(metric.Gauge)
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
+
+// targetTags returns the tags that identify the target of the scrape.
+func targetTags(r resource.Resource) map[string]string {
+	tags := map[string]string{
+		NamespaceTag: r.Metadata.Namespace,
+		NameTag:      r.Metadata.Name,
+	}
+
+	if u, err := url.Parse(r.URL()); err == nil {
+		tags[InstanceTag] = u.Host
+	}
+
+	if r.Metadata.Container != "" {
+		tags[ContainerTag] = r.Metadata.Container
+	}
+
+	return tags
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"ctx.sh/strata-collector/pkg/apis/strata.ctx.sh/v1beta1"
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/resource"
+)
+
+var (
+	// ErrLimitExceeded is wrapped by all of the errors returned when a scrape
+	// exceeds one of the limits.
+	ErrLimitExceeded = errors.New("scrape limit exceeded")
+)
+
+// ScrapeLimits are the limits applied to each scrape.  A limit of 0 disables
+// the limit.  The limits follow the prometheus semantics: if any of them are
+// exceeded the whole scrape fails and none of the samples are sent.
+type ScrapeLimits struct {
+	BodySize         int64
+	Samples          int64
+	Labels           int64
+	LabelNameLength  int64
+	LabelValueLength int64
+}
+
+// IsZero returns true if none of the limits are set.
+func (l ScrapeLimits) IsZero() bool {
+	return l.BodySize <= 0 && l.Samples <= 0 && l.Labels <= 0 &&
+		l.LabelNameLength <= 0 && l.LabelValueLength <= 0
+}
+
+// ScrapeLimitsFactory returns the collector scrape limits.
+func ScrapeLimitsFactory(obj *v1beta1.CollectorScrape) ScrapeLimits {
+	if obj == nil {
+		return ScrapeLimits{}
+	}
+
+	var limits ScrapeLimits
+	if obj.BodySizeLimitBytes != nil {
+		limits.BodySize = *obj.BodySizeLimitBytes
+	}
+	if obj.SampleLimit != nil {
+		limits.Samples = *obj.SampleLimit
+	}
+	if obj.LabelLimit != nil {
+		limits.Labels = *obj.LabelLimit
+	}
+	if obj.LabelNameLengthLimit != nil {
+		limits.LabelNameLength = *obj.LabelNameLengthLimit
+	}
+	if obj.LabelValueLengthLimit != nil {
+		limits.LabelValueLength = *obj.LabelValueLengthLimit
+	}
+
+	return limits
+}
+
+// For returns the limits with the annotation overrides of the target applied.
+func (l ScrapeLimits) For(r resource.Resource) ScrapeLimits {
+	if r.Limits.BodySize != nil {
+		l.BodySize = *r.Limits.BodySize
+	}
+	if r.Limits.Samples != nil {
+		l.Samples = *r.Limits.Samples
+	}
+	if r.Limits.Labels != nil {
+		l.Labels = *r.Limits.Labels
+	}
+	if r.Limits.LabelNameLength != nil {
+		l.LabelNameLength = *r.Limits.LabelNameLength
+	}
+	if r.Limits.LabelValueLength != nil {
+		l.LabelValueLength = *r.Limits.LabelValueLength
+	}
+	return l
+}
+
+// LimitBody wraps the response body so that reads fail once the body size
+// limit has been exceeded.  The body is streamed through the parser, so the
+// scrape is aborted as soon as the limit is crossed rather than after the
+// whole body has been read.
+func (l ScrapeLimits) LimitBody(body io.Reader) io.Reader {
+	if l.BodySize <= 0 {
+		return body
+	}
+
+	return &limitedBody{body: body, remaining: l.BodySize, limit: l.BodySize}
+}
+
+// CheckSamples verifies the sample limit against the number of samples seen
+// so far in the scrape.
+func (l ScrapeLimits) CheckSamples(n int) error {
+	if l.Samples > 0 && int64(n) > l.Samples {
+		return fmt.Errorf("%w: %d samples exceeds the limit of %d", ErrLimitExceeded, n, l.Samples)
+	}
+	return nil
+}
+
+// CheckLabels verifies the label limits.  The metric name is counted as a
+// label as it is in prometheus.
+func (l ScrapeLimits) CheckLabels(metrics []*metric.Metric) error {
+	if l.Labels <= 0 && l.LabelNameLength <= 0 && l.LabelValueLength <= 0 {
+		return nil
+	}
+
+	for _, m := range metrics {
+		if l.Labels > 0 && int64(len(m.Tags)+1) > l.Labels {
+			return fmt.Errorf("%w: %s has %d labels which exceeds the limit of %d", ErrLimitExceeded, m.Name, len(m.Tags)+1, l.Labels)
+		}
+
+		if l.LabelValueLength > 0 && int64(len(m.Name)) > l.LabelValueLength {
+			return fmt.Errorf("%w: the name of %s exceeds the label value length limit of %d", ErrLimitExceeded, m.Name, l.LabelValueLength)
+		}
+
+		for k, v := range m.Tags {
+			if l.LabelNameLength > 0 && int64(len(k)) > l.LabelNameLength {
+				return fmt.Errorf("%w: label name %s of %s exceeds the limit of %d", ErrLimitExceeded, k, m.Name, l.LabelNameLength)
+			}
+
+			if l.LabelValueLength > 0 && int64(len(v)) > l.LabelValueLength {
+				return fmt.Errorf("%w: label value of %s on %s exceeds the limit of %d", ErrLimitExceeded, k, m.Name, l.LabelValueLength)
+			}
+		}
+	}
+
+	return nil
+}
+
+// limitedBody returns an error wrapping ErrLimitExceeded once more than the
+// limit has been read from the body.
+type limitedBody struct {
+	body      io.Reader
+	remaining int64
+	limit     int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, fmt.Errorf("%w: body size exceeds the limit of %d bytes", ErrLimitExceeded, b.limit)
+	}
+
+	// Read one byte past the limit so that a body of exactly the limit is
+	// not rejected.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, fmt.Errorf("%w: body size exceeds the limit of %d bytes", ErrLimitExceeded, b.limit)
+	}
+
+	return n, err
+}
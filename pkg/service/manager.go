@@ -39,6 +39,9 @@ type Manager struct {
 
 	cache  cache.Cache
 	client client.Client
+	// reader reads from the API server directly.  It's used for secrets so
+	// that they are not cached by a cluster wide informer.
+	reader client.Reader
 }
 
 func NewManager(mgr ctrl.Manager, opts *ManagerOpts) *Manager {
@@ -48,6 +51,7 @@ func NewManager(mgr ctrl.Manager, opts *ManagerOpts) *Manager {
 		metrics:  opts.Metrics,
 		cache:    mgr.GetCache(),
 		client:   mgr.GetClient(),
+		reader:   mgr.GetAPIReader(),
 	}
 }
 
@@ -78,13 +82,17 @@ func (m *Manager) AddCollectionPool(ctx context.Context, obj *v1beta1.Collector)
 		Name:      obj.Name,
 	}
 
-	collector := NewCollectionPool(obj, &CollectionPoolOpts{
+	collector, err := NewCollectionPool(ctx, obj, &CollectionPoolOpts{
 		Cache:    m.cache,
 		Client:   m.client,
+		Secrets:  m.reader,
 		Logger:   m.logger.WithValues("collector", key),
 		Metrics:  m.metrics,
 		Registry: m.registry,
 	})
+	if err != nil {
+		return err
+	}
 
 	return m.registry.AddCollectionPool(key, collector, *obj.Spec.BufferSize)
 }
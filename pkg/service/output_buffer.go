@@ -0,0 +1,211 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/buffer"
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/output"
+	"ctx.sh/strata-collector/pkg/resource"
+)
+
+// errReplayFailed is returned to stop a replay when the output reports that
+// it failed to deliver messages in the background.
+var errReplayFailed = errors.New("output reported failures during replay")
+
+type OutputBufferOpts struct {
+	Config         buffer.Config
+	ReplayInterval time.Duration
+}
+
+// bufferedRecord is an encoded message or batch that failed to be sent and
+// has been written to the output buffer.
+type bufferedRecord struct {
+	Data     []byte            `json:"data"`
+	Metrics  []*metric.Metric  `json:"metrics"`
+	Resource resource.Metadata `json:"resource"`
+	Batch    bool              `json:"batch,omitempty"`
+}
+
+// store writes the record to the output buffer.  It returns false if the
+// buffer is not enabled or the record could not be written.
+func (w *OutputWorker) store(rec *bufferedRecord) bool {
+	if w.buffer == nil {
+		return false
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		w.logger.Error(err, "unable to encode buffered record")
+		return false
+	}
+
+	dropped, err := w.buffer.Write(data)
+	w.dropped(dropped)
+	if err != nil {
+		w.logger.Error(err, "unable to write to output buffer")
+		return false
+	}
+
+	return true
+}
+
+// failed buffers the messages that an output has failed to deliver in the
+// background.  The messages were counted as sent when they were queued.
+func (w *OutputWorker) failed(msgs []*output.Message) {
+	w.failures.Add(int64(len(msgs)))
+
+	var errors, buffered int64
+	for _, msg := range msgs {
+		rec := &bufferedRecord{
+			Data:     msg.Data,
+			Resource: msg.Resource,
+		}
+		if msg.Metric != nil {
+			rec.Metrics = []*metric.Metric{msg.Metric}
+		}
+
+		if w.store(rec) {
+			buffered++
+		} else {
+			errors++
+		}
+	}
+
+	w.stats.SetTotalErrors(errors)
+	w.stats.SetTotalBuffered(buffered)
+	w.poolStats.SetTotalErrors(errors)
+}
+
+// replay periodically removes expired segments and resends buffered records
+// until the output fails again.
+//
+// Outputs that deliver in the background accept a record before it has been
+// delivered, so a record is removed from the buffer once it is queued and is
+// buffered again if the output reports it failed.  To avoid cycling records
+// through the buffer while the output is down, a replay is stopped as soon as
+// failures are reported and is skipped if any were reported since the last
+// one.
+func (w *OutputWorker) replay() {
+	defer close(w.replayDone)
+
+	if w.buffer == nil {
+		return
+	}
+
+	ticker := time.NewTicker(w.bufferOpts.ReplayInterval)
+	defer ticker.Stop()
+
+	last := w.failures.Load()
+	for {
+		select {
+		case <-w.stopChan:
+			return
+		case <-ticker.C:
+			expired, err := w.buffer.Expire()
+			w.dropped(expired)
+			if err != nil {
+				w.logger.Error(err, "unable to expire output buffer segments")
+			}
+
+			failures := w.failures.Load()
+			if failures != last {
+				last = failures
+				w.logger.V(8).Info("output reported failures, skipping replay")
+				continue
+			}
+
+			var metrics int64
+			replayed, corrupt, err := w.buffer.Replay(w.stopChan, func(data []byte) error {
+				if w.failures.Load() != failures {
+					return errReplayFailed
+				}
+				n, err := w.resend(data)
+				metrics += n
+				return err
+			})
+			w.dropped(corrupt)
+			w.stats.SetTotalReplayed(metrics)
+			w.poolStats.SetTotalSent(metrics)
+
+			if replayed > 0 {
+				w.logger.V(8).Info("replayed buffered records", "records", replayed, "metrics", metrics)
+			}
+
+			if err != nil {
+				w.logger.V(8).Info("output not ready for replay", "error", err.Error())
+			}
+		}
+	}
+}
+
+// resend sends a buffered record to the output, returning the number of
+// metrics that were sent.  Records that can't be decoded or sent to the output
+// are skipped so that they do not block the replay.
+func (w *OutputWorker) resend(data []byte) (int64, error) {
+	var rec bufferedRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		w.logger.Error(err, "skipping invalid buffered record")
+		return 0, nil
+	}
+
+	if rec.Batch {
+		out, ok := w.output.(output.BatchOutput)
+		if !ok {
+			w.logger.Info("skipping buffered batch, the output does not support batches")
+			return 0, nil
+		}
+
+		err := out.SendBatch(&output.Batch{
+			Data:     rec.Data,
+			Metrics:  rec.Metrics,
+			Resource: rec.Resource,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		return int64(len(rec.Metrics)), nil
+	}
+
+	msg := &output.Message{
+		Data:     rec.Data,
+		Resource: rec.Resource,
+	}
+	if len(rec.Metrics) > 0 {
+		msg.Metric = rec.Metrics[0]
+	}
+
+	if err := w.output.Send(msg); err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// dropped records the number of buffered records that have been dropped.  The
+// buffer only tracks records, so a dropped batch is counted once.
+func (w *OutputWorker) dropped(n int64) {
+	if n == 0 {
+		return
+	}
+
+	w.stats.SetTotalDropped(n)
+	w.poolStats.SetTotalErrors(n)
+}
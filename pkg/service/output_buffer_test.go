@@ -0,0 +1,107 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/buffer"
+	"ctx.sh/strata-collector/pkg/output"
+	"github.com/go-logr/logr"
+)
+
+// asyncOutput accepts every message and reports it as failed while down, the
+// same as an output that delivers in the background.
+type asyncOutput struct {
+	down    atomic.Bool
+	sent    atomic.Int64
+	handler output.FailureHandler
+	sync.Mutex
+}
+
+func (o *asyncOutput) Connect() error { return nil }
+
+func (o *asyncOutput) Close() {}
+
+func (o *asyncOutput) OnFailure(fn output.FailureHandler) {
+	o.Lock()
+	defer o.Unlock()
+	o.handler = fn
+}
+
+func (o *asyncOutput) Send(msg *output.Message) error {
+	o.sent.Add(1)
+	if o.down.Load() {
+		o.Lock()
+		fn := o.handler
+		o.Unlock()
+		fn([]*output.Message{msg})
+	}
+	return nil
+}
+
+func TestReplayStopsOnReportedFailures(t *testing.T) {
+	out := &asyncOutput{}
+	out.down.Store(true)
+
+	interval := 10 * time.Millisecond
+	w := NewOutputWorker(&OutputWorkerOpts{
+		Name:   "test",
+		Logger: logr.Discard(),
+		Output: out,
+		Buffer: &OutputBufferOpts{
+			Config: buffer.Config{
+				Dir:            t.TempDir(),
+				MaxSize:        1 << 20,
+				MaxSegmentSize: 1 << 16,
+				MaxAge:         time.Hour,
+				Logger:         logr.Discard(),
+			},
+			ReplayInterval: interval,
+		},
+		PoolStats: NewCollectionStats(),
+	})
+	w.Start()
+	defer w.Stop()
+
+	msgs := make([]*output.Message, 5)
+	for i := range msgs {
+		msgs[i] = &output.Message{Data: []byte("{}")}
+	}
+	w.failed(msgs)
+
+	// A replay stops at the first reported failure and the following one is
+	// skipped, so at most one record is resent every other interval rather
+	// than the whole buffer on every interval.
+	time.Sleep(20 * interval)
+	if sent := out.sent.Load(); sent > 11 {
+		t.Errorf("expected at most 11 records to be resent while the output is down, got %d", sent)
+	}
+
+	out.down.Store(false)
+	out.sent.Store(0)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for out.sent.Load() < int64(len(msgs)) && time.Now().Before(deadline) {
+		time.Sleep(interval)
+	}
+
+	if sent := out.sent.Load(); sent != int64(len(msgs)) {
+		t.Errorf("expected %d records to be replayed once the output recovered, got %d", len(msgs), sent)
+	}
+}
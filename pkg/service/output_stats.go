@@ -0,0 +1,76 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import "sync/atomic"
+
+type OutputStats struct {
+	// TotalSent is the number of metrics that have been sent to the output
+	// successfully.
+	TotalSent atomic.Int64
+	// TotalErrors is the number of metrics that have failed to be encoded or
+	// sent to the output.
+	TotalErrors atomic.Int64
+	// TotalFiltered is the number of metrics that have been filtered out by
+	// the output filters.
+	TotalFiltered atomic.Int64
+	// TotalDropped is the number of metrics that have been dropped because the
+	// output queue or buffer was full.
+	TotalDropped atomic.Int64
+	// TotalBuffered is the number of metrics that have been written to the
+	// output buffer.
+	TotalBuffered atomic.Int64
+	// TotalReplayed is the number of buffered metrics that have been replayed.
+	// Outputs that deliver in the background count a metric once it has been
+	// queued, the same as TotalSent.
+	TotalReplayed atomic.Int64
+}
+
+func NewOutputStats() *OutputStats {
+	return &OutputStats{}
+}
+
+func (s *OutputStats) SetTotalSent(i int64) {
+	s.TotalSent.Add(i)
+}
+
+func (s *OutputStats) SetTotalErrors(i int64) {
+	s.TotalErrors.Add(i)
+}
+
+func (s *OutputStats) SetTotalFiltered(i int64) {
+	s.TotalFiltered.Add(i)
+}
+
+func (s *OutputStats) SetTotalDropped(i int64) {
+	s.TotalDropped.Add(i)
+}
+
+func (s *OutputStats) SetTotalBuffered(i int64) {
+	s.TotalBuffered.Add(i)
+}
+
+func (s *OutputStats) SetTotalReplayed(i int64) {
+	s.TotalReplayed.Add(i)
+}
+
+func (s *OutputStats) Reset() {
+	s.TotalSent.Store(0)
+	s.TotalErrors.Store(0)
+	s.TotalFiltered.Store(0)
+	s.TotalDropped.Store(0)
+	s.TotalBuffered.Store(0)
+	s.TotalReplayed.Store(0)
+}
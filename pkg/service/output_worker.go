@@ -0,0 +1,340 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/apis/strata.ctx.sh/v1beta1"
+	"ctx.sh/strata-collector/pkg/buffer"
+	"ctx.sh/strata-collector/pkg/encoder"
+	"ctx.sh/strata-collector/pkg/filter"
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/output"
+	"ctx.sh/strata-collector/pkg/resource"
+	"github.com/go-logr/logr"
+)
+
+type OutputWorkerOpts struct {
+	Name       string
+	Logger     logr.Logger
+	Output     output.Output
+	Encoder    encoder.Encoder
+	Filters    *filter.Filter
+	BufferSize int64
+	BatchSize  int64
+	// FlushInterval is the maximum time a partial batch is held.
+	FlushInterval time.Duration
+	Buffer        *OutputBufferOpts
+	PoolStats     *CollectionStats
+}
+
+// batch is the set of metrics collected from a single resource.
+type batch struct {
+	resource resource.Metadata
+	metrics  []*metric.Metric
+}
+
+// OutputWorker encodes and sends collected metrics to a single output.  Each
+// output has its own queue so that a slow output does not block the collection
+// workers or any of the other outputs.
+type OutputWorker struct {
+	name      string
+	output    output.Output
+	logger    logr.Logger
+	encoder   encoder.Encoder
+	filters   *filter.Filter
+	batchSize int
+	interval  time.Duration
+	stats     *OutputStats
+	poolStats *CollectionStats
+
+	bufferOpts *OutputBufferOpts
+	buffer     *buffer.Buffer
+	// failures counts the messages reported through the failure handler so
+	// the replay can tell when the output has started failing again.
+	failures atomic.Int64
+
+	sendChan   chan batch
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+	doneChan   chan struct{}
+	replayDone chan struct{}
+}
+
+func NewOutputWorker(opts *OutputWorkerOpts) *OutputWorker {
+	return &OutputWorker{
+		name:       opts.Name,
+		output:     opts.Output,
+		logger:     opts.Logger,
+		encoder:    opts.Encoder,
+		filters:    opts.Filters,
+		batchSize:  int(opts.BatchSize),
+		interval:   opts.FlushInterval,
+		stats:      NewOutputStats(),
+		poolStats:  opts.PoolStats,
+		bufferOpts: opts.Buffer,
+		sendChan:   make(chan batch, opts.BufferSize),
+		stopChan:   make(chan struct{}),
+		doneChan:   make(chan struct{}),
+		replayDone: make(chan struct{}),
+	}
+}
+
+// Start connects the output and starts processing queued batches.
+func (w *OutputWorker) Start() {
+	// Outputs that deliver in the background report failed messages through
+	// the handler so they are buffered the same as failed sends.
+	if r, ok := w.output.(output.FailureReporter); ok {
+		r.OnFailure(w.failed)
+	}
+
+	// Failing to connect is not fatal.  Outputs are expected to retry the
+	// connection in the background.
+	if err := w.output.Connect(); err != nil {
+		w.logger.Error(err, "unable to connect to output")
+	}
+
+	// The buffer is opened here rather than when the worker is created so
+	// the buffer of a pool that is being replaced has already been closed.
+	if w.bufferOpts != nil {
+		b, err := buffer.Open(w.bufferOpts.Config)
+		if err != nil {
+			w.logger.Error(err, "unable to open output buffer, failed sends will be dropped")
+		} else {
+			w.buffer = b
+		}
+	}
+
+	go w.start()
+	go w.replay()
+}
+
+// Stop sends any queued batches and closes the output.  The collection workers
+// must be stopped before the output worker.
+func (w *OutputWorker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+		<-w.replayDone
+
+		close(w.sendChan)
+		<-w.doneChan
+
+		// The output is closed first so that failures reported while it
+		// flushes are still buffered.
+		w.output.Close()
+		if w.buffer != nil {
+			if err := w.buffer.Close(); err != nil {
+				w.logger.Error(err, "unable to close output buffer")
+			}
+		}
+	})
+}
+
+// Name returns the name of the output.
+func (w *OutputWorker) Name() string {
+	return w.name
+}
+
+// Stats returns the output statistics.
+func (w *OutputWorker) Stats() *OutputStats {
+	return w.stats
+}
+
+// Enqueue queues the metrics collected from the resource.  If the queue is
+// full, the metrics are dropped rather than blocking the collection worker.
+func (w *OutputWorker) Enqueue(r resource.Metadata, metrics []*metric.Metric) {
+	select {
+	case w.sendChan <- batch{resource: r, metrics: metrics}:
+	default:
+		dropped := int64(len(metrics))
+		w.stats.SetTotalDropped(dropped)
+		w.poolStats.SetTotalErrors(dropped)
+		w.logger.Info("output queue is full, dropping metrics", "count", dropped)
+	}
+}
+
+func (w *OutputWorker) start() {
+	defer close(w.doneChan)
+
+	// Batches are only used when both the encoder and the output support them,
+	// otherwise each metric is encoded and sent individually.
+	if w.batchSize > 1 {
+		enc, encOk := w.encoder.(encoder.BatchEncoder)
+		out, outOk := w.output.(output.BatchOutput)
+		if encOk && outOk {
+			w.accumulate(enc, out)
+			w.logger.V(8).Info("output worker shutting down")
+			return
+		}
+		w.logger.Info("batching is not supported by the encoder or output, sending individual metrics")
+	}
+
+	for b := range w.sendChan {
+		w.send(b)
+	}
+
+	w.logger.V(8).Info("output worker shutting down")
+}
+
+// accumulate collects the metrics of each resource across the queued batches
+// and sends them once batchSize metrics are pending.  Partial batches are sent
+// when the flush interval passes so that the small scrapes of quiet targets are
+// not held indefinitely.  Anything pending is sent when the queue is closed.
+func (w *OutputWorker) accumulate(enc encoder.BatchEncoder, out output.BatchOutput) {
+	pending := make(map[resource.Metadata][]*metric.Metric)
+
+	interval := w.interval
+	if interval <= 0 {
+		interval = time.Duration(v1beta1.DefaultCollectorOutputFlushIntervalMilliseconds) * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	flush := func() {
+		for r, metrics := range pending {
+			w.sendBatch(r, metrics, enc, out)
+			delete(pending, r)
+		}
+	}
+
+	for {
+		select {
+		case b, ok := <-w.sendChan:
+			if !ok {
+				flush()
+				return
+			}
+
+			var filtered int64
+			keep := pending[b.resource]
+			for _, m := range b.metrics {
+				if w.filters.Do(m) {
+					filtered++
+					continue
+				}
+
+				// The sent batch is retained by the buffer and by outputs
+				// that deliver in the background, so the next batch always
+				// gets a new slice.
+				if keep == nil {
+					keep = make([]*metric.Metric, 0, w.batchSize)
+				}
+				keep = append(keep, m)
+
+				if len(keep) == w.batchSize {
+					w.sendBatch(b.resource, keep, enc, out)
+					keep = nil
+				}
+			}
+			w.stats.SetTotalFiltered(filtered)
+
+			if len(keep) > 0 {
+				pending[b.resource] = keep
+			} else {
+				delete(pending, b.resource)
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (w *OutputWorker) send(b batch) {
+	var sent, errors, filtered, buffered int64
+	defer func() {
+		w.stats.SetTotalSent(sent)
+		w.stats.SetTotalErrors(errors)
+		w.stats.SetTotalFiltered(filtered)
+		w.stats.SetTotalBuffered(buffered)
+		w.poolStats.SetTotalSent(sent)
+		w.poolStats.SetTotalErrors(errors)
+	}()
+
+	for _, m := range b.metrics {
+		if w.filters.Do(m) {
+			filtered++
+			continue
+		}
+
+		data, err := w.encoder.Encode(m)
+		if err != nil {
+			errors++
+			w.logger.Error(err, "failed to encode metric", "metric", m)
+			continue
+		}
+
+		// Some encoders need more than one sample to produce a value.
+		if len(data) == 0 {
+			continue
+		}
+
+		msg := &output.Message{
+			Data:     data,
+			Metric:   m,
+			Resource: b.resource,
+		}
+
+		if err = w.output.Send(msg); err != nil {
+			if w.store(&bufferedRecord{Data: data, Metrics: []*metric.Metric{m}, Resource: b.resource}) {
+				buffered++
+			} else {
+				errors++
+			}
+			continue
+		}
+		sent++
+	}
+}
+
+// sendBatch encodes and sends the metrics of a resource as a single batch.
+func (w *OutputWorker) sendBatch(r resource.Metadata, metrics []*metric.Metric, enc encoder.BatchEncoder, out output.BatchOutput) {
+	var sent, errors, buffered int64
+	defer func() {
+		w.stats.SetTotalSent(sent)
+		w.stats.SetTotalErrors(errors)
+		w.stats.SetTotalBuffered(buffered)
+		w.poolStats.SetTotalSent(sent)
+		w.poolStats.SetTotalErrors(errors)
+	}()
+
+	data, err := enc.EncodeBatch(metrics)
+	if err != nil {
+		errors += int64(len(metrics))
+		w.logger.Error(err, "failed to encode batch", "count", len(metrics))
+		return
+	}
+
+	if len(data) == 0 {
+		return
+	}
+
+	err = out.SendBatch(&output.Batch{
+		Data:     data,
+		Metrics:  metrics,
+		Resource: r,
+	})
+	if err != nil {
+		if w.store(&bufferedRecord{Data: data, Metrics: metrics, Resource: r, Batch: true}) {
+			buffered += int64(len(metrics))
+		} else {
+			errors += int64(len(metrics))
+		}
+		return
+	}
+	sent += int64(len(metrics))
+}
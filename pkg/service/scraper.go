@@ -0,0 +1,341 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/resource"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultScrapeClientExpiry is how long the client for a target with
+	// annotation overrides is reused before the secrets are read again.
+	DefaultScrapeClientExpiry = 5 * time.Minute
+)
+
+var (
+	// ErrTargetSecretsDisabled is returned when a target references a secret
+	// using annotations and the collector has not enabled target secrets.
+	ErrTargetSecretsDisabled = errors.New("target secrets are not enabled for the collector")
+)
+
+type ScraperOpts struct {
+	Client client.Reader
+	TLS    *tls.Config
+	Auth   Authenticator
+	// TargetSecrets allows targets to reference secrets in their namespace
+	// using annotations.
+	TargetSecrets bool
+}
+
+// Scraper performs the scrape requests for a collection pool.  All targets
+// share a single transport so connections are kept alive between scrapes.
+// Targets with annotation overrides get their own client which is cached and
+// rebuilt once it expires so that rotated secrets are picked up.  Only targets
+// that override the TLS configuration need their own transport.
+type Scraper struct {
+	client        client.Reader
+	tls           *tls.Config
+	auth          Authenticator
+	targetSecrets bool
+	transport     *http.Transport
+	base          *scrapeClient
+	targets       map[string]*scrapeClient
+	sync.Mutex
+}
+
+type scrapeClient struct {
+	http      *http.Client
+	transport *http.Transport
+	auth      Authenticator
+	created   time.Time
+}
+
+func NewScraper(opts *ScraperOpts) *Scraper {
+	s := &Scraper{
+		client:        opts.Client,
+		tls:           opts.TLS,
+		auth:          opts.Auth,
+		targetSecrets: opts.TargetSecrets,
+		transport:     newTransport(opts.TLS),
+		targets:       make(map[string]*scrapeClient),
+	}
+
+	s.base = newScrapeClient(s.transport, opts.Auth)
+	return s
+}
+
+// Get scrapes the url of the resource.  The scrape timeout is controlled by the
+// context.
+func (s *Scraper) Get(ctx context.Context, r resource.Resource, url string) (*http.Response, error) {
+	c, err := s.clientFor(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", metric.AcceptHeader)
+	req.Header.Set("Accept-Encoding", AcceptEncodingHeader)
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if c.auth != nil {
+		if err := c.auth(req); err != nil {
+			return nil, fmt.Errorf("unable to authenticate scrape: %w", err)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decompress(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Close closes any idle connections.
+func (s *Scraper) Close() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.transport.CloseIdleConnections()
+	for key, c := range s.targets {
+		c.transport.CloseIdleConnections()
+		delete(s.targets, key)
+	}
+}
+
+func (s *Scraper) clientFor(ctx context.Context, r resource.Resource) (*scrapeClient, error) {
+	if r.Auth.IsZero() {
+		return s.base, nil
+	}
+
+	if r.Auth.HasSecrets() && !s.targetSecrets {
+		return nil, ErrTargetSecretsDisabled
+	}
+
+	key := r.Metadata.Namespace + "/" + r.Auth.Key()
+	if c := s.cached(key); c != nil {
+		return c, nil
+	}
+
+	// The secrets are read without holding the lock so that the scrapes of
+	// other targets are not held up by the API server.
+	transport := s.transport
+	if r.Auth.HasTLS() {
+		tlsConfig, err := s.targetTLS(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		transport = newTransport(tlsConfig)
+	}
+
+	auth, err := s.targetAuth(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newScrapeClient(transport, auth)
+
+	s.Lock()
+	defer s.Unlock()
+
+	// Another scrape with the same overrides may have built a client while
+	// the secrets were being read.
+	if existing, ok := s.targets[key]; ok {
+		if time.Since(existing.created) < DefaultScrapeClientExpiry {
+			s.release(c)
+			return existing, nil
+		}
+		s.release(existing)
+	}
+
+	s.targets[key] = c
+	return c, nil
+}
+
+// cached returns the client built for the overrides if it has not expired.
+// Expired clients are removed.
+func (s *Scraper) cached(key string) *scrapeClient {
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.targets[key]
+	if !ok {
+		return nil
+	}
+
+	if time.Since(c.created) < DefaultScrapeClientExpiry {
+		return c
+	}
+
+	s.release(c)
+	delete(s.targets, key)
+	return nil
+}
+
+// release closes the idle connections of a client that is no longer used
+// unless it shares the transport of the scraper.
+func (s *Scraper) release(c *scrapeClient) {
+	if c.transport != s.transport {
+		c.transport.CloseIdleConnections()
+	}
+}
+
+func newScrapeClient(transport *http.Transport, auth Authenticator) *scrapeClient {
+	return &scrapeClient{
+		http: &http.Client{
+			Transport: transport,
+		},
+		transport: transport,
+		auth:      auth,
+		created:   time.Now(),
+	}
+}
+
+// newTransport returns the transport used for scraping.  Compression is handled
+// by the scraper so that zstd can be negotiated as well as gzip.
+func newTransport(tlsConfig *tls.Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   DefaultScrapeDialTimeout,
+		KeepAlive: DefaultScrapeKeepAlive,
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   DefaultScrapeDialTimeout,
+		ForceAttemptHTTP2:     true,
+		DisableCompression:    true,
+		MaxIdleConnsPerHost:   DefaultScrapeMaxIdleConnsPerHost,
+		IdleConnTimeout:       DefaultScrapeIdleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// targetTLS applies the TLS overrides of the target to the collector TLS
+// configuration.
+func (s *Scraper) targetTLS(ctx context.Context, r resource.Resource) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if s.tls != nil {
+		config = s.tls.Clone()
+	}
+
+	if r.Auth.TLSServerName != "" {
+		config.ServerName = r.Auth.TLSServerName
+	}
+
+	if r.Auth.TLSInsecureSkipVerify != nil {
+		config.InsecureSkipVerify = *r.Auth.TLSInsecureSkipVerify
+	}
+
+	if r.Auth.TLSSecret == "" {
+		return config, nil
+	}
+
+	namespace := r.Metadata.Namespace
+	cert, err := GetSecretValue(ctx, s.client, namespace, secretKey(r.Auth.TLSSecret, corev1.TLSCertKey, false))
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := GetSecretValue(ctx, s.client, namespace, secretKey(r.Auth.TLSSecret, corev1.TLSPrivateKeyKey, false))
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	config.Certificates = []tls.Certificate{pair}
+
+	ca, err := GetSecretValue(ctx, s.client, namespace, secretKey(r.Auth.TLSSecret, corev1.ServiceAccountRootCAKey, true))
+	if err != nil {
+		return nil, err
+	}
+
+	if ca != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("unable to parse CA certificate in secret %s/%s", namespace, r.Auth.TLSSecret)
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// targetAuth returns the authenticator for the target.  The collector
+// authentication is used unless the target references its own credentials.
+func (s *Scraper) targetAuth(ctx context.Context, r resource.Resource) (Authenticator, error) {
+	namespace := r.Metadata.Namespace
+
+	switch {
+	case r.Auth.BearerTokenSecret != "":
+		token, err := GetSecretValue(ctx, s.client, namespace, secretKey(r.Auth.BearerTokenSecret, corev1.ServiceAccountTokenKey, false))
+		if err != nil {
+			return nil, err
+		}
+		return bearerAuth(string(token)), nil
+	case r.Auth.BasicAuthSecret != "":
+		username, err := GetSecretValue(ctx, s.client, namespace, secretKey(r.Auth.BasicAuthSecret, corev1.BasicAuthUsernameKey, false))
+		if err != nil {
+			return nil, err
+		}
+
+		password, err := GetSecretValue(ctx, s.client, namespace, secretKey(r.Auth.BasicAuthSecret, corev1.BasicAuthPasswordKey, true))
+		if err != nil {
+			return nil, err
+		}
+		return basicAuth(string(username), string(password)), nil
+	default:
+		return s.auth, nil
+	}
+}
+
+func secretKey(name, key string, optional bool) *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{
+			Name: name,
+		},
+		Key:      key,
+		Optional: &optional,
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ctx.sh/strata-collector/pkg/resource"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScraperTargetSecrets(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	secrets := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "token",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			corev1.ServiceAccountTokenKey: []byte("secret"),
+		},
+	}).Build()
+
+	r := resource.Resource{
+		Metadata: resource.Metadata{Namespace: "default"},
+		Auth:     resource.Auth{BearerTokenSecret: "token"},
+	}
+
+	tests := []struct {
+		name          string
+		targetSecrets bool
+		err           error
+		auth          string
+	}{
+		{"disabled", false, ErrTargetSecretsDisabled, ""},
+		{"enabled", true, nil, "Bearer secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth = ""
+			s := NewScraper(&ScraperOpts{
+				Client:        secrets,
+				TargetSecrets: tt.targetSecrets,
+			})
+			defer s.Close()
+
+			resp, err := s.Get(context.Background(), r, srv.URL)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if auth != tt.auth {
+				t.Errorf("expected authorization %q, got %q", tt.auth, auth)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GetSecretValue returns the value of the key referenced by the selector.  Secrets
+// are always pulled from the namespace of the collector.  If the selector is nil,
+// an empty value is returned.
+func GetSecretValue(ctx context.Context, c client.Reader, namespace string, sel *corev1.SecretKeySelector) ([]byte, error) {
+	if sel == nil {
+		return nil, nil
+	}
+
+	var secret corev1.Secret
+	err := c.Get(ctx, types.NamespacedName{
+		Namespace: namespace,
+		Name:      sel.Name,
+	}, &secret)
+	if err != nil {
+		if client.IgnoreNotFound(err) == nil && sel.Optional != nil && *sel.Optional {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	value, ok := secret.Data[sel.Key]
+	if !ok {
+		if sel.Optional != nil && *sel.Optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("key %s not found in secret %s/%s", sel.Key, namespace, sel.Name)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/resource"
+)
+
+// TargetState is the last known state of a scrape target.
+type TargetState struct {
+	// URL is the scrape url of the target.
+	URL string
+	// Format is the exposition format that was returned by the target.
+	Format metric.Format
+	// LastScrape is the last time a scrape of the target was attempted.
+	LastScrape time.Time
+
+	resource resource.Resource
+	series   map[uint64]metric.Series
+}
+
+// expired returns true if the target has not been scraped within the expiry
+// or the given number of its intervals, whichever is longer.
+func (t *TargetState) expired(now time.Time, expiry time.Duration) bool {
+	if d := time.Duration(DefaultTargetExpiryIntervals) * t.resource.Interval; d > expiry {
+		expiry = d
+	}
+	return now.Sub(t.LastScrape) > expiry
+}
+
+// ExpiredTarget is a target that has been removed because it has not been
+// scraped within its expiry.
+type ExpiredTarget struct {
+	// Resource is the resource that was last scraped.
+	Resource resource.Resource
+	// Stale holds the stale markers for the series last scraped from the
+	// target.
+	Stale []*metric.Metric
+}
+
+// TargetStats tracks the state of the individual targets scraped by the
+// collection pool.  Targets are removed when they are no longer discovered
+// or when they have not been scraped within their expiry.
+type TargetStats struct {
+	targets map[string]*TargetState
+	sync.Mutex
+}
+
+func NewTargetStats() *TargetStats {
+	return &TargetStats{
+		targets: make(map[string]*TargetState),
+	}
+}
+
+func (s *TargetStats) SetFormat(url string, format metric.Format) {
+	s.Lock()
+	defer s.Unlock()
+
+	t, ok := s.targets[url]
+	if !ok {
+		t = &TargetState{URL: url}
+		s.targets[url] = t
+	}
+
+	t.Format = format
+}
+
+// SetSeries records a scrape attempt of the resource started at now and
+// replaces the series that were last scraped from the target with the series
+// keyed by their hash.  It returns the number of series that were not present
+// in the previous scrape and the stale markers for the series that have
+// disappeared since.
+func (s *TargetStats) SetSeries(r resource.Resource, now time.Time, series map[uint64]metric.Series) (int, []*metric.Metric) {
+	s.Lock()
+	defer s.Unlock()
+
+	url := r.URL()
+	t, ok := s.targets[url]
+	if !ok {
+		t = &TargetState{URL: url}
+		s.targets[url] = t
+	}
+	t.resource = r
+	t.LastScrape = now
+
+	var added int
+	for h := range series {
+		if _, ok := t.series[h]; ok {
+			delete(t.series, h)
+		} else {
+			added++
+		}
+	}
+
+	stale := staleMarkers(t.series, now)
+	t.series = series
+	return added, stale
+}
+
+// Remove removes the target and returns the stale markers for all of the
+// series that were last scraped from it.
+func (s *TargetStats) Remove(url string, now time.Time) []*metric.Metric {
+	s.Lock()
+	defer s.Unlock()
+
+	t, ok := s.targets[url]
+	if !ok {
+		return nil
+	}
+
+	delete(s.targets, url)
+	return staleMarkers(t.series, now)
+}
+
+func staleMarkers(series map[uint64]metric.Series, now time.Time) []*metric.Metric {
+	stale := make([]*metric.Metric, 0, len(series))
+	for _, m := range series {
+		stale = append(stale, m.StaleMarker(now))
+	}
+	return stale
+}
+
+// Expire removes the targets that have not been scraped within the expiry, or
+// DefaultTargetExpiryIntervals of their interval if that is longer, and
+// returns them along with the stale markers for their series.  Targets are
+// normally removed once they are no longer discovered, but the removal is
+// never collected if the discovery is deleted.
+func (s *TargetStats) Expire(now time.Time, expiry time.Duration) []ExpiredTarget {
+	s.Lock()
+	defer s.Unlock()
+
+	var expired []ExpiredTarget
+	for url, t := range s.targets {
+		// Targets are added by SetFormat before the attempt is recorded.
+		if t.LastScrape.IsZero() || !t.expired(now, expiry) {
+			continue
+		}
+
+		delete(s.targets, url)
+		expired = append(expired, ExpiredTarget{
+			Resource: t.resource,
+			Stale:    staleMarkers(t.series, now),
+		})
+	}
+
+	return expired
+}
+
+// List returns the targets sorted by url.
+func (s *TargetStats) List() []TargetState {
+	s.Lock()
+	defer s.Unlock()
+
+	targets := make([]TargetState, 0, len(s.targets))
+	for _, t := range s.targets {
+		targets = append(targets, *t)
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].URL < targets[j].URL
+	})
+
+	return targets
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"ctx.sh/strata-collector/pkg/metric"
+	"ctx.sh/strata-collector/pkg/resource"
+)
+
+func testResource(interval time.Duration) resource.Resource {
+	return resource.Resource{
+		IP:       "10.0.0.1",
+		Port:     "9090",
+		Scheme:   "http",
+		Path:     "/metrics",
+		Interval: interval,
+	}
+}
+
+func testSeries(now time.Time, names ...string) map[uint64]metric.Series {
+	series := make(map[uint64]metric.Series)
+	for _, name := range names {
+		m := metric.New(now, name, 1, map[string]string{"job": "test"})
+		series[m.Hash()] = m.Series()
+	}
+	return series
+}
+
+func staleNames(t *testing.T, stale []*metric.Metric) []string {
+	t.Helper()
+
+	names := make([]string, 0, len(stale))
+	for _, m := range stale {
+		if !m.Stale {
+			t.Errorf("expected %s to be a stale marker", m.Name)
+		}
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestTargetStatsSetSeries(t *testing.T) {
+	s := NewTargetStats()
+	r := testResource(0)
+	now := time.Now()
+
+	added, stale := s.SetSeries(r, now, testSeries(now, "a", "b"))
+	if added != 2 || len(stale) != 0 {
+		t.Fatalf("expected 2 added and no stale markers, got %d and %d", added, len(stale))
+	}
+
+	now = now.Add(time.Minute)
+	added, stale = s.SetSeries(r, now, testSeries(now, "b", "c"))
+	if added != 1 {
+		t.Errorf("expected 1 added, got %d", added)
+	}
+	if names := staleNames(t, stale); len(names) != 1 || names[0] != "a" {
+		t.Errorf("expected a stale marker for a, got %v", names)
+	}
+
+	// A failed scrape still records the attempt and ends every series.
+	now = now.Add(time.Minute)
+	_, stale = s.SetSeries(r, now, nil)
+	if names := staleNames(t, stale); len(names) != 2 || names[0] != "b" || names[1] != "c" {
+		t.Errorf("expected stale markers for b and c, got %v", names)
+	}
+
+	targets := s.List()
+	if len(targets) != 1 || !targets[0].LastScrape.Equal(now) {
+		t.Errorf("expected the failed attempt to be the last scrape, got %v", targets)
+	}
+}
+
+func TestTargetStatsRemove(t *testing.T) {
+	s := NewTargetStats()
+	r := testResource(0)
+	now := time.Now()
+
+	s.SetSeries(r, now, testSeries(now, "a", "b"))
+
+	stale := s.Remove(r.URL(), now)
+	if names := staleNames(t, stale); len(names) != 2 {
+		t.Errorf("expected stale markers for a and b, got %v", names)
+	}
+
+	if targets := s.List(); len(targets) != 0 {
+		t.Errorf("expected the target to be removed, got %v", targets)
+	}
+
+	if stale := s.Remove(r.URL(), now); stale != nil {
+		t.Errorf("expected nothing for an unknown target, got %v", stale)
+	}
+}
+
+func TestTargetStatsExpire(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		since    time.Duration
+		expired  bool
+	}{
+		{"recent", 0, time.Minute, false},
+		{"default expiry", 0, DefaultTargetExpiry + time.Second, true},
+		{"within intervals", 10 * time.Minute, 20 * time.Minute, false},
+		{"past intervals", 10 * time.Minute, 30*time.Minute + time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewTargetStats()
+			r := testResource(tt.interval)
+			last := time.Now()
+
+			s.SetSeries(r, last, testSeries(last, "a"))
+
+			expired := s.Expire(last.Add(tt.since), DefaultTargetExpiry)
+			if !tt.expired {
+				if len(expired) != 0 {
+					t.Errorf("expected the target to be kept, got %v", expired)
+				}
+				if len(s.List()) != 1 {
+					t.Error("expected the target to be listed")
+				}
+				return
+			}
+
+			if len(expired) != 1 {
+				t.Fatalf("expected the target to expire, got %v", expired)
+			}
+			if expired[0].Resource.URL() != r.URL() {
+				t.Errorf("expected %s to expire, got %s", r.URL(), expired[0].Resource.URL())
+			}
+			if names := staleNames(t, expired[0].Stale); len(names) != 1 || names[0] != "a" {
+				t.Errorf("expected a stale marker for a, got %v", names)
+			}
+			if len(s.List()) != 0 {
+				t.Error("expected the target to be removed")
+			}
+		})
+	}
+}
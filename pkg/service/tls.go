@@ -0,0 +1,96 @@
+// Copyright 2023 Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"ctx.sh/strata-collector/pkg/apis/strata.ctx.sh/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TLSConfigFactory creates a new tls config from the TLS configuration.  Certificates
+// referenced in secrets take precedence over certificates referenced by path.
+func TLSConfigFactory(ctx context.Context, c client.Reader, namespace string, obj *v1beta1.TLS) (*tls.Config, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if obj.ServerName != nil {
+		config.ServerName = *obj.ServerName
+	}
+
+	if obj.InsecureSkipVerify != nil {
+		config.InsecureSkipVerify = *obj.InsecureSkipVerify
+	}
+
+	ca, err := loadPEM(ctx, c, namespace, obj.CASecret, obj.CA)
+	if err != nil {
+		return nil, err
+	}
+
+	if ca != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("unable to parse CA certificate")
+		}
+		config.RootCAs = pool
+	}
+
+	cert, err := loadPEM(ctx, c, namespace, obj.CertSecret, obj.Cert)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := loadPEM(ctx, c, namespace, obj.KeySecret, obj.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert != nil && key != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	} else if cert != nil || key != nil {
+		return nil, fmt.Errorf("both a certificate and a key must be provided")
+	}
+
+	return config, nil
+}
+
+// loadPEM returns the contents of the secret key if the selector has been set,
+// otherwise the contents of the file at path.
+func loadPEM(ctx context.Context, c client.Reader, namespace string, sel *corev1.SecretKeySelector, path *string) ([]byte, error) {
+	if sel != nil {
+		return GetSecretValue(ctx, c, namespace, sel)
+	}
+
+	if path != nil && *path != "" {
+		return os.ReadFile(*path)
+	}
+
+	return nil, nil
+}